@@ -0,0 +1,122 @@
+package api_test
+
+import (
+	"fmt"
+	"image/color"
+	"net/http"
+	"picture_storage/apitest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 管理员上传公开和受限目录的图片，受限目录只授权给管理员自己
+func restrictedFixture(t *testing.T) (s *apitest.Server, admin string, publicID, privateID uint64) {
+	s = apitest.New(t)
+	admin = s.Bootstrap()
+	publicID = s.MustUpload(admin, "public", "a.png", apitest.PNG(4, 4, color.White), "cat", "shared")
+	privateID = s.MustUpload(admin, "private", "b.png", apitest.PNG(4, 4, color.Black), "secret", "shared")
+	adminID := s.Get("/api/auth/me", admin).Get("data.id").Uint()
+	body := gin.H{"directory": "private", "user_id": adminID, "permission": "read"}
+	if resp := s.Do(http.MethodPut, "/api/directory/permissions", admin, body); resp.Status != http.StatusOK {
+		t.Fatalf("set permission: %d %s", resp.Status, resp.Body)
+	}
+	return s, admin, publicID, privateID
+}
+
+func TestCheckImagesNotFound(t *testing.T) {
+	s, admin, publicID, privateID := restrictedFixture(t)
+	viewer := s.CreateUser(admin, "viewer", "viewer")
+	uploader := s.CreateUser(admin, "uploader", "uploader")
+
+	s.Run(t, []apitest.Case{
+		{Name: "管理员删除不存在的图片", Method: http.MethodDelete, Path: "/api/images", Token: admin, Body: gin.H{"ids": []uint64{999}}, Status: http.StatusNotFound, Expect: map[string]string{"code": "NOT_FOUND"}},
+		{Name: "部分图片不存在", Method: http.MethodPost, Path: "/api/images/tags", Token: admin, Body: gin.H{"image_ids": []uint64{publicID, 999}, "tags": []string{"dog"}}, Status: http.StatusNotFound},
+		{Name: "无权访问的目录", Method: http.MethodPost, Path: "/api/images/tags", Token: uploader, Body: gin.H{"image_ids": []uint64{privateID}, "tags": []string{"dog"}}, Status: http.StatusForbidden},
+		{Name: "不能移除无权访问目录的标签", Method: http.MethodDelete, Path: "/api/images/tags", Token: uploader, Body: gin.H{"image_ids": []uint64{privateID}, "tags": []string{"secret"}}, Status: http.StatusForbidden},
+		{Name: "不能替换无权访问目录的标签", Method: http.MethodPut, Path: "/api/images/tags", Token: uploader, Body: gin.H{"image_id": privateID, "tags": []string{"dog"}}, Status: http.StatusForbidden},
+		{Name: "上传者不能删除图片", Method: http.MethodDelete, Path: "/api/images", Token: uploader, Body: gin.H{"ids": []uint64{publicID}}, Status: http.StatusForbidden},
+		{Name: "浏览者不能删除", Method: http.MethodDelete, Path: "/api/images", Token: viewer, Body: gin.H{"ids": []uint64{publicID}}, Status: http.StatusForbidden},
+	})
+}
+
+func TestTagsScopedToDirectories(t *testing.T) {
+	s, admin, _, _ := restrictedFixture(t)
+	viewer := s.CreateUser(admin, "viewer", "viewer")
+
+	s.Run(t, []apitest.Case{
+		{Name: "管理员看到全部标签", Method: http.MethodGet, Path: "/api/tags/details", Token: admin, Status: http.StatusOK, Expect: map[string]string{
+			`data.list.#(name=="secret").count`: "1",
+			`data.list.#(name=="shared").count`: "2",
+		}},
+		{Name: "浏览者看不到受限目录的标签", Method: http.MethodGet, Path: "/api/tags/details", Token: viewer, Status: http.StatusOK, Expect: map[string]string{
+			`data.list.#(name=="secret")`:       "",
+			`data.list.#(name=="shared").count`: "1",
+		}},
+		{Name: "标签名列表", Method: http.MethodGet, Path: "/api/tags", Token: viewer, Status: http.StatusOK, Expect: map[string]string{
+			`data.#(=="secret")`: "",
+			`data.#(=="cat")`:    "cat",
+		}},
+		{Name: "自动补全", Method: http.MethodGet, Path: "/api/tags/autocomplete?q=sec", Token: viewer, Status: http.StatusOK, Expect: map[string]string{"data.#": "0"}},
+		{Name: "管理员自动补全", Method: http.MethodGet, Path: "/api/tags/autocomplete?q=sec", Token: admin, Status: http.StatusOK, Expect: map[string]string{"data.0.name": "secret"}},
+		{Name: "相关标签", Method: http.MethodGet, Path: "/api/tags/related?tags=shared", Token: viewer, Status: http.StatusOK, Expect: map[string]string{
+			`data.#(name=="cat").count`: "1",
+			`data.#(name=="secret")`:    "",
+		}},
+		{Name: "管理员相关标签", Method: http.MethodGet, Path: "/api/tags/related?tags=shared", Token: admin, Status: http.StatusOK, Expect: map[string]string{`data.#(name=="secret").count`: "1"}},
+	})
+}
+
+func TestSharesOwnedByCreator(t *testing.T) {
+	s, admin, publicID, privateID := restrictedFixture(t)
+	alice := s.CreateUser(admin, "alice", "uploader")
+	bob := s.CreateUser(admin, "bob", "uploader")
+
+	// 相册由管理员放入受限目录的图片，上传者分享相册时只能分享自己能看到的图片
+	albumID := s.Do(http.MethodPost, "/api/albums", admin, gin.H{"title": "mixed"}).Get("data.id").Uint()
+	if resp := s.Do(http.MethodPost, "/api/albums/images", admin, gin.H{"id": albumID, "image_ids": []uint64{publicID, privateID}}); resp.Status != http.StatusOK {
+		t.Fatalf("add album images: %d %s", resp.Status, resp.Body)
+	}
+	resp := s.Do(http.MethodPost, "/api/shares", alice, gin.H{"type": "album", "target_id": albumID})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("create share: %d %s", resp.Status, resp.Body)
+	}
+	shareID, token := resp.Get("data.id").Uint(), resp.Get("data.token").String()
+	adminToken := s.Do(http.MethodPost, "/api/shares", admin, gin.H{"type": "album", "target_id": albumID}).Get("data.token").String()
+
+	s.Run(t, []apitest.Case{
+		{Name: "创建者看到令牌", Method: http.MethodGet, Path: "/api/shares", Token: alice, Status: http.StatusOK, Expect: map[string]string{
+			"data.list.#":       "1",
+			"data.list.0.token": token,
+		}},
+		{Name: "其他上传者看不到", Method: http.MethodGet, Path: "/api/shares", Token: bob, Status: http.StatusOK, Expect: map[string]string{"data.list.#": "0"}},
+		{Name: "管理员看不到其他人的令牌", Method: http.MethodGet, Path: "/api/shares", Token: admin, Status: http.StatusOK, Expect: map[string]string{
+			"data.list.#": "2",
+			fmt.Sprintf("data.list.#(id==%d).token", shareID): "",
+		}},
+		{Name: "按创建者权限展示相册", Method: http.MethodGet, Path: "/s/" + token, Status: http.StatusOK, Expect: map[string]string{
+			"data.total":     "1",
+			"data.list.0.id": fmt.Sprint(publicID),
+		}},
+		{Name: "管理员的分享包含全部图片", Method: http.MethodGet, Path: "/s/" + adminToken, Status: http.StatusOK, Expect: map[string]string{"data.total": "2"}},
+		{Name: "受限图片不能通过分享访问", Method: http.MethodGet, Path: fmt.Sprintf("/s/%s/images/%d", token, privateID), Status: http.StatusNotFound},
+		{Name: "其他上传者不能撤销", Method: http.MethodDelete, Path: "/api/shares", Token: bob, Body: gin.H{"id": shareID}, Status: http.StatusNotFound},
+		{Name: "管理员可以撤销", Method: http.MethodDelete, Path: "/api/shares", Token: admin, Body: gin.H{"id": shareID}, Status: http.StatusOK},
+		{Name: "撤销后不能访问", Method: http.MethodGet, Path: "/s/" + token, Status: http.StatusNotFound},
+	})
+}
+
+func TestUserManagementRequiresAdmin(t *testing.T) {
+	s := apitest.New(t)
+	admin := s.Bootstrap()
+	uploader := s.CreateUser(admin, "uploader", "uploader")
+	uploaderID := s.Get("/api/auth/me", uploader).Get("data.id").Uint()
+
+	s.Run(t, []apitest.Case{
+		{Name: "管理员查看用户", Method: http.MethodGet, Path: "/api/users", Token: admin, Status: http.StatusOK, Expect: map[string]string{"data.list.#": "2"}},
+		{Name: "上传者不能查看用户", Method: http.MethodGet, Path: "/api/users", Token: uploader, Status: http.StatusForbidden},
+		{Name: "上传者不能修改角色", Method: http.MethodPut, Path: "/api/users/role", Token: uploader, Body: gin.H{"id": uploaderID, "role": "admin"}, Status: http.StatusForbidden},
+		{Name: "上传者不能创建用户", Method: http.MethodPost, Path: "/api/auth/register", Token: uploader, Body: gin.H{"username": "eve", "password": "eve-password"}, Status: http.StatusForbidden},
+		{Name: "管理员修改角色", Method: http.MethodPut, Path: "/api/users/role", Token: admin, Body: gin.H{"id": uploaderID, "role": "viewer"}, Status: http.StatusOK},
+	})
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"picture_storage/service"
+	"picture_storage/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AlbumAPI struct{}
+
+func NewAlbumAPI() *AlbumAPI {
+	return &AlbumAPI{}
+}
+
+var albumService *service.AlbumService
+
+// 相册列表
+func (api *AlbumAPI) GetAlbums(c *gin.Context) {
+	albums, err := albumServiceFor(c).GetAlbums()
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	list := make([]map[string]any, 0)
+	for _, album := range albums {
+		item := map[string]any{
+			"id":           album.ID,
+			"title":        album.Title,
+			"description":  album.Description,
+			"coverImageId": album.CoverImageID,
+			"imageCount":   album.ImageCount,
+			"createdAt":    album.CreatedAt,
+			"updatedAt":    album.UpdatedAt,
+			"thumbnailUrl": "",
+		}
+		if album.Cover != nil {
+			thumbnailURL, err := imageService.GetImageURL(*album.Cover, service.ImageVariantThumbnail)
+			if err != nil {
+				Fail(c, err)
+				return
+			}
+			item["thumbnailUrl"] = thumbnailURL
+		}
+		list = append(list, item)
+	}
+
+	Success(c, gin.H{
+		"list": list,
+	})
+}
+
+type AlbumRequest struct {
+	Title        string `json:"title" binding:"required"`
+	Description  string `json:"description"`
+	CoverImageID uint64 `json:"cover_image_id"`
+}
+
+// 创建相册
+func (api *AlbumAPI) CreateAlbum(c *gin.Context) {
+	var req AlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	albumID, err := albumServiceFor(c).CreateAlbum(req.Title, req.Description, req.CoverImageID)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, gin.H{
+		"id": albumID,
+	})
+}
+
+// 更新相册
+func (api *AlbumAPI) UpdateAlbum(c *gin.Context) {
+	var req struct {
+		ID uint64 `json:"id" binding:"required"`
+		AlbumRequest
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := albumServiceFor(c).UpdateAlbum(req.ID, req.Title, req.Description, req.CoverImageID)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 删除相册
+func (api *AlbumAPI) DeleteAlbum(c *gin.Context) {
+	var req struct {
+		ID uint64 `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	if err := albumServiceFor(c).DeleteAlbum(req.ID); err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 相册详情及其中的图片
+func (api *AlbumAPI) GetAlbumImages(c *gin.Context) {
+	var req struct {
+		ID       uint64 `json:"id" binding:"required"`
+		Page     int    `json:"page"`
+		PageSize int    `json:"page_size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	album, err := albumServiceFor(c).GetAlbum(req.ID)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	images, total, err := albumServiceFor(c).GetAlbumImages(req.ID, utils.GetPage(req.Page, req.PageSize))
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	list, err := imageListItems(images, true)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, gin.H{
+		"album": album,
+		"list":  list,
+		"total": total,
+	})
+}
+
+type AlbumImagesRequest struct {
+	ID       uint64   `json:"id" binding:"required"`
+	ImageIDs []uint64 `json:"image_ids"`
+}
+
+// 添加图片到相册
+func (api *AlbumAPI) AddAlbumImages(c *gin.Context) {
+	var req AlbumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	if err := albumServiceFor(c).AddAlbumImages(req.ID, req.ImageIDs); err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 从相册移除图片
+func (api *AlbumAPI) RemoveAlbumImages(c *gin.Context) {
+	var req AlbumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	if err := albumServiceFor(c).RemoveAlbumImages(req.ID, req.ImageIDs); err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 调整相册图片顺序
+func (api *AlbumAPI) ReorderAlbumImages(c *gin.Context) {
+	var req AlbumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	if err := albumServiceFor(c).ReorderAlbumImages(req.ID, req.ImageIDs); err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
@@ -0,0 +1,293 @@
+package api
+
+import (
+	"net/http"
+	"picture_storage/config"
+	"picture_storage/model"
+	"picture_storage/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiririx/krutils/ut"
+)
+
+type AuthAPI struct{}
+
+func NewAuthAPI() *AuthAPI {
+	return &AuthAPI{}
+}
+
+var authService *service.AuthService
+
+// 会话令牌的 cookie 名称，方便网页端直接使用
+const sessionCookie = "session"
+
+// 上下文中保存当前用户的键
+const contextUserKey = "user"
+
+// 从请求中提取令牌：Authorization: Bearer、X-API-Key 或 cookie
+func requestToken(c *gin.Context) string {
+	if authorization := c.GetHeader("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimPrefix(authorization, "Bearer ")
+	}
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+		return apiKey
+	}
+	if token, err := c.Cookie(sessionCookie); err == nil {
+		return token
+	}
+	return ""
+}
+
+// 解析请求身份，不拦截请求
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := requestToken(c); token != "" {
+			if user, err := authService.Authenticate(token); err == nil {
+				c.Set(contextUserKey, user)
+			}
+		}
+		c.Next()
+	}
+}
+
+// 要求登录；readOnly 的接口在允许匿名只读时放行
+func RequireLogin(readOnly bool, allowAnonymousRead bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := currentUser(c); ok {
+			c.Next()
+			return
+		}
+		if readOnly && allowAnonymousRead {
+			c.Next()
+			return
+		}
+		Fail(c, service.ErrUnauthorized)
+	}
+}
+
+func currentUser(c *gin.Context) (model.UserModel, bool) {
+	value, ok := c.Get(contextUserKey)
+	if !ok {
+		return model.UserModel{}, false
+	}
+	user, ok := value.(model.UserModel)
+	return user, ok
+}
+
+// 当前请求的操作者身份，未登录时为匿名
+func requestActor(c *gin.Context) service.Actor {
+	user, ok := currentUser(c)
+	if !ok {
+		return service.AnonymousActor()
+	}
+	return service.UserActor(user)
+}
+
+func authServiceFor(c *gin.Context) *service.AuthService {
+	return authService.As(requestActor(c))
+}
+
+func imageServiceFor(c *gin.Context) *service.ImageService {
+	return imageService.As(requestActor(c))
+}
+
+func albumServiceFor(c *gin.Context) *service.AlbumService {
+	return albumService.As(requestActor(c))
+}
+
+func shareServiceFor(c *gin.Context) *service.ShareService {
+	return shareService.As(requestActor(c))
+}
+
+// 写会话 cookie：SameSite=Lax 使跨站的表单提交和上传不带上 cookie，HTTPS 下加 Secure
+func setSessionCookie(c *gin.Context, token string, maxAge int) {
+	secure := c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, token, maxAge, "/", "", secure, true)
+}
+
+type CredentialsRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// 注册：没有任何用户时允许匿名注册默认租户的第一个管理员，之后由管理员在自己的租户下创建
+func (api *AuthAPI) Register(c *gin.Context) {
+	var req struct {
+		CredentialsRequest
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	bootstrap, err := authService.NeedsBootstrap()
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	var user model.UserModel
+	if bootstrap {
+		user, err = authService.Bootstrap(req.Username, req.Password)
+	} else if _, ok := currentUser(c); !ok {
+		err = service.ErrRegisterClosed
+	} else {
+		role := ut.String().DefaultIfEmpty(req.Role, service.RoleViewer)
+		user, err = authServiceFor(c).CreateUser(req.Username, req.Password, role)
+	}
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, user)
+}
+
+// 登录
+func (api *AuthAPI) Login(c *gin.Context) {
+	var req CredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	token, expiresAt, err := authService.Login(req.Username, req.Password)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	setSessionCookie(c, token, int(service.SessionExpiry().Seconds()))
+	Success(c, gin.H{
+		"token":     token,
+		"expiresAt": expiresAt,
+	})
+}
+
+// 退出登录
+func (api *AuthAPI) Logout(c *gin.Context) {
+	if token := requestToken(c); token != "" {
+		if err := authService.Logout(token); err != nil {
+			Fail(c, err)
+			return
+		}
+	}
+	setSessionCookie(c, "", -1)
+	Success(c, nil)
+}
+
+// 当前用户
+func (api *AuthAPI) Me(c *gin.Context) {
+	user, _ := currentUser(c)
+	Success(c, user)
+}
+
+// 修改密码
+func (api *AuthAPI) ChangePassword(c *gin.Context) {
+	var req struct {
+		OldPassword string `json:"old_password" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	user, _ := currentUser(c)
+	if err := authService.ChangePassword(user.ID, requestToken(c), req.OldPassword, req.NewPassword); err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, nil)
+}
+
+// API Key 列表
+func (api *AuthAPI) GetAPIKeys(c *gin.Context) {
+	user, _ := currentUser(c)
+	apiKeys, err := authService.GetAPIKeys(user.ID)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, gin.H{
+		"list": apiKeys,
+	})
+}
+
+// 创建 API Key
+func (api *AuthAPI) CreateAPIKey(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	user, _ := currentUser(c)
+	apiKey, key, err := authService.CreateAPIKey(user.ID, req.Name)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, gin.H{
+		"id":   apiKey.ID,
+		"name": apiKey.Name,
+		"key":  key,
+	})
+}
+
+// 删除 API Key
+func (api *AuthAPI) DeleteAPIKey(c *gin.Context) {
+	var req struct {
+		ID uint64 `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	user, _ := currentUser(c)
+	if err := authService.DeleteAPIKey(user.ID, req.ID); err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, nil)
+}
+
+// 租户内的用户列表，仅管理员
+func (api *AuthAPI) GetUsers(c *gin.Context) {
+	users, err := authServiceFor(c).GetUsers()
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, gin.H{
+		"list": users,
+	})
+}
+
+// 修改用户角色，仅管理员
+func (api *AuthAPI) SetUserRole(c *gin.Context) {
+	var req struct {
+		ID   uint64 `json:"id" binding:"required"`
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	if err := authServiceFor(c).SetUserRole(req.ID, req.Role); err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, nil)
+}
+
+// 是否允许匿名访问只读接口
+func allowAnonymousRead() bool {
+	return config.C.Auth.AllowAnonymousRead
+}
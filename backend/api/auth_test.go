@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"picture_storage/apitest"
+	"picture_storage/db"
+	"picture_storage/model"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginCookie(t *testing.T) {
+	s := apitest.New(t)
+	s.Bootstrap()
+
+	body := gin.H{"username": apitest.AdminUsername, "password": apitest.AdminPassword}
+	resp := s.Do(http.MethodPost, "/api/auth/login", "", body)
+	cookies := (&http.Response{Header: resp.Header}).Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	if cookie := cookies[0]; cookie.SameSite != http.SameSiteLaxMode || !cookie.HttpOnly || cookie.Secure {
+		t.Errorf("cookie = %+v, want HttpOnly SameSite=Lax without Secure", cookie)
+	}
+
+	// 反向代理终止 TLS 时加上 Secure
+	resp = s.Do(http.MethodPost, "/api/auth/login", "", body, http.Header{"X-Forwarded-Proto": {"https"}})
+	if cookies := (&http.Response{Header: resp.Header}).Cookies(); len(cookies) != 1 || !cookies[0].Secure {
+		t.Errorf("cookies = %v, want Secure", cookies)
+	}
+}
+
+func TestRegisterBootstrapOnce(t *testing.T) {
+	s := apitest.New(t)
+
+	const n = 8
+	var wg sync.WaitGroup
+	status := make([]int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := gin.H{"username": fmt.Sprintf("admin%d", i), "password": "admin-password"}
+			status[i] = s.Do(http.MethodPost, "/api/auth/register", "", body).Status
+		}(i)
+	}
+	wg.Wait()
+
+	var admins int64
+	if err := db.DB.Model(&model.UserModel{}).Count(&admins).Error; err != nil {
+		t.Fatal(err)
+	}
+	if admins != 1 {
+		t.Fatalf("users = %d, want 1, status %v", admins, status)
+	}
+
+	resp := s.Do(http.MethodPost, "/api/auth/register", "", gin.H{"username": "late", "password": "late-password"})
+	if resp.Status != http.StatusForbidden || resp.Get("code").String() != "REGISTER_CLOSED" {
+		t.Errorf("register after bootstrap: %d %s", resp.Status, resp.Body)
+	}
+}
+
+// 修改密码后当前会话继续有效，其他会话失效
+func TestChangePasswordKeepsCurrentSession(t *testing.T) {
+	s := apitest.New(t)
+	current := s.Bootstrap()
+	other := s.Login(apitest.AdminUsername, apitest.AdminPassword)
+
+	s.Run(t, []apitest.Case{
+		{Name: "修改密码", Method: http.MethodPut, Path: "/api/auth/password", Token: current, Body: gin.H{"old_password": apitest.AdminPassword, "new_password": "changed-password"}, Status: http.StatusOK},
+		{Name: "当前会话保留", Method: http.MethodGet, Path: "/api/auth/me", Token: current, Status: http.StatusOK},
+		{Name: "其他会话失效", Method: http.MethodGet, Path: "/api/auth/me", Token: other, Status: http.StatusUnauthorized},
+	})
+	s.Login(apitest.AdminUsername, "changed-password")
+}
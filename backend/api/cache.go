@@ -0,0 +1,23 @@
+package api
+
+import (
+	"picture_storage/cache"
+	"picture_storage/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CacheAPI struct{}
+
+func NewCacheAPI() *CacheAPI {
+	return &CacheAPI{}
+}
+
+// 缓存命中统计，缓存由所有租户共用，仅默认租户的管理员
+func (api *CacheAPI) GetStats(c *gin.Context) {
+	if !requestActor(c).IsInstanceAdmin() {
+		Fail(c, service.ErrForbidden)
+		return
+	}
+	Success(c, cache.GetStats())
+}
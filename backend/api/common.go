@@ -1,18 +1,111 @@
 package api
 
-import "github.com/gin-gonic/gin"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"picture_storage/service"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+	codeOK          = "OK"
+)
+
+// 统一的响应格式；失败时 code 为 service 中定义的错误码，request_id 与响应头 X-Request-ID 相同
+type Response struct {
+	Status    string `json:"status"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Data      any    `json:"data"`
+	Reason    string `json:"reason,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// 错误码对应的 HTTP 状态码，未列出的按 500 处理
+var codeStatus = map[string]int{
+	service.CodeInvalidArgument:      http.StatusBadRequest,
+	service.CodeUnauthorized:         http.StatusUnauthorized,
+	service.CodeInvalidCredentials:   http.StatusUnauthorized,
+	service.CodeForbidden:            http.StatusForbidden,
+	service.CodeRegisterClosed:       http.StatusForbidden,
+	service.CodeSharePasswordInvalid: http.StatusUnauthorized,
+	service.CodeNotFound:             http.StatusNotFound,
+	service.CodeAlreadyExists:        http.StatusConflict,
+	service.CodeTagExists:            http.StatusConflict,
+	service.CodeConflict:             http.StatusConflict,
+	service.CodeShareExpired:         http.StatusGone,
+	service.CodeFileTooLarge:         http.StatusRequestEntityTooLarge,
+	service.CodeQuotaExceeded:        http.StatusRequestEntityTooLarge,
+	service.CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	service.CodeInvalidImage:         http.StatusUnprocessableEntity,
+}
 
 func Success(c *gin.Context, data interface{}) {
-	c.JSON(200, gin.H{
-		"message": "success",
-		"data":    data,
-		"status":  "success",
+	c.JSON(http.StatusOK, Response{
+		Status:    "success",
+		Code:      codeOK,
+		Message:   "success",
+		Data:      data,
+		RequestID: requestID(c),
 	})
 }
 
-func Fail(c *gin.Context, message string) {
-	c.JSON(400, gin.H{
-		"message": message,
-		"status":  "fail",
-	})
+// 按错误码返回对应的状态码和 Accept-Language 指定语言的信息，未知错误只记录日志不返回细节
+func Fail(c *gin.Context, err error) {
+	code, message := service.ErrorDetail(err, language(c))
+	status, ok := codeStatus[code]
+	if !ok {
+		status = http.StatusInternalServerError
+		log.Printf("[%s] %s %s: %v", requestID(c), c.Request.Method, c.Request.URL.Path, err)
+	}
+	response := Response{
+		Status:    "fail",
+		Code:      code,
+		Message:   message,
+		RequestID: requestID(c),
+	}
+	var quotaErr *service.QuotaError
+	var imageErr *service.ImageError
+	if errors.As(err, &quotaErr) {
+		response.Reason = quotaErr.Code
+	} else if errors.As(err, &imageErr) {
+		response.Reason = imageErr.Code
+	}
+	c.AbortWithStatusJSON(status, response)
+}
+
+func language(c *gin.Context) string {
+	return service.ParseLanguage(c.GetHeader("Accept-Language"))
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// 沿用客户端或网关传入的 X-Request-ID，没有或不合法时生成新的，并写入响应头
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
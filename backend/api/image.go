@@ -1,13 +1,21 @@
 package api
 
 import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"picture_storage/model"
 	"picture_storage/pkg/minio"
 	"picture_storage/service"
 	"picture_storage/utils"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/kiririx/krutils/ut"
+	"gorm.io/gorm"
 )
 
 type ImageAPI struct{}
@@ -16,7 +24,8 @@ func NewImageAPI() *ImageAPI {
 	return &ImageAPI{}
 }
 
-var imageService = service.NewImageService()
+// 在 NewRouter 中初始化
+var imageService *service.ImageService
 
 type UploadRequest struct {
 	Directory string `json:"directory" form:"directory"`
@@ -26,20 +35,20 @@ type UploadRequest struct {
 func (api *ImageAPI) UploadImage(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
-		Fail(c, "获取文件失败")
+		Fail(c, service.Errorf(service.CodeInvalidArgument, "获取文件失败"))
 		return
 	}
 
 	var req UploadRequest
 	if err := c.ShouldBind(&req); err != nil {
-		Fail(c, "参数错误")
+		Fail(c, service.ErrInvalidArgument)
 		return
 	}
 
 	tags := ut.Then(len(req.Tags) > 0, strings.Split(req.Tags, ","), []string{})
-	imageID, err := imageService.SaveImage(req.Directory, file, tags)
+	imageID, err := imageServiceFor(c).SaveImage(req.Directory, file, tags)
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 
@@ -49,19 +58,88 @@ func (api *ImageAPI) UploadImage(c *gin.Context) {
 }
 
 func (api *ImageAPI) GetDirectoryList(c *gin.Context) {
-	directoryList, err := imageService.GetDirectoryList()
+	directoryList, err := imageServiceFor(c).GetDirectoryList()
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 	Success(c, directoryList)
 }
 
+// 目录权限列表
+func (api *ImageAPI) GetDirectoryPermissions(c *gin.Context) {
+	directory := c.Query("directory")
+	if directory == "" {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+	permissions, err := imageServiceFor(c).GetDirectoryPermissions(directory)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, gin.H{
+		"list": permissions,
+	})
+}
+
+// 设置用户的目录权限，permission 为空时移除授权
+func (api *ImageAPI) SetDirectoryPermission(c *gin.Context) {
+	var req struct {
+		Directory  string `json:"directory" binding:"required"`
+		UserID     uint64 `json:"user_id" binding:"required"`
+		Permission string `json:"permission"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+	if err := imageServiceFor(c).SetDirectoryPermission(req.Directory, req.UserID, req.Permission); err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, nil)
+}
+
+// 上传限制和配额使用情况
+func (api *ImageAPI) GetQuotaUsage(c *gin.Context) {
+	limits, usages, err := imageServiceFor(c).GetQuotaUsage()
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, gin.H{
+		"limits": limits,
+		"list":   usages,
+	})
+}
+
+// 设置目录或用户的配额
+func (api *ImageAPI) SetQuota(c *gin.Context) {
+	var req struct {
+		Scope     string `json:"scope" binding:"required"`
+		Target    string `json:"target" binding:"required"`
+		MaxBytes  int64  `json:"max_bytes"`
+		MaxImages int64  `json:"max_images"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+	if err := imageServiceFor(c).SetQuota(req.Scope, req.Target, req.MaxBytes, req.MaxImages); err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, nil)
+}
+
 type ImageListRequest struct {
 	Directory string   `json:"directory" form:"directory"`
 	Page      int      `json:"page" form:"page"`
 	PageSize  int      `json:"page_size" form:"page_size"`
 	Tags      []string `json:"tags" form:"tags"`
+	// 不返回系统生成的自动标签
+	HideAutoTags bool `json:"hide_auto_tags" form:"hide_auto_tags"`
 }
 
 type ImageListItem struct {
@@ -76,73 +154,258 @@ type ImageListItem struct {
 func (api *ImageAPI) GetImageList(c *gin.Context) {
 	var req ImageListRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		Fail(c, "参数错误")
+		Fail(c, service.ErrInvalidArgument)
 		return
 	}
 
 	pagination := utils.GetPage(req.Page, req.PageSize)
 
-	images, total, err := imageService.GetImageListByDirectory(req.Directory, req.Tags, pagination)
+	images, total, err := imageServiceFor(c).GetImageListByDirectory(req.Directory, req.Tags, pagination)
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 
-	imageIDs := make([]uint64, 0)
-	for _, image := range images {
-		imageIDs = append(imageIDs, image.ID)
+	list, err := imageListItems(images, !req.HideAutoTags)
+	if err != nil {
+		Fail(c, err)
+		return
 	}
 
 	Success(c, gin.H{
-		"list": func() []map[string]any {
-			tagMap, err := imageService.GetTagsByImageIDs(imageIDs)
-			if err != nil {
-				return []map[string]any{}
-			}
-			list := make([]map[string]any, 0)
-			for _, image := range images {
-				list = append(list, map[string]any{
-					"id":           image.ID,
-					"imageName":    image.ImageName,
-					"imageCode":    image.ImageCode,
-					"url":          minio.Client.GetObjectURL(image.Directory, image.ImageCode+"."+image.Ext),
-					"thumbnailUrl": minio.Client.GetObjectURL("tmp-thumbnail", image.ThumbnailCode+"."+image.Ext),
-					"ext":          image.Ext,
-					"tags": func() []string {
-						return tagMap[image.ID]
-					}(),
-					"size":      image.Size,
-					"directory": image.Directory,
-					"createdAt": image.CreatedAt,
-				})
-			}
-			return list
-		}(),
+		"list":  list,
 		"total": total,
 	})
 }
 
+// 构造图片列表项，包含访问地址和标签；地址或标签查询失败时整个请求失败，不返回不完整的列表
+func imageListItems(images []model.ImageModel, includeSystemTags bool) ([]map[string]any, error) {
+	imageIDs := make([]uint64, 0)
+	for _, image := range images {
+		imageIDs = append(imageIDs, image.ID)
+	}
+
+	tagMap, err := imageService.GetTagsByImageIDs(imageIDs, includeSystemTags)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]map[string]any, 0)
+	for _, image := range images {
+		url, err := imageService.GetImageURL(image, service.ImageVariantOriginal)
+		if err != nil {
+			return nil, err
+		}
+		thumbnailURL, err := imageService.GetImageURL(image, service.ImageVariantThumbnail)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, map[string]any{
+			"id":           image.ID,
+			"imageName":    image.ImageName,
+			"imageCode":    image.ImageCode,
+			"url":          url,
+			"thumbnailUrl": thumbnailURL,
+			"ext":          image.Ext,
+			"tags": func() []string {
+				return tagMap[image.ID]
+			}(),
+			"size":      image.Size,
+			"directory": image.Directory,
+			"createdAt": image.CreatedAt,
+		})
+	}
+	return list, nil
+}
+
+// 随机图片
+// mode: json 返回地址列表（默认），redirect 302 跳转到图片，raw 直接返回图片内容
+// variant: original 原图（默认），thumbnail 缩略图，resized 按 width/height 缩放
+// seed: 固定随机种子；no_repeat=true 或指定 session 时同一会话内不重复
+// strategy: uniform、recent、weighted、history，half_life_hours 为衰减半衰期，
+// tag_weights/directory_weights 形如 name:2,other:0.5
 func (api *ImageAPI) GetRandomImage(c *gin.Context) {
 	tagsParam := c.Query("tags")
 	countParam := c.Query("count")
 	directoryParam := c.Query("directory")
+	mode := c.DefaultQuery("mode", "json")
+	variant := c.DefaultQuery("variant", service.ImageVariantOriginal)
+	width := int(ut.Then(c.Query("width") != "", ut.Convert(c.Query("width")).Int64Value(), 0))
+	height := int(ut.Then(c.Query("height") != "", ut.Convert(c.Query("height")).Int64Value(), 0))
 
 	tags := ut.Then(tagsParam != "", strings.Split(tagsParam, ","), []string{})
 	count := ut.Then(countParam != "", ut.Convert(countParam).Int64Value(), 1)
 	directory := ut.Then(directoryParam != "", directoryParam, "")
+	halfLifeHours := ut.Then(c.Query("half_life_hours") != "", ut.Convert(c.Query("half_life_hours")).Float64Value(), 0)
 
-	image, err := imageService.GetRandomImage(directory, tags, count)
+	tagWeights, err := parseWeights(c.Query("tag_weights"))
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
-	Success(c, image)
+	directoryWeights, err := parseWeights(c.Query("directory_weights"))
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	images, err := imageServiceFor(c).GetRandomImages(service.RandomOptions{
+		Directory:        directory,
+		Tags:             tags,
+		Count:            count,
+		Seed:             c.Query("seed"),
+		Session:          randomSession(c),
+		Strategy:         c.Query("strategy"),
+		HalfLife:         time.Duration(halfLifeHours * float64(time.Hour)),
+		TagWeights:       tagWeights,
+		DirectoryWeights: directoryWeights,
+	})
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	switch mode {
+	case "json":
+		urls := make([]string, 0)
+		for _, image := range images {
+			url, err := imageServiceFor(c).GetImageURL(image, variant)
+			if err != nil {
+				Fail(c, err)
+				return
+			}
+			urls = append(urls, url)
+		}
+		Success(c, urls)
+	case "redirect", "raw":
+		if len(images) == 0 {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		image := images[0]
+		setNoCacheHeaders(c)
+
+		// resized 变体没有固定地址，只能直接返回内容
+		if mode == "redirect" && variant != service.ImageVariantResized {
+			url, err := imageServiceFor(c).GetImageURL(image, variant)
+			if err != nil {
+				Fail(c, err)
+				return
+			}
+			c.Redirect(http.StatusFound, url)
+			return
+		}
+
+		data, err := imageServiceFor(c).GetImageContent(image, variant, width, height)
+		if err != nil {
+			Fail(c, err)
+			return
+		}
+		c.Data(http.StatusOK, http.DetectContentType(data), data)
+	default:
+		Fail(c, service.ErrInvalidArgument)
+	}
+}
+
+const randomSessionCookie = "random_session"
+
+// 解析 name:weight 列表，名称中可以包含冒号，以最后一个冒号分隔
+func parseWeights(param string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	if param == "" {
+		return weights, nil
+	}
+	for _, item := range strings.Split(param, ",") {
+		index := strings.LastIndex(item, ":")
+		if index <= 0 {
+			return nil, service.Errorf(service.CodeInvalidArgument, "权重 '%s' 格式错误", item)
+		}
+		weight, err := strconv.ParseFloat(item[index+1:], 64)
+		if err != nil {
+			return nil, service.Errorf(service.CodeInvalidArgument, "权重 '%s' 格式错误", item)
+		}
+		weights[item[:index]] = weight
+	}
+	return weights, nil
+}
+
+// 优先使用 session 参数，其次是 no_repeat 模式下的 cookie
+func randomSession(c *gin.Context) string {
+	if session := c.Query("session"); session != "" {
+		return session
+	}
+	if c.Query("no_repeat") != "true" {
+		return ""
+	}
+	if session, err := c.Cookie(randomSessionCookie); err == nil && session != "" {
+		return session
+	}
+	session := uuid.NewString()
+	c.SetCookie(randomSessionCookie, session, int(30*24*time.Hour/time.Second), "/", "", false, true)
+	return session
+}
+
+func setNoCacheHeaders(c *gin.Context) {
+	c.Header("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	c.Header("Pragma", "no-cache")
+	c.Header("Expires", "0")
+}
+
+// 通过后端读取存储中的图片，地址固定不变
+// 文件名就是内容的 MD5，可以作为 ETag；Range 和条件请求由 http.ServeContent 处理
+func (api *ImageAPI) ServeFile(c *gin.Context) {
+	filename := c.Param("file")
+	ext := filepath.Ext(filename)
+	variant := c.DefaultQuery("variant", service.ImageVariantOriginal)
+
+	image, err := imageServiceFor(c).GetImageByFile(c.Param("directory"), strings.TrimSuffix(filename, ext), strings.TrimPrefix(ext, "."))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	file, object, err := imageServiceFor(c).OpenImage(image, variant)
+	if minio.IsNotFound(err) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	defer file.Close()
+
+	// 目录随时可能被设为私有，缓存每次都要带 ETag 回源验证，权限检查在返回 304 之前进行
+	// 登录用户看到的图片可能受目录权限限制，只允许私有缓存
+	_, loggedIn := currentUser(c)
+	c.Header("Cache-Control", ut.Then(loggedIn, "private", "public")+", no-cache")
+	c.Header("ETag", `"`+strings.TrimSuffix(object, filepath.Ext(object))+`"`)
+	http.ServeContent(c.Writer, c.Request, object, image.CreatedAt, file)
 }
 
 func (api *ImageAPI) GetTags(c *gin.Context) {
-	tags, err := imageService.GetTags()
+	// group=true 时按分类分组返回
+	if c.Query("group") == "true" {
+		tagDetails, err := imageServiceFor(c).GetTagDetails()
+		if err != nil {
+			Fail(c, err)
+			return
+		}
+		groups, err := imageServiceFor(c).GroupTagDetails(tagDetails)
+		if err != nil {
+			Fail(c, err)
+			return
+		}
+		Success(c, groups)
+		return
+	}
+
+	tags, err := imageServiceFor(c).GetTags()
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 	Success(c, tags)
@@ -153,13 +416,13 @@ func (api *ImageAPI) DeleteImages(c *gin.Context) {
 		IDs []int `json:"ids"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		Fail(c, "参数错误")
+		Fail(c, service.ErrInvalidArgument)
 		return
 	}
 
-	err := imageService.DeleteImages(req.IDs)
+	err := imageServiceFor(c).DeleteImages(req.IDs)
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 
@@ -172,11 +435,45 @@ func (api *ImageAPI) AddTags(c *gin.Context) {
 		Tags     []string `json:"tags"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		Fail(c, "参数错误")
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+	if err := imageServiceFor(c).AddTags(req.ImageIDs, req.Tags); err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, nil)
+}
+
+// 从图片上移除标签
+func (api *ImageAPI) RemoveTags(c *gin.Context) {
+	var req struct {
+		ImageIDs []uint64 `json:"image_ids"`
+		Tags     []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
 		return
 	}
-	if err := imageService.AddTags(req.ImageIDs, req.Tags); err != nil {
-		Fail(c, err.Error())
+	if err := imageServiceFor(c).RemoveTags(req.ImageIDs, req.Tags); err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, nil)
+}
+
+// 替换单张图片的全部标签
+func (api *ImageAPI) SetImageTags(c *gin.Context) {
+	var req struct {
+		ImageID uint64   `json:"image_id" binding:"required"`
+		Tags    []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+	if err := imageServiceFor(c).SetImageTags(req.ImageID, req.Tags); err != nil {
+		Fail(c, err)
 		return
 	}
 	Success(c, nil)
@@ -184,13 +481,19 @@ func (api *ImageAPI) AddTags(c *gin.Context) {
 
 // 获取标签详情（包含图片数量）
 func (api *ImageAPI) GetTagDetails(c *gin.Context) {
-	tagDetails, err := imageService.GetTagDetails()
+	tagDetails, err := imageServiceFor(c).GetTagDetails()
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	groups, err := imageServiceFor(c).GroupTagDetails(tagDetails)
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 	Success(c, gin.H{
-		"list": tagDetails,
+		"list":   tagDetails,
+		"groups": groups,
 	})
 }
 
@@ -200,13 +503,13 @@ func (api *ImageAPI) CreateTag(c *gin.Context) {
 		Name string `json:"name" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		Fail(c, "参数错误")
+		Fail(c, service.ErrInvalidArgument)
 		return
 	}
 
-	err := imageService.CreateTag(req.Name)
+	err := imageServiceFor(c).CreateTag(req.Name)
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 
@@ -220,13 +523,13 @@ func (api *ImageAPI) UpdateTag(c *gin.Context) {
 		NewName string `json:"new_name" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		Fail(c, "参数错误")
+		Fail(c, service.ErrInvalidArgument)
 		return
 	}
 
-	err := imageService.UpdateTag(req.OldName, req.NewName)
+	err := imageServiceFor(c).UpdateTag(req.OldName, req.NewName)
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 
@@ -239,13 +542,13 @@ func (api *ImageAPI) DeleteTag(c *gin.Context) {
 		Name string `json:"name" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		Fail(c, "参数错误")
+		Fail(c, service.ErrInvalidArgument)
 		return
 	}
 
-	err := imageService.DeleteTag(req.Name)
+	err := imageServiceFor(c).DeleteTag(req.Name)
 	if err != nil {
-		Fail(c, err.Error())
+		Fail(c, err)
 		return
 	}
 
@@ -0,0 +1,158 @@
+package api_test
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"net/http"
+	"picture_storage/apitest"
+	"picture_storage/config"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestImageListURLError(t *testing.T) {
+	s := apitest.New(t, func(cfg *config.Config) {
+		cfg.Storage.URLMode = "presigned"
+	})
+	admin := s.Bootstrap()
+	imageID := s.MustUpload(admin, "photos", "a.png", apitest.PNG(4, 4, color.White))
+	albumID := s.Do(http.MethodPost, "/api/albums", admin, gin.H{"title": "album", "cover_image_id": imageID}).Get("data.id").Uint()
+
+	s.Run(t, []apitest.Case{
+		{Name: "签名成功", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos"}, Status: http.StatusOK, Check: func(t *testing.T, resp *apitest.Response) {
+			if url := resp.Get("data.list.0.url").String(); !strings.HasPrefix(url, "memory://photos/") {
+				t.Errorf("url = %q", url)
+			}
+		}},
+	})
+
+	s.Storage.URLError = errors.New("sign failed")
+	s.Run(t, []apitest.Case{
+		{Name: "图片列表", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos"}, Status: http.StatusInternalServerError, Expect: map[string]string{"code": "INTERNAL_ERROR"}},
+		{Name: "相册列表", Method: http.MethodGet, Path: "/api/albums", Token: admin, Status: http.StatusInternalServerError},
+		{Name: "相册图片", Method: http.MethodPost, Path: "/api/albums/images/list", Token: admin, Body: gin.H{"id": albumID}, Status: http.StatusInternalServerError},
+	})
+}
+
+func TestImageRoutes(t *testing.T) {
+	s := apitest.New(t)
+	admin := s.Bootstrap()
+	viewer := s.CreateUser(admin, "viewer", "viewer")
+
+	// 上传使用表单，单独按表执行
+	ids := make(map[string]uint64)
+	uploads := []struct {
+		name     string
+		token    string
+		filename string
+		data     []byte
+		tags     []string
+		status   int
+		code     string
+	}{
+		{"带标签上传", admin, "a.png", apitest.PNG(4, 4, color.White), []string{"cat", "dog"}, http.StatusOK, "OK"},
+		{"上传第二张", admin, "b.png", apitest.PNG(4, 4, color.Black), []string{"cat"}, http.StatusOK, "OK"},
+		{"重复内容", admin, "c.png", apitest.PNG(4, 4, color.White), nil, http.StatusOK, "OK"},
+		{"浏览者不能上传", viewer, "d.png", apitest.PNG(4, 4, color.Gray{Y: 10}), nil, http.StatusForbidden, "FORBIDDEN"},
+		{"未登录", "", "e.png", apitest.PNG(4, 4, color.Gray{Y: 20}), nil, http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"不是图片", admin, "f.png", []byte("not an image"), nil, http.StatusUnprocessableEntity, "INVALID_IMAGE"},
+	}
+	for _, tc := range uploads {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := s.Upload(tc.token, "photos", tc.filename, tc.data, tc.tags...)
+			if resp.Status != tc.status || resp.Get("code").String() != tc.code {
+				t.Fatalf("upload: %d %s", resp.Status, resp.Body)
+			}
+			ids[tc.filename] = resp.Get("data.id").Uint()
+		})
+	}
+	a, b := ids["a.png"], ids["b.png"]
+	if a == 0 || b == 0 || ids["c.png"] != a {
+		t.Fatalf("ids = %v", ids)
+	}
+
+	s.Run(t, []apitest.Case{
+		{Name: "缺少文件", Method: http.MethodPost, Path: "/api/upload", Token: admin, Status: http.StatusBadRequest, Expect: map[string]string{"code": "INVALID_ARGUMENT"}},
+
+		{Name: "按上传时间倒序", Method: http.MethodPost, Path: "/api/images", Token: viewer, Body: gin.H{"directory": "photos"}, Status: http.StatusOK, Expect: map[string]string{
+			"data.total":     "2",
+			"data.list.0.id": fmt.Sprint(b),
+			"data.list.1.id": fmt.Sprint(a),
+		}},
+		{Name: "同时拥有全部标签", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos", "tags": []string{"cat", "dog"}}, Status: http.StatusOK, Expect: map[string]string{
+			"data.total":     "1",
+			"data.list.0.id": fmt.Sprint(a),
+		}},
+		{Name: "分页", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos", "page": 2, "page_size": 1}, Status: http.StatusOK, Expect: map[string]string{
+			"data.total":     "2",
+			"data.list.#":    "1",
+			"data.list.0.id": fmt.Sprint(a),
+		}},
+		{Name: "隐藏自动标签", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos", "tags": []string{"dog"}, "hide_auto_tags": true}, Status: http.StatusOK, Expect: map[string]string{
+			"data.list.0.tags": `["cat","dog"]`,
+		}},
+		{Name: "列表未登录", Method: http.MethodPost, Path: "/api/images", Body: gin.H{"directory": "photos"}, Status: http.StatusUnauthorized},
+		{Name: "列表参数错误", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: strings.NewReader("{"), Status: http.StatusBadRequest},
+
+		{Name: "随机图片", Method: http.MethodGet, Path: "/api/images/random?directory=photos&count=5", Token: viewer, Status: http.StatusOK, Expect: map[string]string{"data.#": "2"}},
+		{Name: "按标签随机", Method: http.MethodGet, Path: "/api/images/random?tags=dog&count=5", Token: admin, Status: http.StatusOK, Expect: map[string]string{"data.#": "1"}},
+		{Name: "随机返回内容", Method: http.MethodGet, Path: "/api/images/random?directory=photos&mode=raw", Token: admin, Status: http.StatusOK, Check: func(t *testing.T, resp *apitest.Response) {
+			if contentType := resp.Header.Get("Content-Type"); contentType != "image/png" {
+				t.Errorf("content type = %q", contentType)
+			}
+		}},
+		{Name: "随机跳转", Method: http.MethodGet, Path: "/api/images/random?directory=photos&mode=redirect", Token: admin, Status: http.StatusFound},
+		{Name: "没有图片时跳转", Method: http.MethodGet, Path: "/api/images/random?directory=empty&mode=redirect", Token: admin, Status: http.StatusNotFound},
+		{Name: "未知模式", Method: http.MethodGet, Path: "/api/images/random?mode=unknown", Token: admin, Status: http.StatusBadRequest},
+		{Name: "标签权重不区分大小写", Method: http.MethodGet, Path: "/api/images/random?directory=photos&strategy=weighted&tag_weights=DOG:0&count=5", Token: admin, Status: http.StatusOK, Expect: map[string]string{"data.#": "1"}},
+		{Name: "权重格式错误", Method: http.MethodGet, Path: "/api/images/random?strategy=weighted&tag_weights=cat", Token: admin, Status: http.StatusBadRequest},
+
+		{Name: "浏览者不能删除", Method: http.MethodDelete, Path: "/api/images", Token: viewer, Body: gin.H{"ids": []uint64{a}}, Status: http.StatusForbidden},
+		{Name: "删除不存在的图片", Method: http.MethodDelete, Path: "/api/images", Token: admin, Body: gin.H{"ids": []uint64{a, 999}}, Status: http.StatusNotFound},
+		{Name: "删除参数错误", Method: http.MethodDelete, Path: "/api/images", Token: admin, Body: strings.NewReader("{"), Status: http.StatusBadRequest},
+		{Name: "删除", Method: http.MethodDelete, Path: "/api/images", Token: admin, Body: gin.H{"ids": []uint64{a}}, Status: http.StatusOK},
+		{Name: "删除后的列表", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos"}, Status: http.StatusOK, Expect: map[string]string{
+			"data.total":     "1",
+			"data.list.0.id": fmt.Sprint(b),
+		}},
+		{Name: "删除后的随机图片", Method: http.MethodGet, Path: "/api/images/random?tags=dog", Token: admin, Status: http.StatusOK, Expect: map[string]string{"data.#": "0"}},
+	})
+}
+
+// 目录之后可能被设为私有，文件响应每次都要回源验证，不能被长期缓存
+func TestServeFileRevalidates(t *testing.T) {
+	s := apitest.New(t, func(cfg *config.Config) { cfg.Auth.AllowAnonymousRead = true })
+	admin := s.Bootstrap()
+	id := s.MustUpload(admin, "photos", "a.png", apitest.PNG(4, 4, color.White))
+	code := s.Do(http.MethodPost, "/api/images", admin, gin.H{"directory": "photos"}).Get(fmt.Sprintf("data.list.#(id==%d).imageCode", id)).String()
+	path := "/files/photos/" + code + ".png"
+
+	resp := s.Get(path, "")
+	etag := resp.Header.Get("ETag")
+	if resp.Status != http.StatusOK || etag == "" {
+		t.Fatalf("anonymous file: %d etag %q", resp.Status, etag)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "public, no-cache" {
+		t.Errorf("anonymous Cache-Control = %q", cc)
+	}
+	if cc := s.Get(path, admin).Header.Get("Cache-Control"); cc != "private, no-cache" {
+		t.Errorf("logged in Cache-Control = %q", cc)
+	}
+	conditional := http.Header{"If-None-Match": {etag}}
+	if resp := s.Do(http.MethodGet, path, "", nil, conditional); resp.Status != http.StatusNotModified {
+		t.Errorf("revalidate: %d", resp.Status)
+	}
+
+	// 设为私有后，带 ETag 的验证请求也不能再得到 304
+	adminID := s.Get("/api/auth/me", admin).Get("data.id").Uint()
+	body := gin.H{"directory": "photos", "user_id": adminID, "permission": "read"}
+	if resp := s.Do(http.MethodPut, "/api/directory/permissions", admin, body); resp.Status != http.StatusOK {
+		t.Fatalf("set permission: %d %s", resp.Status, resp.Body)
+	}
+	if resp := s.Do(http.MethodGet, path, "", nil, conditional); resp.Status == http.StatusNotModified || resp.Status == http.StatusOK {
+		t.Errorf("revalidate private: %d", resp.Status)
+	}
+}
@@ -1,22 +1,108 @@
 package api
 
 import (
+	"fmt"
+	"picture_storage/db"
+	"picture_storage/pkg/minio"
+	"picture_storage/service"
+
 	"github.com/gin-gonic/gin"
 )
 
+// 使用 MinIO 和数据库创建路由，需要先初始化 db 和 minio
 func InitRouter() *gin.Engine {
-	router := gin.Default()
+	return NewRouter(service.NewImageService(minio.Client, service.NewGormStore(db.DB), service.SystemClock))
+}
+
+// 使用给定的图片服务创建路由，相册和分享服务共用它的存储和数据访问，登录服务共用它的时钟
+func NewRouter(images *service.ImageService) *gin.Engine {
+	imageService = images
+	authService = service.NewAuthService(images.Clock())
+	albumService = service.NewAlbumService(images)
+	shareService = service.NewShareService(images)
+
+	router := gin.New()
+	router.Use(gin.Logger(), RequestID(), gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		Fail(c, fmt.Errorf("panic: %v", recovered))
+	}))
+	router.Use(AuthMiddleware())
+	router.NoRoute(func(c *gin.Context) {
+		Fail(c, service.ErrNoRoute)
+	})
+
+	// 只读接口在开启 auth.allowAnonymousRead 时允许匿名访问，其余接口都需要登录
+	read := router.Group("", RequireLogin(true, allowAnonymousRead()))
+	write := router.Group("", RequireLogin(false, false))
+
+	authAPI := NewAuthAPI()
+	router.POST("/api/auth/register", authAPI.Register)
+	router.POST("/api/auth/login", authAPI.Login)
+	write.POST("/api/auth/logout", authAPI.Logout)
+	write.GET("/api/auth/me", authAPI.Me)
+	write.PUT("/api/auth/password", authAPI.ChangePassword)
+	write.GET("/api/auth/api-keys", authAPI.GetAPIKeys)
+	write.POST("/api/auth/api-keys", authAPI.CreateAPIKey)
+	write.DELETE("/api/auth/api-keys", authAPI.DeleteAPIKey)
+	write.GET("/api/users", authAPI.GetUsers)
+	write.PUT("/api/users/role", authAPI.SetUserRole)
+
+	tenantAPI := NewTenantAPI()
+	write.GET("/api/tenants", tenantAPI.GetTenants)
+	write.POST("/api/tenants", tenantAPI.CreateTenant)
+
+	cacheAPI := NewCacheAPI()
+	write.GET("/api/cache/stats", cacheAPI.GetStats)
+
 	imageAPI := NewImageAPI()
-	router.POST("/api/upload", imageAPI.UploadImage)
-	router.GET("/api/directory", imageAPI.GetDirectoryList)
-	router.POST("/api/images", imageAPI.GetImageList)
-	router.GET("/api/images/random", imageAPI.GetRandomImage)
-	router.GET("/api/tags", imageAPI.GetTags)
-	router.GET("/api/tags/details", imageAPI.GetTagDetails)
-	router.POST("/api/tags", imageAPI.CreateTag)
-	router.PUT("/api/tags", imageAPI.UpdateTag)
-	router.DELETE("/api/tags", imageAPI.DeleteTag)
-	router.POST("/api/images/tags", imageAPI.AddTags)
-	router.DELETE("/api/images", imageAPI.DeleteImages)
+	write.POST("/api/upload", imageAPI.UploadImage)
+	read.GET("/api/directory", imageAPI.GetDirectoryList)
+	read.GET("/api/directory/auto-tags", imageAPI.GetAutoTagRules)
+	write.PUT("/api/directory/auto-tags", imageAPI.SetAutoTagRules)
+	write.GET("/api/directory/permissions", imageAPI.GetDirectoryPermissions)
+	write.PUT("/api/directory/permissions", imageAPI.SetDirectoryPermission)
+	read.GET("/api/quota", imageAPI.GetQuotaUsage)
+	write.PUT("/api/quota", imageAPI.SetQuota)
+	read.POST("/api/images", imageAPI.GetImageList)
+	read.GET("/api/images/random", imageAPI.GetRandomImage)
+	read.GET("/api/tags", imageAPI.GetTags)
+	read.GET("/api/tags/details", imageAPI.GetTagDetails)
+	read.GET("/api/tags/autocomplete", imageAPI.AutocompleteTags)
+	read.GET("/api/tags/related", imageAPI.RelatedTags)
+	write.POST("/api/tags", imageAPI.CreateTag)
+	write.PUT("/api/tags", imageAPI.UpdateTag)
+	write.DELETE("/api/tags", imageAPI.DeleteTag)
+	write.POST("/api/tags/merge", imageAPI.MergeTags)
+	read.GET("/api/tags/aliases", imageAPI.GetTagAliases)
+	write.POST("/api/tags/aliases", imageAPI.AddTagAlias)
+	write.DELETE("/api/tags/aliases", imageAPI.DeleteTagAlias)
+	write.PUT("/api/tags/category", imageAPI.SetTagCategory)
+	read.GET("/api/tag-categories", imageAPI.GetTagCategories)
+	write.POST("/api/tag-categories", imageAPI.CreateTagCategory)
+	write.PUT("/api/tag-categories", imageAPI.UpdateTagCategory)
+	write.DELETE("/api/tag-categories", imageAPI.DeleteTagCategory)
+	write.POST("/api/images/tags", imageAPI.AddTags)
+	write.DELETE("/api/images/tags", imageAPI.RemoveTags)
+	write.PUT("/api/images/tags", imageAPI.SetImageTags)
+	write.POST("/api/images/auto-tags", imageAPI.RecalculateAutoTags)
+	write.DELETE("/api/images", imageAPI.DeleteImages)
+	read.GET("/files/:directory/:file", imageAPI.ServeFile)
+
+	albumAPI := NewAlbumAPI()
+	read.GET("/api/albums", albumAPI.GetAlbums)
+	write.POST("/api/albums", albumAPI.CreateAlbum)
+	write.PUT("/api/albums", albumAPI.UpdateAlbum)
+	write.DELETE("/api/albums", albumAPI.DeleteAlbum)
+	read.POST("/api/albums/images/list", albumAPI.GetAlbumImages)
+	write.POST("/api/albums/images", albumAPI.AddAlbumImages)
+	write.DELETE("/api/albums/images", albumAPI.RemoveAlbumImages)
+	write.PUT("/api/albums/images/order", albumAPI.ReorderAlbumImages)
+
+	shareAPI := NewShareAPI()
+	write.GET("/api/shares", shareAPI.GetShares)
+	write.POST("/api/shares", shareAPI.CreateShare)
+	write.DELETE("/api/shares", shareAPI.RevokeShare)
+	// 分享链接本身就是公开访问的
+	router.GET("/s/:token", shareAPI.ViewShare)
+	router.GET("/s/:token/images/:id", shareAPI.ViewShareImage)
 	return router
 }
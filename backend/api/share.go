@@ -0,0 +1,209 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"picture_storage/model"
+	"picture_storage/service"
+	"picture_storage/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiririx/krutils/ut"
+)
+
+type ShareAPI struct{}
+
+func NewShareAPI() *ShareAPI {
+	return &ShareAPI{}
+}
+
+var shareService *service.ShareService
+
+// 创建分享
+func (api *ShareAPI) CreateShare(c *gin.Context) {
+	var req struct {
+		Type           string   `json:"type" binding:"required"`
+		TargetID       uint64   `json:"target_id"`
+		Tags           []string `json:"tags"`
+		Directory      string   `json:"directory"`
+		ExpiresInHours float64  `json:"expires_in_hours"`
+		Password       string   `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	share, err := shareServiceFor(c).CreateShare(service.CreateShareRequest{
+		TargetType: req.Type,
+		TargetID:   req.TargetID,
+		Tags:       req.Tags,
+		Directory:  req.Directory,
+		ExpiresIn:  time.Duration(req.ExpiresInHours * float64(time.Hour)),
+		Password:   req.Password,
+	})
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, gin.H{
+		"id":        share.ID,
+		"token":     share.Token,
+		"path":      "/s/" + share.Token,
+		"expiresAt": share.ExpiresAt,
+	})
+}
+
+// 分享列表项，令牌只返回给分享的创建者
+type shareItem struct {
+	model.ShareModel
+	Token string `json:"token,omitempty"`
+	Path  string `json:"path,omitempty"`
+}
+
+// 分享列表
+func (api *ShareAPI) GetShares(c *gin.Context) {
+	shares, err := shareServiceFor(c).GetShares()
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	actor := requestActor(c)
+	items := make([]shareItem, 0, len(shares))
+	for _, share := range shares {
+		item := shareItem{ShareModel: share}
+		if share.CreatedBy == actor.UserID {
+			item.Token = share.Token
+			item.Path = "/s/" + share.Token
+		}
+		items = append(items, item)
+	}
+	Success(c, gin.H{
+		"list": items,
+	})
+}
+
+// 撤销分享
+func (api *ShareAPI) RevokeShare(c *gin.Context) {
+	var req struct {
+		ID uint64 `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	if err := shareServiceFor(c).RevokeShare(req.ID); err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 分享密码可以通过 password 参数或 X-Share-Password 请求头传递；分享页返回的图片地址使用 access 令牌代替密码
+func sharePassword(c *gin.Context) string {
+	if password := c.GetHeader("X-Share-Password"); password != "" {
+		return password
+	}
+	return c.Query("password")
+}
+
+// 公开访问分享：图片分享直接返回图片，相册和标签分享返回图片列表
+func (api *ShareAPI) ViewShare(c *gin.Context) {
+	share, err := shareService.ResolveShare(c.Param("token"), sharePassword(c), true)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	if share.TargetType == model.ShareTypeImage {
+		image, err := shareService.GetShareImage(share, share.TargetID)
+		if err != nil {
+			Fail(c, err)
+			return
+		}
+		serveShareImage(c, image)
+		return
+	}
+
+	page := int(ut.Then(c.Query("page") != "", ut.Convert(c.Query("page")).Int64Value(), 1))
+	pageSize := int(ut.Then(c.Query("page_size") != "", ut.Convert(c.Query("page_size")).Int64Value(), 20))
+	images, total, err := shareService.GetShareImages(share, utils.GetPage(page, pageSize))
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	// 图片地址指向分享路由，不暴露存储地址；有密码的分享带上短期访问令牌，不把密码放进地址
+	params := url.Values{}
+	if access := shareService.AccessToken(share); access != "" {
+		params.Set("access", access)
+	}
+	thumbnailParams := url.Values{"variant": {service.ImageVariantThumbnail}}
+	for key, values := range params {
+		thumbnailParams[key] = values
+	}
+	list := make([]map[string]any, 0)
+	for _, image := range images {
+		imagePath := fmt.Sprintf("/s/%s/images/%d", share.Token, image.ID)
+		imageURL := imagePath
+		if len(params) > 0 {
+			imageURL += "?" + params.Encode()
+		}
+		list = append(list, map[string]any{
+			"id":           image.ID,
+			"imageName":    image.ImageName,
+			"ext":          image.Ext,
+			"size":         image.Size,
+			"createdAt":    image.CreatedAt,
+			"url":          imageURL,
+			"thumbnailUrl": imagePath + "?" + thumbnailParams.Encode(),
+		})
+	}
+
+	Success(c, gin.H{
+		"type":      share.TargetType,
+		"expiresAt": share.ExpiresAt,
+		"list":      list,
+		"total":     total,
+	})
+}
+
+// 公开访问分享中的单张图片
+func (api *ShareAPI) ViewShareImage(c *gin.Context) {
+	share, err := shareService.ResolveShareImage(c.Param("token"), sharePassword(c), c.Query("access"))
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	imageID := uint64(ut.Convert(c.Param("id")).Int64Value())
+	image, err := shareService.GetShareImage(share, imageID)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	serveShareImage(c, image)
+}
+
+// 从存储流式读取图片，Range 和条件请求由 http.ServeContent 处理
+func serveShareImage(c *gin.Context, image model.ImageModel) {
+	variant := c.DefaultQuery("variant", service.ImageVariantOriginal)
+	file, object, err := imageService.OpenImage(image, variant)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	defer file.Close()
+
+	// 分享可能被撤销，只允许私有缓存
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Header("ETag", `"`+strings.TrimSuffix(object, filepath.Ext(object))+`"`)
+	http.ServeContent(c.Writer, c.Request, object, image.CreatedAt, file)
+}
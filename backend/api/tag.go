@@ -0,0 +1,270 @@
+package api
+
+import (
+	"picture_storage/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiririx/krutils/ut"
+)
+
+// 合并标签
+func (api *ImageAPI) MergeTags(c *gin.Context) {
+	var req struct {
+		Target  string   `json:"target" binding:"required"`
+		Sources []string `json:"sources" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := imageServiceFor(c).MergeTags(req.Target, req.Sources)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 获取标签别名
+func (api *ImageAPI) GetTagAliases(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	aliases, err := imageServiceFor(c).GetTagAliases(name)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, aliases)
+}
+
+// 添加标签别名
+func (api *ImageAPI) AddTagAlias(c *gin.Context) {
+	var req struct {
+		Name  string `json:"name" binding:"required"`
+		Alias string `json:"alias" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := imageServiceFor(c).AddTagAlias(req.Name, req.Alias)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 删除标签别名
+func (api *ImageAPI) DeleteTagAlias(c *gin.Context) {
+	var req struct {
+		Alias string `json:"alias" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := imageServiceFor(c).DeleteTagAlias(req.Alias)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 获取标签分类
+func (api *ImageAPI) GetTagCategories(c *gin.Context) {
+	categories, err := imageServiceFor(c).GetTagCategories()
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, categories)
+}
+
+// 创建标签分类
+func (api *ImageAPI) CreateTagCategory(c *gin.Context) {
+	var req struct {
+		Name  string `json:"name" binding:"required"`
+		Color string `json:"color"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := imageServiceFor(c).CreateTagCategory(req.Name, req.Color)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 更新标签分类颜色
+func (api *ImageAPI) UpdateTagCategory(c *gin.Context) {
+	var req struct {
+		Name  string `json:"name" binding:"required"`
+		Color string `json:"color"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := imageServiceFor(c).UpdateTagCategory(req.Name, req.Color)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 删除标签分类
+func (api *ImageAPI) DeleteTagCategory(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := imageServiceFor(c).DeleteTagCategory(req.Name)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 设置标签所属分类
+func (api *ImageAPI) SetTagCategory(c *gin.Context) {
+	var req struct {
+		Name     string `json:"name" binding:"required"`
+		Category string `json:"category"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := imageServiceFor(c).SetTagCategory(req.Name, req.Category)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 解析 limit 参数，默认 10，最大 100
+func parseLimit(c *gin.Context) int {
+	limit := int(ut.Then(c.Query("limit") != "", ut.Convert(c.Query("limit")).Int64Value(), 10))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	return limit
+}
+
+// 标签自动补全
+func (api *ImageAPI) AutocompleteTags(c *gin.Context) {
+	tags, err := imageServiceFor(c).AutocompleteTags(c.Query("q"), parseLimit(c))
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, tags)
+}
+
+// 相关标签推荐
+func (api *ImageAPI) RelatedTags(c *gin.Context) {
+	tagsParam := c.Query("tags")
+	if tagsParam == "" {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	tags, err := imageServiceFor(c).RelatedTags(strings.Split(tagsParam, ","), parseLimit(c))
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, tags)
+}
+
+// 获取目录的自动标签规则
+func (api *ImageAPI) GetAutoTagRules(c *gin.Context) {
+	directory := c.Query("directory")
+	if directory == "" {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	rules, err := imageServiceFor(c).GetAutoTagRules(directory)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, rules)
+}
+
+// 设置目录的自动标签规则
+func (api *ImageAPI) SetAutoTagRules(c *gin.Context) {
+	var req struct {
+		Directory string          `json:"directory" binding:"required"`
+		Rules     map[string]bool `json:"rules" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	err := imageServiceFor(c).SetAutoTagRules(req.Directory, req.Rules)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, nil)
+}
+
+// 重新计算自动标签
+func (api *ImageAPI) RecalculateAutoTags(c *gin.Context) {
+	var req struct {
+		Directory string   `json:"directory"`
+		ImageIDs  []uint64 `json:"image_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Directory == "" && len(req.ImageIDs) == 0) {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	count, err := imageServiceFor(c).RecalculateAutoTags(req.Directory, req.ImageIDs)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+
+	Success(c, gin.H{
+		"count": count,
+	})
+}
@@ -0,0 +1,68 @@
+package api_test
+
+import (
+	"fmt"
+	"image/color"
+	"net/http"
+	"picture_storage/apitest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTagRoutes(t *testing.T) {
+	s := apitest.New(t)
+	admin := s.Bootstrap()
+	uploader := s.CreateUser(admin, "uploader", "uploader")
+	viewer := s.CreateUser(admin, "viewer", "viewer")
+	a := s.MustUpload(admin, "photos", "a.png", apitest.PNG(4, 4, color.White), "cat")
+	b := s.MustUpload(admin, "photos", "b.png", apitest.PNG(4, 4, color.Black))
+
+	s.Run(t, []apitest.Case{
+		{Name: "创建标签", Method: http.MethodPost, Path: "/api/tags", Token: admin, Body: gin.H{"name": "blue"}, Status: http.StatusOK},
+		{Name: "重复创建", Method: http.MethodPost, Path: "/api/tags", Token: admin, Body: gin.H{"name": "blue"}, Status: http.StatusConflict, Expect: map[string]string{"code": "TAG_EXISTS"}},
+		{Name: "缺少名称", Method: http.MethodPost, Path: "/api/tags", Token: admin, Body: gin.H{}, Status: http.StatusBadRequest},
+		{Name: "浏览者不能创建", Method: http.MethodPost, Path: "/api/tags", Token: viewer, Body: gin.H{"name": "red"}, Status: http.StatusForbidden},
+		{Name: "未登录不能创建", Method: http.MethodPost, Path: "/api/tags", Body: gin.H{"name": "red"}, Status: http.StatusUnauthorized},
+		{Name: "标签列表", Method: http.MethodGet, Path: "/api/tags", Token: admin, Status: http.StatusOK, Expect: map[string]string{
+			`data.#(=="blue")`: "blue",
+			`data.#(=="cat")`:  "cat",
+		}},
+		{Name: "浏览者看不到未使用的标签", Method: http.MethodGet, Path: "/api/tags", Token: viewer, Status: http.StatusOK, Expect: map[string]string{`data.#(=="blue")`: ""}},
+
+		{Name: "重命名", Method: http.MethodPut, Path: "/api/tags", Token: admin, Body: gin.H{"old_name": "blue", "new_name": "navy"}, Status: http.StatusOK},
+		{Name: "重命名不存在的标签", Method: http.MethodPut, Path: "/api/tags", Token: admin, Body: gin.H{"old_name": "blue", "new_name": "sky"}, Status: http.StatusNotFound},
+		{Name: "重命名为已有标签", Method: http.MethodPut, Path: "/api/tags", Token: admin, Body: gin.H{"old_name": "navy", "new_name": "cat"}, Status: http.StatusConflict},
+		{Name: "上传者不能重命名", Method: http.MethodPut, Path: "/api/tags", Token: uploader, Body: gin.H{"old_name": "navy", "new_name": "sky"}, Status: http.StatusForbidden},
+
+		{Name: "添加标签", Method: http.MethodPost, Path: "/api/images/tags", Token: uploader, Body: gin.H{"image_ids": []uint64{a, b}, "tags": []string{"navy", "red"}}, Status: http.StatusOK},
+		{Name: "浏览者不能添加", Method: http.MethodPost, Path: "/api/images/tags", Token: viewer, Body: gin.H{"image_ids": []uint64{a}, "tags": []string{"green"}}, Status: http.StatusForbidden},
+		{Name: "图片不存在", Method: http.MethodPost, Path: "/api/images/tags", Token: admin, Body: gin.H{"image_ids": []uint64{999}, "tags": []string{"green"}}, Status: http.StatusNotFound},
+		{Name: "添加后的数量", Method: http.MethodGet, Path: "/api/tags/details", Token: viewer, Status: http.StatusOK, Expect: map[string]string{
+			`data.list.#(name=="navy").count`: "2",
+			`data.list.#(name=="red").count`:  "2",
+			`data.list.#(name=="cat").count`:  "1",
+		}},
+		{Name: "按新标签过滤", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos", "tags": []string{"navy", "cat"}}, Status: http.StatusOK, Expect: map[string]string{
+			"data.total":     "1",
+			"data.list.0.id": fmt.Sprint(a),
+		}},
+		{Name: "浏览者不能移除", Method: http.MethodDelete, Path: "/api/images/tags", Token: viewer, Body: gin.H{"image_ids": []uint64{b}, "tags": []string{"red"}}, Status: http.StatusForbidden},
+		{Name: "移除标签", Method: http.MethodDelete, Path: "/api/images/tags", Token: uploader, Body: gin.H{"image_ids": []uint64{b}, "tags": []string{"red"}}, Status: http.StatusOK},
+		{Name: "移除后的数量", Method: http.MethodGet, Path: "/api/tags/details", Token: admin, Status: http.StatusOK, Expect: map[string]string{`data.list.#(name=="red").count`: "1"}},
+		{Name: "浏览者不能替换", Method: http.MethodPut, Path: "/api/images/tags", Token: viewer, Body: gin.H{"image_id": b, "tags": []string{"green"}}, Status: http.StatusForbidden},
+		{Name: "替换标签", Method: http.MethodPut, Path: "/api/images/tags", Token: uploader, Body: gin.H{"image_id": b, "tags": []string{"navy", "green"}}, Status: http.StatusOK},
+		{Name: "替换后的数量", Method: http.MethodGet, Path: "/api/tags/details", Token: admin, Status: http.StatusOK, Expect: map[string]string{`data.list.#(name=="green").count`: "1"}},
+
+		{Name: "上传者不能删除", Method: http.MethodDelete, Path: "/api/tags", Token: uploader, Body: gin.H{"name": "navy"}, Status: http.StatusForbidden},
+		{Name: "删除标签", Method: http.MethodDelete, Path: "/api/tags", Token: admin, Body: gin.H{"name": "navy"}, Status: http.StatusOK},
+		{Name: "删除不存在的标签", Method: http.MethodDelete, Path: "/api/tags", Token: admin, Body: gin.H{"name": "navy"}, Status: http.StatusNotFound},
+		{Name: "删除后的标签", Method: http.MethodGet, Path: "/api/tags/details", Token: admin, Status: http.StatusOK, Expect: map[string]string{
+			`data.list.#(name=="navy")`:      "",
+			`data.list.#(name=="red").count`: "1",
+		}},
+		{Name: "删除后的图片标签", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos", "tags": []string{"red"}, "hide_auto_tags": true}, Status: http.StatusOK, Expect: map[string]string{
+			"data.list.0.tags": `["cat","red"]`,
+		}},
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"picture_storage/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TenantAPI struct{}
+
+func NewTenantAPI() *TenantAPI {
+	return &TenantAPI{}
+}
+
+var tenantService = service.NewTenantService()
+
+// 租户列表，仅默认租户的管理员
+func (api *TenantAPI) GetTenants(c *gin.Context) {
+	if !requestActor(c).IsInstanceAdmin() {
+		Fail(c, service.ErrForbidden)
+		return
+	}
+	tenants, err := tenantService.GetTenants()
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, gin.H{
+		"list": tenants,
+	})
+}
+
+// 创建租户，同时创建该租户的管理员
+func (api *TenantAPI) CreateTenant(c *gin.Context) {
+	var req struct {
+		Name     string `json:"name" binding:"required"`
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Fail(c, service.ErrInvalidArgument)
+		return
+	}
+
+	if !requestActor(c).IsInstanceAdmin() {
+		Fail(c, service.ErrForbidden)
+		return
+	}
+	tenant, err := tenantService.CreateTenant(req.Name, req.Username, req.Password)
+	if err != nil {
+		Fail(c, err)
+		return
+	}
+	Success(c, tenant)
+}
@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"fmt"
+	"image/color"
+	"net/http"
+	"picture_storage/apitest"
+	"picture_storage/service"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 默认租户和新租户各有一个管理员，两边的目录同名
+func tenantFixture(t *testing.T) (s *apitest.Server, admin, other string, tenantID uint64) {
+	s = apitest.New(t)
+	admin = s.Bootstrap()
+	resp := s.Do(http.MethodPost, "/api/tenants", admin, gin.H{"name": "team", "username": "team-admin", "password": "team-password"})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("create tenant: %d %s", resp.Status, resp.Body)
+	}
+	return s, admin, s.Login("team-admin", "team-password"), resp.Get("data.id").Uint()
+}
+
+func TestTenantIsolation(t *testing.T) {
+	s, admin, other, tenantID := tenantFixture(t)
+	white := apitest.PNG(4, 4, color.White)
+	a := s.MustUpload(admin, "photos", "a.png", white, "cat", "secret")
+	// 相同的内容在不同租户中各存一份
+	b := s.MustUpload(other, "photos", "b.png", white, "dog")
+	c := s.MustUpload(other, "photos", "c.png", apitest.PNG(4, 4, color.Black), "dog")
+	if a == b {
+		t.Fatalf("image shared across tenants: %d", a)
+	}
+	code := s.Do(http.MethodPost, "/api/images", other, gin.H{"directory": "photos", "tags": []string{"dog"}}).Get(fmt.Sprintf("data.list.#(id==%d).imageCode", c)).String()
+	if code == "" {
+		t.Fatal("image code of c not found")
+	}
+	if !s.Storage.Exists(service.TenantBucket(tenantID, "photos"), code+".png") || s.Storage.Exists("photos", code+".png") {
+		t.Errorf("c not stored in bucket %s", service.TenantBucket(tenantID, "photos"))
+	}
+
+	s.Run(t, []apitest.Case{
+		{Name: "只列出本租户的图片", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos"}, Status: http.StatusOK, Expect: map[string]string{
+			"data.total":     "1",
+			"data.list.0.id": fmt.Sprint(a),
+		}},
+		{Name: "新租户的图片", Method: http.MethodPost, Path: "/api/images", Token: other, Body: gin.H{"directory": "photos", "hide_auto_tags": true}, Status: http.StatusOK, Expect: map[string]string{
+			"data.total":       "2",
+			"data.list.0.id":   fmt.Sprint(c),
+			"data.list.1.id":   fmt.Sprint(b),
+			"data.list.1.tags": `["dog"]`,
+		}},
+		{Name: "按其他租户的标签过滤", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": "photos", "tags": []string{"dog"}}, Status: http.StatusOK, Expect: map[string]string{"data.total": "0"}},
+		{Name: "随机图片", Method: http.MethodGet, Path: "/api/images/random?count=10", Token: other, Status: http.StatusOK, Expect: map[string]string{"data.#": "2"}},
+		{Name: "不能读取其他租户的文件", Method: http.MethodGet, Path: "/files/photos/" + code + ".png", Token: admin, Status: http.StatusNotFound},
+		{Name: "读取本租户的文件", Method: http.MethodGet, Path: "/files/photos/" + code + ".png", Token: other, Status: http.StatusOK},
+		{Name: "不能给其他租户的图片打标签", Method: http.MethodPost, Path: "/api/images/tags", Token: admin, Body: gin.H{"image_ids": []uint64{b}, "tags": []string{"cat"}}, Status: http.StatusNotFound},
+		{Name: "不能删除其他租户的图片", Method: http.MethodDelete, Path: "/api/images", Token: other, Body: gin.H{"ids": []uint64{a}}, Status: http.StatusNotFound},
+
+		{Name: "标签列表", Method: http.MethodGet, Path: "/api/tags", Token: admin, Status: http.StatusOK, Expect: map[string]string{
+			`data.#(=="cat")`: "cat",
+			`data.#(=="dog")`: "",
+		}},
+		{Name: "标签详情", Method: http.MethodGet, Path: "/api/tags/details", Token: other, Status: http.StatusOK, Expect: map[string]string{
+			`data.list.#(name=="dog").count`: "2",
+			`data.list.#(name=="cat")`:       "",
+			`data.list.#(name=="secret")`:    "",
+		}},
+		{Name: "自动补全", Method: http.MethodGet, Path: "/api/tags/autocomplete?q=sec", Token: other, Status: http.StatusOK, Expect: map[string]string{"data.#": "0"}},
+		{Name: "相关标签", Method: http.MethodGet, Path: "/api/tags/related?tags=cat", Token: other, Status: http.StatusOK, Expect: map[string]string{"data.#": "0"}},
+		// 标签名只在租户内唯一
+		{Name: "创建同名标签", Method: http.MethodPost, Path: "/api/tags", Token: other, Body: gin.H{"name": "cat"}, Status: http.StatusOK},
+		{Name: "重命名只影响本租户", Method: http.MethodPut, Path: "/api/tags", Token: other, Body: gin.H{"old_name": "cat", "new_name": "kitten"}, Status: http.StatusOK},
+		{Name: "本租户的标签不变", Method: http.MethodGet, Path: "/api/tags/details", Token: admin, Status: http.StatusOK, Expect: map[string]string{
+			`data.list.#(name=="cat").count`: "1",
+			`data.list.#(name=="kitten")`:    "",
+		}},
+		{Name: "不能删除其他租户的标签", Method: http.MethodDelete, Path: "/api/tags", Token: other, Body: gin.H{"name": "secret"}, Status: http.StatusNotFound},
+
+		{Name: "目录列表", Method: http.MethodGet, Path: "/api/directory", Token: admin, Status: http.StatusOK, Expect: map[string]string{"data": `["photos"]`}},
+		{Name: "新租户的目录列表", Method: http.MethodGet, Path: "/api/directory", Token: other, Status: http.StatusOK, Expect: map[string]string{"data": `["photos"]`}},
+		{Name: "目录名不能冒充其他租户的 bucket", Method: http.MethodPost, Path: "/api/images", Token: admin, Body: gin.H{"directory": service.TenantBucket(tenantID, "photos")}, Status: http.StatusOK, Expect: map[string]string{"data.total": "0"}},
+		{Name: "只有默认租户的管理员能管理租户", Method: http.MethodGet, Path: "/api/tenants", Token: other, Status: http.StatusForbidden},
+	})
+
+	// 默认租户删除自己的图片不影响新租户中相同内容的图片
+	s.Run(t, []apitest.Case{
+		{Name: "删除本租户的图片", Method: http.MethodDelete, Path: "/api/images", Token: admin, Body: gin.H{"ids": []uint64{a}}, Status: http.StatusOK},
+		{Name: "其他租户的图片仍在", Method: http.MethodPost, Path: "/api/images", Token: other, Body: gin.H{"directory": "photos"}, Status: http.StatusOK, Expect: map[string]string{"data.total": "2"}},
+	})
+}
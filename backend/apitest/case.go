@@ -0,0 +1,42 @@
+package apitest
+
+import (
+	"testing"
+)
+
+// 表驱动测试中的一个请求
+type Case struct {
+	Name   string
+	Method string
+	Path   string
+	Token  string
+	// 编码为 JSON 的请求体，为 io.Reader 时原样发送
+	Body any
+	// 期望的状态码
+	Status int
+	// 期望的响应字段，键为 gjson 路径，值与字段的字符串形式比较
+	Expect map[string]string
+	// 其他断言，可为空
+	Check func(t *testing.T, resp *Response)
+}
+
+// 按顺序执行每个用例，前面的用例可以为后面的用例准备数据
+func (s *Server) Run(t *testing.T, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			resp := s.Do(c.Method, c.Path, c.Token, c.Body)
+			if c.Status != 0 && resp.Status != c.Status {
+				t.Fatalf("%s %s: status %d, want %d, body %s", c.Method, c.Path, resp.Status, c.Status, resp.Body)
+			}
+			for path, want := range c.Expect {
+				if got := resp.Get(path).String(); got != want {
+					t.Errorf("%s %s: %s = %q, want %q", c.Method, c.Path, path, got, want)
+				}
+			}
+			if c.Check != nil {
+				c.Check(t, resp)
+			}
+		})
+	}
+}
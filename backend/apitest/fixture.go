@@ -0,0 +1,70 @@
+package apitest
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 默认的管理员账号，由 Bootstrap 创建
+const (
+	AdminUsername = "admin"
+	AdminPassword = "admin-password"
+)
+
+// 在空数据库上注册第一个用户作为管理员，返回其令牌
+func (s *Server) Bootstrap() string {
+	s.t.Helper()
+	body := gin.H{"username": AdminUsername, "password": AdminPassword}
+	if resp := s.Do(http.MethodPost, "/api/auth/register", "", body); resp.Status != http.StatusOK {
+		s.t.Fatalf("register admin: %d %s", resp.Status, resp.Body)
+	}
+	return s.Login(AdminUsername, AdminPassword)
+}
+
+func (s *Server) Login(username, password string) string {
+	s.t.Helper()
+	resp := s.Do(http.MethodPost, "/api/auth/login", "", gin.H{"username": username, "password": password})
+	if resp.Status != http.StatusOK {
+		s.t.Fatalf("login %s: %d %s", username, resp.Status, resp.Body)
+	}
+	return resp.Get("data.token").String()
+}
+
+// 由管理员创建指定角色的用户并登录，返回其令牌
+func (s *Server) CreateUser(adminToken, username, role string) string {
+	s.t.Helper()
+	password := username + "-password"
+	body := gin.H{"username": username, "password": password, "role": role}
+	if resp := s.Do(http.MethodPost, "/api/auth/register", adminToken, body); resp.Status != http.StatusOK {
+		s.t.Fatalf("register %s: %d %s", username, resp.Status, resp.Body)
+	}
+	return s.Login(username, password)
+}
+
+// 上传图片并返回图片 ID，失败时终止测试
+func (s *Server) MustUpload(token, directory, filename string, data []byte, tags ...string) uint64 {
+	s.t.Helper()
+	resp := s.Upload(token, directory, filename, data, tags...)
+	if resp.Status != http.StatusOK {
+		s.t.Fatalf("upload %s: %d %s", filename, resp.Status, resp.Body)
+	}
+	return resp.Get("data.id").Uint()
+}
+
+// 生成纯色的 PNG 图片，不同颜色的图片内容不同，不会被去重
+func PNG(width, height int, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buffer bytes.Buffer
+	png.Encode(&buffer, img)
+	return buffer.Bytes()
+}
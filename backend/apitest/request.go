@@ -0,0 +1,95 @@
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// 按 gjson 路径读取响应中的字段，例如 data.id、data.list.#
+func (r *Response) Get(path string) gjson.Result {
+	return gjson.GetBytes(r.Body, path)
+}
+
+func (r *Response) Decode(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// 发送请求，body 为 io.Reader 时原样发送，否则编码为 JSON；token 为空时匿名访问
+func (s *Server) Do(method, path, token string, body any, header ...http.Header) *Response {
+	s.t.Helper()
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encode body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, h := range header {
+		for key, values := range h {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	s.Router.ServeHTTP(recorder, req)
+	return &Response{
+		Status: recorder.Code,
+		Header: recorder.Header(),
+		Body:   recorder.Body.Bytes(),
+	}
+}
+
+func (s *Server) Get(path, token string) *Response {
+	s.t.Helper()
+	return s.Do(http.MethodGet, path, token, nil)
+}
+
+// 上传图片到目录，tags 为空时不打标签
+func (s *Server) Upload(token, directory, filename string, data []byte, tags ...string) *Response {
+	s.t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("directory", directory)
+	if len(tags) > 0 {
+		writer.WriteField("tags", strings.Join(tags, ","))
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		s.t.Fatalf("create form file: %v", err)
+	}
+	part.Write(data)
+	writer.Close()
+
+	header := http.Header{"Content-Type": {writer.FormDataContentType()}}
+	return s.Do(http.MethodPost, "/api/upload", token, &body, header)
+}
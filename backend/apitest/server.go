@@ -0,0 +1,84 @@
+// Package apitest 在进程内启动完整的 HTTP 路由，使用临时 SQLite 数据库和内存存储，用于端到端测试
+//
+// 用法：
+//
+//	func TestTags(t *testing.T) {
+//		s := apitest.New(t)
+//		admin := s.Bootstrap()
+//		s.Run(t, []apitest.Case{
+//			{Name: "创建标签", Method: "POST", Path: "/api/tags", Token: admin, Body: gin.H{"name": "cat"}, Status: 200},
+//			{Name: "未登录", Method: "POST", Path: "/api/tags", Body: gin.H{"name": "dog"}, Status: 401},
+//		})
+//	}
+//
+// 服务依赖 db.DB、config.C 等全局变量，使用本包的测试不能并行执行
+package apitest
+
+import (
+	"io"
+	"path/filepath"
+	"picture_storage/api"
+	"picture_storage/cache"
+	"picture_storage/config"
+	"picture_storage/db"
+	"picture_storage/service"
+	"picture_storage/service/memory"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 内存时钟的起始时间，每次取时间后前进一秒，保证图片的创建时间有序
+var StartTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type Server struct {
+	Router  *gin.Engine
+	Storage *memory.Storage
+	Clock   *memory.Clock
+	t       testing.TB
+}
+
+// 创建使用独立数据库和存储的服务，configure 可以在连接数据库前修改配置
+func New(t testing.TB, configure ...func(cfg *config.Config)) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+
+	previous := config.C
+	cfg := config.Default()
+	cfg.DB.Driver = "sqlite"
+	cfg.DB.Path = filepath.Join(t.TempDir(), "picture_storage.db")
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	config.C = cfg
+	t.Cleanup(func() { config.C = previous })
+
+	if err := db.Init(); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db.DB = db.DB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	// 每个服务使用新的缓存，避免读到其他测试的数据
+	cache.Use(cache.NewLRU(cfg.Cache.MaxEntries))
+
+	storage := memory.NewStorage()
+	clock := memory.NewClock(StartTime, time.Second)
+	images := service.NewImageService(storage, service.NewGormStore(db.DB), clock)
+	return &Server{
+		Router:  api.NewRouter(images),
+		Storage: storage,
+		Clock:   clock,
+		t:       t,
+	}
+}
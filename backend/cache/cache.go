@@ -1,26 +1,76 @@
 package cache
 
 import (
-	"errors"
-	"sync"
+	"encoding/json"
+	"picture_storage/config"
+	"time"
 )
 
-var cacheMap sync.Map
+// 缓存后端，默认使用进程内的 LRU，多实例部署时可以通过 Use 换成 Redis 等共享实现
+// 值统一序列化为字节，两种后端的行为保持一致
+type Backend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+	DeletePrefix(prefix string)
+	Stats() Stats
+}
+
+// 命中统计
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int64 `json:"entries"`
+}
+
+var (
+	backend    Backend = NewLRU(10000)
+	defaultTTL         = 5 * time.Minute
+)
+
+// 按配置初始化默认的内存缓存
+func InitCache() {
+	defaultTTL = time.Duration(config.C.Cache.TTL) * time.Second
+	backend = NewLRU(config.C.Cache.MaxEntries)
+}
+
+// 替换缓存后端，需要在处理请求之前调用
+func Use(b Backend) {
+	backend = b
+}
 
-func Get(key string) (any, error) {
-	value, ok := cacheMap.Load(key)
+// 读取缓存并解码到 dest，未命中或解码失败时返回 false
+func Get(key string, dest any) bool {
+	data, ok := backend.Get(key)
 	if !ok {
-		return nil, errors.New("key not found")
+		return false
 	}
-	return value, nil
+	return json.Unmarshal(data, dest) == nil
 }
 
-func Set(key string, value any) error {
-	cacheMap.Store(key, value)
+// 写入缓存，ttl 为 0 时使用默认过期时间
+func Set(key string, value any, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	backend.Set(key, data, ttl)
 	return nil
 }
 
-func Delete(key string) error {
-	cacheMap.Delete(key)
-	return nil
+func Delete(key string) {
+	backend.Delete(key)
+}
+
+// 删除指定前缀的所有 key，用于数据修改后整体失效
+func DeletePrefix(prefix string) {
+	backend.DeletePrefix(prefix)
+}
+
+func GetStats() Stats {
+	return backend.Stats()
 }
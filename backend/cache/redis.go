@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Redis 兼容的客户端，只用到这几个命令，可以对 go-redis 等客户端做一层简单包装
+type RedisClient interface {
+	// key 不存在时返回错误
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	// 返回匹配 glob 模式的所有 key
+	Scan(ctx context.Context, match string) ([]string, error)
+}
+
+// 基于 Redis 的缓存后端，多个实例共享缓存和失效
+// 缓存只是加速手段，读写 Redis 出错时按未命中处理
+type RedisBackend struct {
+	client RedisClient
+	prefix string // 与其他服务共用 Redis 时区分 key
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewRedisBackend(client RedisClient, prefix string) *RedisBackend {
+	return &RedisBackend{client: client, prefix: prefix}
+}
+
+func (r *RedisBackend) Get(key string) ([]byte, bool) {
+	value, err := r.client.Get(context.Background(), r.prefix+key)
+	if err != nil {
+		r.misses.Add(1)
+		return nil, false
+	}
+	r.hits.Add(1)
+	return value, true
+}
+
+func (r *RedisBackend) Set(key string, value []byte, ttl time.Duration) {
+	_ = r.client.Set(context.Background(), r.prefix+key, value, ttl)
+}
+
+func (r *RedisBackend) Delete(key string) {
+	_ = r.client.Del(context.Background(), r.prefix+key)
+}
+
+func (r *RedisBackend) DeletePrefix(prefix string) {
+	ctx := context.Background()
+	keys, err := r.client.Scan(ctx, escapeGlob(r.prefix+prefix)+"*")
+	if err != nil || len(keys) == 0 {
+		return
+	}
+	_ = r.client.Del(ctx, keys...)
+}
+
+// 淘汰由 Redis 自己完成，这里不统计淘汰数和条目数
+func (r *RedisBackend) Stats() Stats {
+	return Stats{
+		Hits:   r.hits.Load(),
+		Misses: r.misses.Load(),
+	}
+}
+
+// 转义 glob 模式中的特殊字符
+func escapeGlob(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+	return replacer.Replace(s)
+}
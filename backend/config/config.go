@@ -1,15 +1,363 @@
 package config
 
 import (
-	"picture_storage/db"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
-	ec "github.com/kiririx/easy-config/ec"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
-var H ec.Handler
+// 全局配置，Load 之前为默认值
+var C = Default()
 
-func init() {
-	port, _ := strconv.Atoi(db.MYSQL_PORT)
-	H = ec.Initialize(ec.NewMySQLStorage(db.MYSQL_HOST, port, db.MYSQL_USERNAME, db.MYSQL_PASSWORD, db.MYSQL_DATABASE), "main")
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	DB        DBConfig        `yaml:"db" toml:"db"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Thumbnail ThumbnailConfig `yaml:"thumbnail" toml:"thumbnail"`
+	Limits    LimitsConfig    `yaml:"limits" toml:"limits"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Cache     CacheConfig     `yaml:"cache" toml:"cache"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr" toml:"addr" env:"PS_SERVER_ADDR"`
+}
+
+// 数据库连接，连接字段使用 PS_DB_* 环境变量，同时兼容原来的 MYSQL_* 名称
+type DBConfig struct {
+	// mysql、postgres 或 sqlite
+	Driver string `yaml:"driver" toml:"driver" env:"PS_DB_DRIVER"`
+	// PostgreSQL 连接串，为空时按 host 等字段拼接
+	DSN string `yaml:"dsn" toml:"dsn" env:"PS_DB_DSN"`
+	// SQLite 数据库文件路径
+	Path string `yaml:"path" toml:"path" env:"PS_DB_PATH"`
+	Host string `yaml:"host" toml:"host" env:"PS_DB_HOST,MYSQL_HOST"`
+	// 0 表示使用驱动的默认端口，MySQL 为 3306，PostgreSQL 为 5432
+	Port     int    `yaml:"port" toml:"port" env:"PS_DB_PORT,MYSQL_PORT"`
+	Username string `yaml:"username" toml:"username" env:"PS_DB_USERNAME,MYSQL_USERNAME"`
+	Password string `yaml:"password" toml:"password" env:"PS_DB_PASSWORD,MYSQL_PASSWORD"`
+	Database string `yaml:"database" toml:"database" env:"PS_DB_DATABASE,MYSQL_DATABASE"`
+	// 启动时自动执行未执行的迁移，关闭后需要用 migrate 命令手动执行
+	AutoMigrate bool `yaml:"autoMigrate" toml:"autoMigrate" env:"PS_DB_AUTO_MIGRATE"`
+}
+
+type StorageConfig struct {
+	Endpoint        string `yaml:"endpoint" toml:"endpoint" env:"PS_STORAGE_ENDPOINT"`
+	AccessKeyID     string `yaml:"accessKeyID" toml:"accessKeyID" env:"PS_STORAGE_ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secretAccessKey" toml:"secretAccessKey" env:"PS_STORAGE_SECRET_ACCESS_KEY"`
+	UseSSL          bool   `yaml:"useSSL" toml:"useSSL" env:"PS_STORAGE_USE_SSL"`
+	// 预签名地址有效期（秒），MinIO 最长支持 7 天
+	URLExpiry int64 `yaml:"urlExpiry" toml:"urlExpiry" env:"PS_STORAGE_URL_EXPIRY"`
+	// bucket 允许匿名读取时直接返回不带签名的地址
+	PublicBucket bool `yaml:"publicBucket" toml:"publicBucket" env:"PS_STORAGE_PUBLIC_BUCKET"`
+	// proxy 返回后端 /files 路由的地址，presigned 返回存储的地址
+	URLMode string `yaml:"urlMode" toml:"urlMode" env:"PS_STORAGE_URL_MODE"`
+}
+
+type ThumbnailConfig struct {
+	Bucket    string `yaml:"bucket" toml:"bucket" env:"PS_THUMBNAIL_BUCKET"`
+	MaxWidth  int    `yaml:"maxWidth" toml:"maxWidth" env:"PS_THUMBNAIL_MAX_WIDTH"`
+	MaxHeight int    `yaml:"maxHeight" toml:"maxHeight" env:"PS_THUMBNAIL_MAX_HEIGHT"`
+	Quality   int    `yaml:"quality" toml:"quality" env:"PS_THUMBNAIL_QUALITY"`
+}
+
+// 上传限制和默认配额，0 或空表示不限制
+type LimitsConfig struct {
+	MaxFileSize        int64    `yaml:"maxFileSize" toml:"maxFileSize" env:"PS_LIMITS_MAX_FILE_SIZE"`
+	AllowedExtensions  []string `yaml:"allowedExtensions" toml:"allowedExtensions" env:"PS_LIMITS_ALLOWED_EXTENSIONS"`
+	AllowedMimeTypes   []string `yaml:"allowedMimeTypes" toml:"allowedMimeTypes" env:"PS_LIMITS_ALLOWED_MIME_TYPES"`
+	MaxPixels          int64    `yaml:"maxPixels" toml:"maxPixels" env:"PS_LIMITS_MAX_PIXELS"`
+	DirectoryMaxBytes  int64    `yaml:"directoryMaxBytes" toml:"directoryMaxBytes" env:"PS_LIMITS_DIRECTORY_MAX_BYTES"`
+	DirectoryMaxImages int64    `yaml:"directoryMaxImages" toml:"directoryMaxImages" env:"PS_LIMITS_DIRECTORY_MAX_IMAGES"`
+	UserMaxBytes       int64    `yaml:"userMaxBytes" toml:"userMaxBytes" env:"PS_LIMITS_USER_MAX_BYTES"`
+	UserMaxImages      int64    `yaml:"userMaxImages" toml:"userMaxImages" env:"PS_LIMITS_USER_MAX_IMAGES"`
+}
+
+type AuthConfig struct {
+	// 是否允许匿名访问只读接口
+	AllowAnonymousRead bool `yaml:"allowAnonymousRead" toml:"allowAnonymousRead" env:"PS_AUTH_ALLOW_ANONYMOUS_READ"`
+	// 会话有效期（秒）
+	SessionExpiry int64 `yaml:"sessionExpiry" toml:"sessionExpiry" env:"PS_AUTH_SESSION_EXPIRY"`
+}
+
+type CacheConfig struct {
+	MaxEntries int   `yaml:"maxEntries" toml:"maxEntries" env:"PS_CACHE_MAX_ENTRIES"`
+	TTL        int64 `yaml:"ttl" toml:"ttl" env:"PS_CACHE_TTL"` // 秒
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{Addr: ":10048"},
+		DB:     DBConfig{Driver: "mysql", Path: "picture_storage.db", Host: "localhost", AutoMigrate: true},
+		Storage: StorageConfig{
+			Endpoint:        "localhost:9000",
+			AccessKeyID:     "minioadmin",
+			SecretAccessKey: "minioadmin",
+			URLExpiry:       86400,
+			URLMode:         "proxy",
+		},
+		Thumbnail: ThumbnailConfig{Bucket: "tmp-thumbnail", MaxWidth: 600, MaxHeight: 600, Quality: 85},
+		Limits:    LimitsConfig{MaxPixels: 100_000_000},
+		Auth:      AuthConfig{SessionExpiry: 7 * 24 * 3600},
+		Cache:     CacheConfig{MaxEntries: 10000, TTL: 300},
+	}
+}
+
+// 读取配置：默认值，然后是配置文件（按扩展名识别 YAML 或 TOML），最后是环境变量
+// path 为空或文件不存在时只使用默认值和环境变量
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := decode(path, data, cfg); err != nil {
+				return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+			}
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+	cfg.Limits.AllowedExtensions = lowerList(cfg.Limits.AllowedExtensions)
+	cfg.Limits.AllowedMimeTypes = lowerList(cfg.Limits.AllowedMimeTypes)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// 加载配置并设为全局配置
+func Init(path string) error {
+	cfg, err := Load(path)
+	if err != nil {
+		return err
+	}
+	C = cfg
+	return nil
+}
+
+func decode(path string, data []byte, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return toml.Unmarshal(data, cfg)
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, cfg)
+	}
+	return fmt.Errorf("不支持的配置文件格式，请使用 .yaml、.yml 或 .toml")
+}
+
+// 各驱动的默认端口
+var defaultPorts = map[string]int{
+	"mysql":    3306,
+	"postgres": 5432,
+}
+
+// 实际连接的端口，未配置时使用驱动的默认端口
+func (cfg DBConfig) ServerPort() int {
+	if cfg.Port != 0 {
+		return cfg.Port
+	}
+	return defaultPorts[cfg.Driver]
+}
+
+// 按 env 标签用环境变量覆盖配置，列表类型用逗号分隔
+// 标签中可以列出多个变量名，使用第一个设置了的
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+		var name, value string
+		for _, candidate := range strings.Split(t.Field(i).Tag.Get("env"), ",") {
+			if v, ok := os.LookupEnv(candidate); candidate != "" && ok {
+				name, value = candidate, v
+				break
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("环境变量 %s %v", name, err)
+		}
+	}
+	return nil
+}
+
+// 把字符串形式的值写入配置项
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("不是整数: '%s'", value)
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("不是布尔值: '%s'", value)
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		list := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	}
+	return nil
+}
+
+// 旧版保存在数据库配置表中的键与配置项的对应关系
+func (cfg *Config) legacyFields() map[string]any {
+	return map[string]any{
+		"minio.endpoint":           &cfg.Storage.Endpoint,
+		"minio.accessKeyID":        &cfg.Storage.AccessKeyID,
+		"minio.secretAccessKey":    &cfg.Storage.SecretAccessKey,
+		"minio.useSSL":             &cfg.Storage.UseSSL,
+		"minio.urlExpiry":          &cfg.Storage.URLExpiry,
+		"minio.publicBucket":       &cfg.Storage.PublicBucket,
+		"file.urlMode":             &cfg.Storage.URLMode,
+		"quota.maxFileSize":        &cfg.Limits.MaxFileSize,
+		"quota.allowedExtensions":  &cfg.Limits.AllowedExtensions,
+		"quota.allowedMimeTypes":   &cfg.Limits.AllowedMimeTypes,
+		"quota.maxPixels":          &cfg.Limits.MaxPixels,
+		"quota.directoryMaxBytes":  &cfg.Limits.DirectoryMaxBytes,
+		"quota.directoryMaxImages": &cfg.Limits.DirectoryMaxImages,
+		"quota.userMaxBytes":       &cfg.Limits.UserMaxBytes,
+		"quota.userMaxImages":      &cfg.Limits.UserMaxImages,
+		"auth.allowAnonymousRead":  &cfg.Auth.AllowAnonymousRead,
+		"cache.maxEntries":         &cfg.Cache.MaxEntries,
+		"cache.ttl":                &cfg.Cache.TTL,
+	}
+}
+
+// 列表为空即视为默认值，Load 会把未设置的列表转为空列表
+func isDefault(field, def reflect.Value) bool {
+	if field.Kind() == reflect.Slice {
+		return field.Len() == 0 && def.Len() == 0
+	}
+	return field.Interface() == def.Interface()
+}
+
+// 用旧版数据库配置表中的值补充仍为默认值的配置项，配置文件和环境变量中设置过的项优先
+// 返回实际使用的旧版配置键，应用后重新校验配置
+func (cfg *Config) ApplyLegacy(values map[string]string) ([]string, error) {
+	defaults := Default().legacyFields()
+	applied := make([]string, 0)
+	for key, ptr := range cfg.legacyFields() {
+		value, ok := values[key]
+		if !ok || strings.TrimSpace(value) == "" {
+			continue
+		}
+		field := reflect.ValueOf(ptr).Elem()
+		if !isDefault(field, reflect.ValueOf(defaults[key]).Elem()) {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return nil, fmt.Errorf("旧版配置 %s %v", key, err)
+		}
+		applied = append(applied, key)
+	}
+	sort.Strings(applied)
+	cfg.Limits.AllowedExtensions = lowerList(cfg.Limits.AllowedExtensions)
+	cfg.Limits.AllowedMimeTypes = lowerList(cfg.Limits.AllowedMimeTypes)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// 扩展名和 MIME 类型统一转为小写，去掉空项
+func lowerList(list []string) []string {
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// 检查配置，返回所有不合法的项
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Server.Addr != "", "server.addr 不能为空")
+
+	switch cfg.DB.Driver {
+	case "mysql", "postgres":
+		// PostgreSQL 配置了 DSN 时不需要单独的连接字段
+		if cfg.DB.Driver == "mysql" || cfg.DB.DSN == "" {
+			check(cfg.DB.Host != "", "db.host 不能为空")
+			check(cfg.DB.Port >= 0 && cfg.DB.Port <= 65535, "db.port 必须在 0-65535 之间，当前为 %d", cfg.DB.Port)
+			check(cfg.DB.Database != "", "db.database 不能为空")
+		}
+	case "sqlite":
+		check(cfg.DB.Path != "", "db.path 不能为空")
+	default:
+		check(false, "db.driver 只能是 mysql、postgres 或 sqlite，当前为 '%s'", cfg.DB.Driver)
+	}
+
+	check(cfg.Storage.Endpoint != "", "storage.endpoint 不能为空")
+	check(cfg.Storage.URLExpiry > 0 && cfg.Storage.URLExpiry <= 7*24*3600, "storage.urlExpiry 必须在 1-604800 秒之间，当前为 %d", cfg.Storage.URLExpiry)
+	check(cfg.Storage.URLMode == "proxy" || cfg.Storage.URLMode == "presigned", "storage.urlMode 只能是 proxy 或 presigned，当前为 '%s'", cfg.Storage.URLMode)
+
+	check(bucketNamePattern.MatchString(cfg.Thumbnail.Bucket), "thumbnail.bucket '%s' 不是合法的 bucket 名", cfg.Thumbnail.Bucket)
+	check(cfg.Thumbnail.MaxWidth > 0, "thumbnail.maxWidth 必须大于 0")
+	check(cfg.Thumbnail.MaxHeight > 0, "thumbnail.maxHeight 必须大于 0")
+	check(cfg.Thumbnail.Quality >= 1 && cfg.Thumbnail.Quality <= 100, "thumbnail.quality 必须在 1-100 之间，当前为 %d", cfg.Thumbnail.Quality)
+
+	for _, limit := range []struct {
+		key   string
+		value int64
+	}{
+		{"limits.maxFileSize", cfg.Limits.MaxFileSize},
+		{"limits.maxPixels", cfg.Limits.MaxPixels},
+		{"limits.directoryMaxBytes", cfg.Limits.DirectoryMaxBytes},
+		{"limits.directoryMaxImages", cfg.Limits.DirectoryMaxImages},
+		{"limits.userMaxBytes", cfg.Limits.UserMaxBytes},
+		{"limits.userMaxImages", cfg.Limits.UserMaxImages},
+	} {
+		check(limit.value >= 0, "%s 不能为负数", limit.key)
+	}
+
+	check(cfg.Auth.SessionExpiry > 0, "auth.sessionExpiry 必须大于 0")
+
+	check(cfg.Cache.MaxEntries >= 0, "cache.maxEntries 不能为负数")
+	check(cfg.Cache.TTL > 0, "cache.ttl 必须大于 0")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("配置不合法: %w", errors.Join(errs...))
+	}
+	return nil
 }
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 默认配置没有数据库名，补上后可以通过校验
+func validConfig() *Config {
+	cfg := Default()
+	cfg.DB.Database = "picture_storage"
+	return cfg
+}
+
+func TestApplyLegacy(t *testing.T) {
+	cfg := validConfig()
+	// 配置文件中设置过的项优先于旧版配置
+	cfg.Storage.Endpoint = "minio.internal:9000"
+
+	applied, err := cfg.ApplyLegacy(map[string]string{
+		"minio.endpoint":          "legacy:9000",
+		"minio.accessKeyID":       "legacy-key",
+		"minio.secretAccessKey":   "legacy-secret",
+		"minio.useSSL":            "true",
+		"file.urlMode":            "presigned",
+		"quota.allowedExtensions": "PNG, jpg",
+		"quota.maxFileSize":       "1048576",
+		"unknown.key":             "ignored",
+		"cache.ttl":               "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"file.urlMode", "minio.accessKeyID", "minio.secretAccessKey", "minio.useSSL", "quota.allowedExtensions", "quota.maxFileSize"}
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	if cfg.Storage.Endpoint != "minio.internal:9000" {
+		t.Errorf("endpoint = %q, legacy value must not override the config file", cfg.Storage.Endpoint)
+	}
+	if cfg.Storage.AccessKeyID != "legacy-key" || cfg.Storage.SecretAccessKey != "legacy-secret" || !cfg.Storage.UseSSL {
+		t.Errorf("storage = %+v", cfg.Storage)
+	}
+	if cfg.Storage.URLMode != "presigned" || cfg.Limits.MaxFileSize != 1048576 {
+		t.Errorf("urlMode = %q, maxFileSize = %d", cfg.Storage.URLMode, cfg.Limits.MaxFileSize)
+	}
+	if !reflect.DeepEqual(cfg.Limits.AllowedExtensions, []string{"png", "jpg"}) {
+		t.Errorf("allowedExtensions = %v", cfg.Limits.AllowedExtensions)
+	}
+	if cfg.Cache.TTL != Default().Cache.TTL {
+		t.Errorf("empty legacy value must be ignored, ttl = %d", cfg.Cache.TTL)
+	}
+}
+
+func TestApplyLegacyInvalid(t *testing.T) {
+	for _, values := range []map[string]string{
+		{"minio.urlExpiry": "soon"},
+		{"minio.useSSL": "maybe"},
+		{"file.urlMode": "direct"},
+	} {
+		if _, err := validConfig().ApplyLegacy(values); err == nil {
+			t.Errorf("ApplyLegacy(%v) succeeded", values)
+		} else if !strings.Contains(err.Error(), "配置") {
+			t.Errorf("ApplyLegacy(%v) = %v", values, err)
+		}
+	}
+}
+
+func TestDBEnv(t *testing.T) {
+	t.Setenv("PS_DB_DRIVER", "postgres")
+	t.Setenv("PS_DB_HOST", "pg.internal")
+	t.Setenv("MYSQL_HOST", "mysql.internal")
+	t.Setenv("MYSQL_USERNAME", "legacy")
+	t.Setenv("PS_DB_DATABASE", "picture_storage")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PS_DB_* 优先，未设置时使用原来的 MYSQL_* 变量
+	if cfg.DB.Host != "pg.internal" || cfg.DB.Username != "legacy" || cfg.DB.Database != "picture_storage" {
+		t.Errorf("db = %+v", cfg.DB)
+	}
+	// 未配置端口时按驱动选择默认端口
+	if port := cfg.DB.ServerPort(); port != 5432 {
+		t.Errorf("postgres port = %d", port)
+	}
+	cfg.DB.Driver = "mysql"
+	if port := cfg.DB.ServerPort(); port != 3306 {
+		t.Errorf("mysql port = %d", port)
+	}
+
+	t.Setenv("PS_DB_PORT", "6432")
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := cfg.DB.ServerPort(); port != 6432 {
+		t.Errorf("configured port = %d", port)
+	}
+}
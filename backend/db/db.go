@@ -0,0 +1,27 @@
+package db
+
+import (
+	"fmt"
+	"picture_storage/config"
+)
+
+// 数据库方言，Name 同时对应 migrations 下的目录
+type Dialect struct {
+	Name string
+}
+
+// 当前连接使用的方言
+var Current Dialect
+
+// 按配置的驱动连接数据库
+func Init() error {
+	switch config.C.DB.Driver {
+	case "mysql":
+		return InitMySQL()
+	case "sqlite":
+		return InitSQLite()
+	case "postgres":
+		return InitPostgres()
+	}
+	return fmt.Errorf("unsupported database driver '%s'", config.C.DB.Driver)
+}
@@ -0,0 +1,30 @@
+package db
+
+// 旧版通过 easy-config 把配置保存在数据库中，表名和模块名沿用它的默认值
+const (
+	legacyConfigTable  = "EASY_CONFIG_ITEMS"
+	legacyConfigModule = "main"
+)
+
+// 读取旧版配置表中的配置，表不存在时返回空
+func LegacyConfig() (map[string]string, error) {
+	values := make(map[string]string)
+	if !DB.Migrator().HasTable(legacyConfigTable) {
+		return values, nil
+	}
+	var rows []struct {
+		Name  string
+		Value string
+	}
+	err := DB.Table(legacyConfigTable).
+		Select("name, Value AS value").
+		Where("Module = ?", legacyConfigModule).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		values[row.Name] = row.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"path/filepath"
+	"picture_storage/config"
+	"testing"
+)
+
+func TestLegacyConfig(t *testing.T) {
+	previous := config.C
+	config.C = config.Default()
+	config.C.DB.Driver = "sqlite"
+	config.C.DB.Path = filepath.Join(t.TempDir(), "legacy.db")
+	t.Cleanup(func() { config.C = previous })
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := LegacyConfig()
+	if err != nil || len(values) != 0 {
+		t.Fatalf("without table: %v, %v", values, err)
+	}
+
+	// 与 easy-config 建的表结构一致
+	for _, statement := range []string{
+		`CREATE TABLE EASY_CONFIG_ITEMS (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR(255) NOT NULL, Value VARCHAR(4096) NOT NULL, Module VARCHAR(64) NOT NULL)`,
+		`INSERT INTO EASY_CONFIG_ITEMS (name, Value, Module) VALUES ('minio.endpoint', 'legacy:9000', 'main'), ('minio.endpoint', 'other:9000', 'other')`,
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	values, err = LegacyConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values["minio.endpoint"] != "legacy:9000" {
+		t.Errorf("values = %v", values)
+	}
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 各方言的迁移文件，命名为 <版本>_<名称>.up.sql / .down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// 迁移的执行状态，AppliedAt 为空表示还未执行
+type MigrationState struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// 记录已执行的迁移版本
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// 读取当前方言的迁移，按版本升序排列
+func loadMigrations() ([]Migration, error) {
+	dir := "migrations/" + Current.Name
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver '%s'", Current.Name)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names '%s' and '%s'", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s is missing the up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// 创建版本表并返回已执行的版本
+func appliedMigrations() (map[int64]schemaMigration, error) {
+	err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	var records []schemaMigration
+	if err := DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]schemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// 执行所有未执行的迁移
+func Migrate() error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		tx := DB.Begin()
+		if err := execScript(tx, migration.Up); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %04d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		record := schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+		if err := tx.Create(&record).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+		log.Default().Printf("[migrate] applied %04d_%s", migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// 按版本从新到旧回滚 steps 个已执行的迁移
+func Rollback(steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return fmt.Errorf("migration %04d_%s cannot be rolled back", migration.Version, migration.Name)
+		}
+		tx := DB.Begin()
+		if err := execScript(tx, migration.Down); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("rollback of %04d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		if err := tx.Delete(&schemaMigration{}, migration.Version).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+		log.Default().Printf("[migrate] rolled back %04d_%s", migration.Version, migration.Name)
+		steps--
+	}
+	return nil
+}
+
+// 列出所有迁移及其执行时间
+func MigrationStatus() ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &record.AppliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// 逐条执行脚本中的语句，部分驱动不支持一次执行多条语句
+func execScript(tx *gorm.DB, script string) error {
+	for _, statement := range strings.Split(script, ";\n") {
+		empty := true
+		for _, line := range strings.Split(statement, "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			continue
+		}
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+)
+
+// 各方言的迁移版本和名称必须一致，同一个版本号在所有数据库上表示相同的结构
+func TestMigrationVersionsMatch(t *testing.T) {
+	previous := Current
+	t.Cleanup(func() { Current = previous })
+
+	var want []Migration
+	for _, dialect := range []Dialect{SQLite, MySQL, Postgres} {
+		Current = dialect
+		migrations, err := loadMigrations()
+		if err != nil {
+			t.Fatalf("%s: %v", dialect.Name, err)
+		}
+		for _, migration := range migrations {
+			if migration.Down == "" {
+				t.Errorf("%s: %04d_%s has no down script", dialect.Name, migration.Version, migration.Name)
+			}
+		}
+		if want == nil {
+			want = migrations
+			continue
+		}
+		if len(migrations) != len(want) {
+			t.Fatalf("%s has %d migrations, %s has %d", dialect.Name, len(migrations), SQLite.Name, len(want))
+		}
+		for i, migration := range migrations {
+			if migration.Version != want[i].Version || migration.Name != want[i].Name {
+				t.Errorf("%s: %04d_%s, %s: %04d_%s", dialect.Name, migration.Version, migration.Name, SQLite.Name, want[i].Version, want[i].Name)
+			}
+		}
+	}
+}
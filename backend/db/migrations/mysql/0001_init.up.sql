@@ -0,0 +1,196 @@
+-- 初始表结构，已有数据库中存在的表会跳过
+
+-- Create table for TenantModel
+CREATE TABLE IF NOT EXISTS tenant (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_tenant_name (name)
+);
+
+-- 默认租户，使用不带前缀的 bucket
+INSERT IGNORE INTO tenant (id, name) VALUES (1, 'default');
+
+-- Create table for ImageModel
+CREATE TABLE IF NOT EXISTS image (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    image_name VARCHAR(255) NOT NULL,
+    image_code VARCHAR(64) NOT NULL DEFAULT '',
+    thumbnail_code VARCHAR(64) NOT NULL DEFAULT '',
+    ext VARCHAR(16) NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    directory VARCHAR(255) NOT NULL,
+    uploader_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_image_tenant_directory (tenant_id, directory),
+    KEY idx_image_uploader_id (uploader_id)
+);
+
+-- Create table for ImageTagModel
+CREATE TABLE IF NOT EXISTS image_tag (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    image_id BIGINT UNSIGNED NOT NULL,
+    tag_id BIGINT UNSIGNED NOT NULL,
+    is_system TINYINT(1) NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create table for TagModel
+CREATE TABLE IF NOT EXISTS tag (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    tag_name VARCHAR(255) NOT NULL,
+    category VARCHAR(64) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_tag_name (tenant_id, tag_name)
+);
+
+-- Create table for TagAliasModel
+CREATE TABLE IF NOT EXISTS tag_alias (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tag_id BIGINT UNSIGNED NOT NULL,
+    alias_name VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create table for TagCategoryModel
+CREATE TABLE IF NOT EXISTS tag_category (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    name VARCHAR(64) NOT NULL,
+    color VARCHAR(16) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_tag_category_name (tenant_id, name)
+);
+
+INSERT IGNORE INTO tag_category (tenant_id, name, color) VALUES
+    (1, 'character', '#00aa00'),
+    (1, 'artist', '#aa0000'),
+    (1, 'source', '#aa00aa'),
+    (1, 'rating', '#0073ff');
+
+-- Create table for DirectoryAutoTagModel
+CREATE TABLE IF NOT EXISTS directory_auto_tag (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    directory VARCHAR(255) NOT NULL,
+    rule VARCHAR(64) NOT NULL,
+    enabled TINYINT(1) NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_directory_auto_tag (tenant_id, directory, rule)
+);
+
+-- Create table for RandomSessionModel
+CREATE TABLE IF NOT EXISTS random_session (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    session_key VARCHAR(64) NOT NULL,
+    image_id BIGINT UNSIGNED NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_random_session_key (session_key),
+    KEY idx_random_session_created_at (created_at)
+);
+
+-- Create table for ImageServeHistoryModel
+CREATE TABLE IF NOT EXISTS image_serve_history (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    image_id BIGINT UNSIGNED NOT NULL,
+    served_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_image_serve_history_image_id (image_id, served_at),
+    KEY idx_image_serve_history_served_at (served_at)
+);
+
+-- Create table for AlbumModel
+CREATE TABLE IF NOT EXISTS album (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    cover_image_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Create table for AlbumImageModel
+CREATE TABLE IF NOT EXISTS album_image (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    album_id BIGINT UNSIGNED NOT NULL,
+    image_id BIGINT UNSIGNED NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_album_image (album_id, image_id),
+    KEY idx_album_image_image_id (image_id)
+);
+
+-- Create table for ShareModel
+CREATE TABLE IF NOT EXISTS share (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    token VARCHAR(64) NOT NULL,
+    target_type VARCHAR(16) NOT NULL,
+    target_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    tags VARCHAR(1024) NOT NULL DEFAULT '',
+    directory VARCHAR(255) NOT NULL DEFAULT '',
+    password_hash VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at DATETIME NOT NULL,
+    view_count BIGINT NOT NULL DEFAULT 0,
+    revoked TINYINT(1) NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_share_token (token)
+);
+
+-- Create table for UserModel
+CREATE TABLE IF NOT EXISTS user_account (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    username VARCHAR(64) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL DEFAULT 'viewer',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_user_account_username (username)
+);
+
+-- Create table for UserSessionModel
+CREATE TABLE IF NOT EXISTS user_session (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_user_session_token_hash (token_hash)
+);
+
+-- Create table for APIKeyModel
+CREATE TABLE IF NOT EXISTS api_key (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    last_used_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_api_key_key_hash (key_hash)
+);
+
+-- Create table for DirectoryPermissionModel
+CREATE TABLE IF NOT EXISTS directory_permission (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    directory VARCHAR(255) NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    permission VARCHAR(16) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_directory_permission (tenant_id, directory, user_id)
+);
+
+-- Create table for QuotaModel
+CREATE TABLE IF NOT EXISTS quota (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1,
+    scope VARCHAR(16) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    max_bytes BIGINT NOT NULL DEFAULT 0,
+    max_images BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_quota (tenant_id, scope, target)
+);
@@ -0,0 +1,6 @@
+-- 只删除索引，image 的字段是模型必需的，不回滚
+DROP INDEX idx_tag_alias_alias_name ON tag_alias;
+DROP INDEX idx_tag_alias_tag_id ON tag_alias;
+DROP INDEX idx_image_tag_tag_id ON image_tag;
+DROP INDEX uk_image_tag ON image_tag;
+DROP INDEX idx_image_image_code ON image;
@@ -0,0 +1,58 @@
+-- 旧版 db.sql 建的 image 表缺少以下字段，已存在时跳过
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'image' AND column_name = 'image_code') = 0,
+    'ALTER TABLE image ADD COLUMN image_code VARCHAR(64) NOT NULL DEFAULT '''' AFTER image_name', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'image' AND column_name = 'thumbnail_code') = 0,
+    'ALTER TABLE image ADD COLUMN thumbnail_code VARCHAR(64) NOT NULL DEFAULT '''' AFTER image_code', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'image' AND column_name = 'ext') = 0,
+    'ALTER TABLE image ADD COLUMN ext VARCHAR(16) NOT NULL DEFAULT '''' AFTER thumbnail_code', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'image' AND column_name = 'size') = 0,
+    'ALTER TABLE image ADD COLUMN size BIGINT NOT NULL DEFAULT 0 AFTER ext', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'image' AND index_name = 'idx_image_image_code') = 0,
+    'CREATE INDEX idx_image_image_code ON image (image_code)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- 去掉重复的图片标签关联，保留最早的一条
+DELETE t1 FROM image_tag t1
+    JOIN image_tag t2 ON t1.image_id = t2.image_id AND t1.tag_id = t2.tag_id AND t1.id > t2.id;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'image_tag' AND index_name = 'uk_image_tag') = 0,
+    'CREATE UNIQUE INDEX uk_image_tag ON image_tag (image_id, tag_id)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'image_tag' AND index_name = 'idx_image_tag_tag_id') = 0,
+    'CREATE INDEX idx_image_tag_tag_id ON image_tag (tag_id)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'tag_alias' AND index_name = 'idx_tag_alias_tag_id') = 0,
+    'CREATE INDEX idx_tag_alias_tag_id ON tag_alias (tag_id)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'tag_alias' AND index_name = 'idx_tag_alias_alias_name') = 0,
+    'CREATE INDEX idx_tag_alias_alias_name ON tag_alias (alias_name)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
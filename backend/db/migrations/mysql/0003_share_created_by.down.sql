@@ -0,0 +1,2 @@
+DROP INDEX idx_share_created_by ON share;
+ALTER TABLE share DROP COLUMN created_by;
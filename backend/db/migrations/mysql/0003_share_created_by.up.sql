@@ -0,0 +1,12 @@
+-- 记录分享的创建者，只有创建者和管理员可以查看和撤销；之前创建的分享为 0，只有管理员可以管理
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'share' AND column_name = 'created_by') = 0,
+    'ALTER TABLE share ADD COLUMN created_by BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER tenant_id', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'share' AND index_name = 'idx_share_created_by') = 0,
+    'CREATE INDEX idx_share_created_by ON share (created_by)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
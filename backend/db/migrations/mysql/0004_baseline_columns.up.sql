@@ -0,0 +1,75 @@
+-- 旧版 db.sql 建的 image、image_tag、tag 表缺少多租户、上传者、系统标签和标签分类的字段
+-- MySQL 的 DDL 不在事务中，每一步都先检查，失败后可以重新执行
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'image' AND column_name = 'tenant_id') = 0,
+    'ALTER TABLE image ADD COLUMN tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1 AFTER id', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'image' AND column_name = 'uploader_id') = 0,
+    'ALTER TABLE image ADD COLUMN uploader_id BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER `directory`', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'image' AND index_name = 'idx_image_tenant_directory') = 0,
+    'CREATE INDEX idx_image_tenant_directory ON image (tenant_id, directory)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'image' AND index_name = 'idx_image_uploader_id') = 0,
+    'CREATE INDEX idx_image_uploader_id ON image (uploader_id)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'image_tag' AND column_name = 'is_system') = 0,
+    'ALTER TABLE image_tag ADD COLUMN is_system TINYINT(1) NOT NULL DEFAULT 0 AFTER tag_id', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'tag' AND column_name = 'tenant_id') = 0,
+    'ALTER TABLE tag ADD COLUMN tenant_id BIGINT UNSIGNED NOT NULL DEFAULT 1 AFTER id', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = 'tag' AND column_name = 'category') = 0,
+    'ALTER TABLE tag ADD COLUMN category VARCHAR(64) NOT NULL DEFAULT '''' AFTER tag_name', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- 旧版没有唯一约束，可能有同名标签：合并到 ID 最小的一个后再加唯一索引
+-- 对照表要在同一条语句中引用两次，不能用临时表
+DROP TABLE IF EXISTS migration_tag_merge;
+CREATE TABLE migration_tag_merge (
+    tag_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+    keep_id BIGINT UNSIGNED NOT NULL
+);
+INSERT INTO migration_tag_merge (tag_id, keep_id)
+    SELECT tag.id, keep.keep_id
+    FROM tag
+    JOIN (SELECT tenant_id, tag_name, MIN(id) AS keep_id FROM tag GROUP BY tenant_id, tag_name HAVING COUNT(*) > 1) keep
+        ON keep.tenant_id = tag.tenant_id AND keep.tag_name = tag.tag_name
+    WHERE tag.id <> keep.keep_id;
+
+-- 合并后会重复的图片标签关联只保留一条：已关联保留的标签时删除，否则保留 ID 最小的一条
+DELETE r FROM image_tag r
+    JOIN migration_tag_merge rm ON rm.tag_id = r.tag_id
+    JOIN image_tag s ON s.image_id = r.image_id AND s.id <> r.id
+    LEFT JOIN migration_tag_merge sm ON sm.tag_id = s.tag_id
+    WHERE COALESCE(sm.keep_id, s.tag_id) = rm.keep_id AND (sm.tag_id IS NULL OR s.id < r.id);
+
+UPDATE image_tag JOIN migration_tag_merge m ON m.tag_id = image_tag.tag_id SET image_tag.tag_id = m.keep_id;
+UPDATE tag_alias JOIN migration_tag_merge m ON m.tag_id = tag_alias.tag_id SET tag_alias.tag_id = m.keep_id;
+DELETE tag FROM tag JOIN migration_tag_merge m ON m.tag_id = tag.id;
+DROP TABLE migration_tag_merge;
+
+SET @sql = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'tag' AND index_name = 'uk_tag_name') = 0,
+    'CREATE UNIQUE INDEX uk_tag_name ON tag (tenant_id, tag_name)', 'SELECT 1');
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
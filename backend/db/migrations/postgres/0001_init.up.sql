@@ -0,0 +1,182 @@
+-- 初始表结构
+
+CREATE TABLE IF NOT EXISTS tenant (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_tenant_name ON tenant (name);
+
+-- 默认租户，使用不带前缀的 bucket
+INSERT INTO tenant (id, name) VALUES (1, 'default') ON CONFLICT DO NOTHING;
+-- 手动指定了 ID，需要同步自增序列
+SELECT setval(pg_get_serial_sequence('tenant', 'id'), GREATEST((SELECT MAX(id) FROM tenant), 1));
+
+CREATE TABLE IF NOT EXISTS image (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    image_name VARCHAR(255) NOT NULL,
+    image_code VARCHAR(64) NOT NULL DEFAULT '',
+    thumbnail_code VARCHAR(64) NOT NULL DEFAULT '',
+    ext VARCHAR(16) NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    directory VARCHAR(255) NOT NULL,
+    uploader_id BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_image_tenant_directory ON image (tenant_id, directory);
+CREATE INDEX IF NOT EXISTS idx_image_uploader_id ON image (uploader_id);
+
+CREATE TABLE IF NOT EXISTS image_tag (
+    id BIGSERIAL PRIMARY KEY,
+    image_id BIGINT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    is_system BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tag (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    tag_name VARCHAR(255) NOT NULL,
+    category VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_tag_name ON tag (tenant_id, tag_name);
+
+CREATE TABLE IF NOT EXISTS tag_alias (
+    id BIGSERIAL PRIMARY KEY,
+    tag_id BIGINT NOT NULL,
+    alias_name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tag_category (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    name VARCHAR(64) NOT NULL,
+    color VARCHAR(16) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_tag_category_name ON tag_category (tenant_id, name);
+
+INSERT INTO tag_category (tenant_id, name, color) VALUES
+    (1, 'character', '#00aa00'),
+    (1, 'artist', '#aa0000'),
+    (1, 'source', '#aa00aa'),
+    (1, 'rating', '#0073ff')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS directory_auto_tag (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    directory VARCHAR(255) NOT NULL,
+    rule VARCHAR(64) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_directory_auto_tag ON directory_auto_tag (tenant_id, directory, rule);
+
+CREATE TABLE IF NOT EXISTS random_session (
+    id BIGSERIAL PRIMARY KEY,
+    session_key VARCHAR(64) NOT NULL,
+    image_id BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_random_session_key ON random_session (session_key);
+CREATE INDEX IF NOT EXISTS idx_random_session_created_at ON random_session (created_at);
+
+CREATE TABLE IF NOT EXISTS image_serve_history (
+    id BIGSERIAL PRIMARY KEY,
+    image_id BIGINT NOT NULL,
+    served_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_image_serve_history_image_id ON image_serve_history (image_id, served_at);
+CREATE INDEX IF NOT EXISTS idx_image_serve_history_served_at ON image_serve_history (served_at);
+
+CREATE TABLE IF NOT EXISTS album (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    cover_image_id BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS album_image (
+    id BIGSERIAL PRIMARY KEY,
+    album_id BIGINT NOT NULL,
+    image_id BIGINT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_album_image ON album_image (album_id, image_id);
+CREATE INDEX IF NOT EXISTS idx_album_image_image_id ON album_image (image_id);
+
+CREATE TABLE IF NOT EXISTS share (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    token VARCHAR(64) NOT NULL,
+    target_type VARCHAR(16) NOT NULL,
+    target_id BIGINT NOT NULL DEFAULT 0,
+    tags VARCHAR(1024) NOT NULL DEFAULT '',
+    directory VARCHAR(255) NOT NULL DEFAULT '',
+    password_hash VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    view_count BIGINT NOT NULL DEFAULT 0,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_share_token ON share (token);
+
+CREATE TABLE IF NOT EXISTS user_account (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    username VARCHAR(64) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL DEFAULT 'viewer',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_user_account_username ON user_account (username);
+
+CREATE TABLE IF NOT EXISTS user_session (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_user_session_token_hash ON user_session (token_hash);
+
+CREATE TABLE IF NOT EXISTS api_key (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_api_key_key_hash ON api_key (key_hash);
+
+CREATE TABLE IF NOT EXISTS directory_permission (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    directory VARCHAR(255) NOT NULL,
+    user_id BIGINT NOT NULL,
+    permission VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_directory_permission ON directory_permission (tenant_id, directory, user_id);
+
+CREATE TABLE IF NOT EXISTS quota (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 1,
+    scope VARCHAR(16) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    max_bytes BIGINT NOT NULL DEFAULT 0,
+    max_images BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_quota ON quota (tenant_id, scope, target);
@@ -0,0 +1,15 @@
+-- 已存在的 image 表补齐字段
+ALTER TABLE image ADD COLUMN IF NOT EXISTS image_code VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE image ADD COLUMN IF NOT EXISTS thumbnail_code VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE image ADD COLUMN IF NOT EXISTS ext VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE image ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_image_image_code ON image (image_code);
+
+-- 去掉重复的图片标签关联，保留最早的一条
+DELETE FROM image_tag WHERE id NOT IN (SELECT MIN(id) FROM image_tag GROUP BY image_id, tag_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uk_image_tag ON image_tag (image_id, tag_id);
+CREATE INDEX IF NOT EXISTS idx_image_tag_tag_id ON image_tag (tag_id);
+CREATE INDEX IF NOT EXISTS idx_tag_alias_tag_id ON tag_alias (tag_id);
+CREATE INDEX IF NOT EXISTS idx_tag_alias_alias_name ON tag_alias (alias_name);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_share_created_by;
+ALTER TABLE share DROP COLUMN IF EXISTS created_by;
@@ -0,0 +1 @@
+-- 补齐的字段和索引是模型必需的，回滚时保留，重新执行时会跳过已存在的部分
@@ -0,0 +1,11 @@
+-- 与 MySQL 的 0004 对应：PostgreSQL 从一开始就使用完整的表结构，这些字段和索引通常已经存在，这里只补齐缺少的部分
+ALTER TABLE image ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE image ADD COLUMN IF NOT EXISTS uploader_id BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_image_tenant_directory ON image (tenant_id, directory);
+CREATE INDEX IF NOT EXISTS idx_image_uploader_id ON image (uploader_id);
+
+ALTER TABLE image_tag ADD COLUMN IF NOT EXISTS is_system BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE tag ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE tag ADD COLUMN IF NOT EXISTS category VARCHAR(64) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS uk_tag_name ON tag (tenant_id, tag_name);
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS quota;
+DROP TABLE IF EXISTS directory_permission;
+DROP TABLE IF EXISTS api_key;
+DROP TABLE IF EXISTS user_session;
+DROP TABLE IF EXISTS user_account;
+DROP TABLE IF EXISTS share;
+DROP TABLE IF EXISTS album_image;
+DROP TABLE IF EXISTS album;
+DROP TABLE IF EXISTS image_serve_history;
+DROP TABLE IF EXISTS random_session;
+DROP TABLE IF EXISTS directory_auto_tag;
+DROP TABLE IF EXISTS tag_category;
+DROP TABLE IF EXISTS tag_alias;
+DROP TABLE IF EXISTS tag;
+DROP TABLE IF EXISTS image_tag;
+DROP TABLE IF EXISTS image;
+DROP TABLE IF EXISTS tenant;
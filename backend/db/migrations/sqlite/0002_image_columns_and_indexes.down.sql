@@ -0,0 +1,6 @@
+-- 只删除索引，image 的字段是模型必需的，不回滚
+DROP INDEX IF EXISTS idx_tag_alias_alias_name;
+DROP INDEX IF EXISTS idx_tag_alias_tag_id;
+DROP INDEX IF EXISTS idx_image_tag_tag_id;
+DROP INDEX IF EXISTS uk_image_tag;
+DROP INDEX IF EXISTS idx_image_image_code;
@@ -0,0 +1,3 @@
+-- 记录分享的创建者，只有创建者和管理员可以查看和撤销；之前创建的分享为 0，只有管理员可以管理
+ALTER TABLE share ADD COLUMN created_by INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_share_created_by ON share (created_by);
@@ -0,0 +1 @@
+-- 空迁移，回滚时无需操作
@@ -0,0 +1 @@
+-- 与 MySQL 的 0004 对应：SQLite 从一开始就使用完整的表结构，没有需要补齐的字段，保留空迁移使各方言的版本一致
@@ -3,8 +3,7 @@ package db
 import (
 	"fmt"
 	"log"
-	"os"
-	"strconv"
+	"picture_storage/config"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -12,26 +11,16 @@ import (
 
 var DB *gorm.DB
 
-var MYSQL_USERNAME = os.Getenv("MYSQL_USERNAME")
-var MYSQL_PASSWORD = os.Getenv("MYSQL_PASSWORD")
-var MYSQL_HOST = os.Getenv("MYSQL_HOST")
-var MYSQL_PORT = os.Getenv("MYSQL_PORT")
-var MYSQL_DATABASE = os.Getenv("MYSQL_DATABASE")
-
-func init() {
-	if err := InitMySQL(); err != nil {
-		panic(err)
-	}
-}
+var MySQL = Dialect{Name: "mysql"}
 
 func InitMySQL() error {
-	port, _ := strconv.Atoi(MYSQL_PORT)
+	cfg := config.C.DB
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		MYSQL_USERNAME,
-		MYSQL_PASSWORD,
-		MYSQL_HOST,
-		port,
-		MYSQL_DATABASE,
+		cfg.Username,
+		cfg.Password,
+		cfg.Host,
+		cfg.ServerPort(),
+		cfg.Database,
 	)
 
 	var err error
@@ -39,8 +28,9 @@ func InitMySQL() error {
 	if err != nil {
 		return fmt.Errorf("failed to connect to MySQL: %v", err)
 	}
+	Current = MySQL
 
-	log.Default().Println("[mysql] dsn: ", dsn)
+	log.Default().Printf("[mysql] %s@%s:%d/%s", cfg.Username, cfg.Host, cfg.ServerPort(), cfg.Database)
 
 	return nil
 }
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"picture_storage/config"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var Postgres = Dialect{Name: "postgres"}
+
+// 连接 PostgreSQL，优先使用配置的 DSN，否则按 host 等字段拼接
+func InitPostgres() error {
+	cfg := config.C.DB
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+			cfg.Host,
+			cfg.ServerPort(),
+			cfg.Username,
+			cfg.Password,
+			cfg.Database,
+		)
+	}
+
+	var err error
+	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to connect to PostgreSQL: %v", err)
+	}
+	Current = Postgres
+
+	log.Default().Println("[postgres] connected")
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"picture_storage/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+var SQLite = Dialect{Name: "sqlite"}
+
+// 连接 SQLite，不依赖 cgo，数据库文件不存在时自动创建
+func InitSQLite() error {
+	// WAL 模式下读写可以并发，写锁冲突时等待而不是直接失败
+	dsn := config.C.DB.Path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	var err error
+	DB, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite: %v", err)
+	}
+	Current = SQLite
+
+	log.Default().Println("[sqlite] path: ", config.C.DB.Path)
+
+	return nil
+}
@@ -0,0 +1,194 @@
+//go:build integration
+
+// 在真实的 MySQL 上验证从旧版 db.sql 升级，在 MySQL 或 PostgreSQL 上验证迁移可以重复执行，连接信息与服务相同，通过配置文件或环境变量指定：
+//
+//	PS_DB_DRIVER=mysql MYSQL_HOST=127.0.0.1 MYSQL_USERNAME=root MYSQL_DATABASE=ps_test go test -tags integration ./db
+//
+// 测试会删除数据库中的所有表，只能使用专门的测试库
+package db
+
+import (
+	"os"
+	"picture_storage/config"
+	"sort"
+	"testing"
+)
+
+// 按配置连接测试库并清空
+func openIntegrationDB(t *testing.T) {
+	t.Helper()
+	cfg, err := config.Load(os.Getenv("PS_CONFIG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DB.Driver == "sqlite" {
+		t.Skip("SQLite 没有旧版数据库，不需要升级")
+	}
+	previous := config.C
+	config.C = cfg
+	t.Cleanup(func() { config.C = previous })
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	tables, err := DB.Migrator().GetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		if err := DB.Migrator().DropTable(table); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpgradeFromBaseline(t *testing.T) {
+	openIntegrationDB(t)
+
+	// 只有 MySQL 有旧版 db.sql，PostgreSQL 从一开始就使用完整的表结构
+	baseline, err := os.ReadFile("testdata/baseline/" + Current.Name + ".sql")
+	if os.IsNotExist(err) {
+		t.Skipf("%s 没有旧版数据库", Current.Name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := execScript(DB, string(baseline)); err != nil {
+		t.Fatalf("baseline: %v", err)
+	}
+	// 旧版没有唯一约束，cat 有两个同名标签，图片 1 同时关联了这两个
+	for _, statement := range []string{
+		"INSERT INTO image (id, image_name, directory) VALUES (1, 'a.png', 'photos'), (2, 'b.png', 'photos')",
+		"INSERT INTO tag (id, tag_name) VALUES (1, 'cat'), (2, 'cat'), (3, 'dog')",
+		"INSERT INTO image_tag (image_id, tag_id) VALUES (1, 1), (1, 2), (2, 2), (2, 3)",
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for table, columns := range map[string][]string{
+		"image":     {"tenant_id", "uploader_id", "image_code", "thumbnail_code", "ext", "size"},
+		"image_tag": {"is_system"},
+		"tag":       {"tenant_id", "category"},
+		"share":     {"created_by"},
+	} {
+		for _, column := range columns {
+			// Migrator().HasColumn 需要模型，这里直接查询该列
+			if err := DB.Table(table).Select(column).Limit(1).Find(&[]map[string]any{}).Error; err != nil {
+				t.Errorf("%s.%s is missing: %v", table, column, err)
+			}
+		}
+	}
+	for table, indexes := range map[string][]string{
+		"image":     {"idx_image_tenant_directory", "idx_image_uploader_id", "idx_image_image_code"},
+		"image_tag": {"uk_image_tag", "idx_image_tag_tag_id"},
+		"tag":       {"uk_tag_name"},
+	} {
+		for _, index := range indexes {
+			if !DB.Migrator().HasIndex(table, index) {
+				t.Errorf("index %s on %s is missing", index, table)
+			}
+		}
+	}
+
+	var tags []struct {
+		ID       uint64
+		TenantID uint64
+		TagName  string
+	}
+	if err := DB.Table("tag").Order("id").Find(&tags).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].ID != 1 || tags[0].TenantID != 1 || tags[1].TagName != "dog" {
+		t.Errorf("tags = %+v, want cat merged into tag 1", tags)
+	}
+	imageTags := func(imageID uint64) []uint64 {
+		var tagIDs []uint64
+		if err := DB.Table("image_tag").Where("image_id = ?", imageID).Pluck("tag_id", &tagIDs).Error; err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(tagIDs, func(i, j int) bool { return tagIDs[i] < tagIDs[j] })
+		return tagIDs
+	}
+	if got := imageTags(1); len(got) != 1 || got[0] != 1 {
+		t.Errorf("image 1 tags = %v, want [1]", got)
+	}
+	if got := imageTags(2); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("image 2 tags = %v, want [1 3]", got)
+	}
+}
+
+// MySQL 的 DDL 会隐式提交，迁移中途失败后已执行的语句不会回滚，重新执行时每条语句都要能跳过已完成的部分
+func TestMigrationsRerunnable(t *testing.T) {
+	openIntegrationDB(t)
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range migrations {
+		tx := DB.Begin()
+		if err := execScript(tx, migration.Up); err != nil {
+			tx.Rollback()
+			t.Errorf("rerun %04d_%s: %v", migration.Version, migration.Name, err)
+			continue
+		}
+		if err := tx.Commit().Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 回滚到最初的版本时保留旧版 db.sql 建的表和其中的数据
+func TestRollbackKeepsBaselineTables(t *testing.T) {
+	openIntegrationDB(t)
+	baseline, err := os.ReadFile("testdata/baseline/" + Current.Name + ".sql")
+	if os.IsNotExist(err) {
+		t.Skipf("%s 没有旧版数据库", Current.Name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := execScript(DB, string(baseline)); err != nil {
+		t.Fatalf("baseline: %v", err)
+	}
+	if err := DB.Exec("INSERT INTO image (id, image_name, directory) VALUES (1, 'a.png', 'photos')").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Rollback(len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"image", "image_tag", "tag"} {
+		if !DB.Migrator().HasTable(table) {
+			t.Errorf("table %s dropped by rollback", table)
+		}
+	}
+	var count int64
+	if err := DB.Table("image").Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("images after rollback = %d, %v", count, err)
+	}
+	// 回滚后可以重新升级
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
 	"picture_storage/api"
+	"picture_storage/cache"
+	"picture_storage/config"
+	"picture_storage/db"
 	"picture_storage/pkg/minio"
+	"strconv"
+	"strings"
 
-	_ "github.com/kiririx/easy-config"
 	_ "github.com/sirupsen/logrus"
 	_ "github.com/tidwall/gjson"
 	_ "gorm.io/driver/mysql"
@@ -12,8 +20,88 @@ import (
 )
 
 func main() {
+	// 配置文件路径，也可以通过 PS_CONFIG 指定
+	configPath := flag.String("config", os.Getenv("PS_CONFIG"), "配置文件路径，支持 .yaml 和 .toml")
+	flag.Parse()
+	if *configPath == "" {
+		*configPath = "config.yaml"
+	}
+	if err := config.Init(*configPath); err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := db.Init(); err != nil {
+		log.Fatalln(err)
+	}
+	if err := applyLegacyConfig(); err != nil {
+		log.Fatalln(err)
+	}
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(flag.Args()[1:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if config.C.DB.AutoMigrate {
+		if err := db.Migrate(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	cache.InitCache()
 	// 初始化 MinIO 客户端
 	minio.InitMinioClient()
 	router := api.InitRouter()
-	router.Run(":10048")
+	router.Run(config.C.Server.Addr)
+}
+
+// 兼容升级前保存在数据库中的配置，只补充配置文件和环境变量没有设置的项
+func applyLegacyConfig() error {
+	values, err := db.LegacyConfig()
+	if err != nil {
+		return err
+	}
+	applied, err := config.C.ApplyLegacy(values)
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		log.Default().Printf("[config] using legacy database settings %s, move them to the config file", strings.Join(applied, ", "))
+	}
+	return nil
+}
+
+// migrate up | down [n] | status
+func runMigrate(args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "up":
+		return db.Migrate()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid rollback steps '%s'", args[1])
+			}
+			steps = n
+		}
+		return db.Rollback(steps)
+	case "status":
+		states, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", state.Version, state.Name, applied)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command '%s', expected up, down or status", command)
 }
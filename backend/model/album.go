@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+type AlbumModel struct {
+	ID           uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID     uint64    `json:"tenant_id" gorm:"column:tenant_id"`
+	Title        string    `json:"title" gorm:"column:title"`
+	Description  string    `json:"description" gorm:"column:description"`
+	CoverImageID uint64    `json:"cover_image_id" gorm:"column:cover_image_id"`
+	CreatedAt    time.Time `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"column:updated_at"`
+}
+
+type AlbumImageModel struct {
+	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	AlbumID   uint64    `json:"album_id" gorm:"column:album_id"`
+	ImageID   uint64    `json:"image_id" gorm:"column:image_id"`
+	Position  int       `json:"position" gorm:"column:position"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (*AlbumModel) TableName() string {
+	return "album"
+}
+
+func (*AlbumImageModel) TableName() string {
+	return "album_image"
+}
@@ -9,12 +9,14 @@ type ImageDTO struct {
 
 type ImageModel struct {
 	ID            uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID      uint64    `json:"tenant_id" gorm:"column:tenant_id"`
 	ImageName     string    `json:"image_name" gorm:"column:image_name"`
 	ImageCode     string    `json:"image_code" gorm:"column:image_code"`
 	ThumbnailCode string    `json:"thumbnail_code" gorm:"column:thumbnail_code"`
 	Ext           string    `json:"ext" gorm:"column:ext"`
 	Size          int64     `json:"size" gorm:"column:size"`
 	Directory     string    `json:"directory" gorm:"column:directory"`
+	UploaderID    uint64    `json:"uploader_id" gorm:"column:uploader_id"`
 	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at"`
 }
 
@@ -22,12 +24,23 @@ type ImageTagModel struct {
 	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
 	ImageID   uint64    `json:"image_id" gorm:"column:image_id"`
 	TagID     uint64    `json:"tag_id" gorm:"column:tag_id"`
+	IsSystem  bool      `json:"is_system" gorm:"column:is_system"`
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
 }
 
 type TagModel struct {
 	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID  uint64    `json:"tenant_id" gorm:"column:tenant_id"`
 	TagName   string    `json:"tag_name" gorm:"column:tag_name"`
+	Category  string    `json:"category" gorm:"column:category"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+type TagCategoryModel struct {
+	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID  uint64    `json:"tenant_id" gorm:"column:tenant_id"`
+	Name      string    `json:"name" gorm:"column:name"`
+	Color     string    `json:"color" gorm:"column:color"`
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
 }
 
@@ -35,6 +48,10 @@ func (*TagModel) TableName() string {
 	return "tag"
 }
 
+func (*TagCategoryModel) TableName() string {
+	return "tag_category"
+}
+
 func (*ImageTagModel) TableName() string {
 	return "image_tag"
 }
@@ -42,3 +59,48 @@ func (*ImageTagModel) TableName() string {
 func (*ImageModel) TableName() string {
 	return "image"
 }
+
+type TagAliasModel struct {
+	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TagID     uint64    `json:"tag_id" gorm:"column:tag_id"`
+	AliasName string    `json:"alias_name" gorm:"column:alias_name"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (*TagAliasModel) TableName() string {
+	return "tag_alias"
+}
+
+type DirectoryAutoTagModel struct {
+	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID  uint64    `json:"tenant_id" gorm:"column:tenant_id"`
+	Directory string    `json:"directory" gorm:"column:directory"`
+	Rule      string    `json:"rule" gorm:"column:rule"`
+	Enabled   bool      `json:"enabled" gorm:"column:enabled"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (*DirectoryAutoTagModel) TableName() string {
+	return "directory_auto_tag"
+}
+
+type RandomSessionModel struct {
+	ID         uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	SessionKey string    `json:"session_key" gorm:"column:session_key"`
+	ImageID    uint64    `json:"image_id" gorm:"column:image_id"`
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (*RandomSessionModel) TableName() string {
+	return "random_session"
+}
+
+type ImageServeHistoryModel struct {
+	ID       uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	ImageID  uint64    `json:"image_id" gorm:"column:image_id"`
+	ServedAt time.Time `json:"served_at" gorm:"column:served_at"`
+}
+
+func (*ImageServeHistoryModel) TableName() string {
+	return "image_serve_history"
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// 配额作用范围
+const (
+	QuotaScopeDirectory = "directory"
+	QuotaScopeUser      = "user"
+)
+
+// 目录或用户的配额，0 表示不限制；用户配额的 Target 为用户 ID
+type QuotaModel struct {
+	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID  uint64    `json:"tenant_id" gorm:"column:tenant_id"`
+	Scope     string    `json:"scope" gorm:"column:scope"`
+	Target    string    `json:"target" gorm:"column:target"`
+	MaxBytes  int64     `json:"max_bytes" gorm:"column:max_bytes"`
+	MaxImages int64     `json:"max_images" gorm:"column:max_images"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (*QuotaModel) TableName() string {
+	return "quota"
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// 分享类型
+const (
+	ShareTypeImage = "image"
+	ShareTypeAlbum = "album"
+	ShareTypeTag   = "tag"
+)
+
+type ShareModel struct {
+	ID           uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID     uint64    `json:"tenant_id" gorm:"column:tenant_id"`
+	CreatedBy    uint64    `json:"created_by" gorm:"column:created_by"`
+	Token        string    `json:"-" gorm:"column:token"`
+	TargetType   string    `json:"target_type" gorm:"column:target_type"`
+	TargetID     uint64    `json:"target_id" gorm:"column:target_id"`
+	Tags         string    `json:"tags" gorm:"column:tags"`
+	Directory    string    `json:"directory" gorm:"column:directory"`
+	PasswordHash string    `json:"-" gorm:"column:password_hash"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"column:expires_at"`
+	ViewCount    int64     `json:"view_count" gorm:"column:view_count"`
+	Revoked      bool      `json:"revoked" gorm:"column:revoked"`
+	CreatedAt    time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (*ShareModel) TableName() string {
+	return "share"
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+type TenantModel struct {
+	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	Name      string    `json:"name" gorm:"column:name"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (*TenantModel) TableName() string {
+	return "tenant"
+}
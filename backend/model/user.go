@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+type UserModel struct {
+	ID           uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID     uint64    `json:"tenant_id" gorm:"column:tenant_id"`
+	Username     string    `json:"username" gorm:"column:username"`
+	PasswordHash string    `json:"-" gorm:"column:password_hash"`
+	Role         string    `json:"role" gorm:"column:role"`
+	CreatedAt    time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+type UserSessionModel struct {
+	ID        uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	UserID    uint64    `json:"user_id" gorm:"column:user_id"`
+	TokenHash string    `json:"-" gorm:"column:token_hash"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"column:expires_at"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+type APIKeyModel struct {
+	ID         uint64     `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	UserID     uint64     `json:"user_id" gorm:"column:user_id"`
+	Name       string     `json:"name" gorm:"column:name"`
+	Prefix     string     `json:"prefix" gorm:"column:prefix"`
+	KeyHash    string     `json:"-" gorm:"column:key_hash"`
+	LastUsedAt *time.Time `json:"last_used_at" gorm:"column:last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"column:created_at"`
+}
+
+// 目录权限，配置了权限的目录只对授权用户可见
+type DirectoryPermissionModel struct {
+	ID         uint64    `json:"id" gorm:"column:id;primary_key;auto_increment"`
+	TenantID   uint64    `json:"tenant_id" gorm:"column:tenant_id"`
+	Directory  string    `json:"directory" gorm:"column:directory"`
+	UserID     uint64    `json:"user_id" gorm:"column:user_id"`
+	Permission string    `json:"permission" gorm:"column:permission"`
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (*UserModel) TableName() string {
+	return "user_account"
+}
+
+func (*UserSessionModel) TableName() string {
+	return "user_session"
+}
+
+func (*APIKeyModel) TableName() string {
+	return "api_key"
+}
+
+func (*DirectoryPermissionModel) TableName() string {
+	return "directory_permission"
+}
@@ -5,15 +5,16 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"io"
+	"io/fs"
 	"log"
 	"net/url"
 	"path/filepath"
+	"picture_storage/cache"
 	"picture_storage/config"
-	"strconv"
 	"time"
 
-	"github.com/kiririx/krutils/ut"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
@@ -21,17 +22,36 @@ import (
 var Client *MinioClient
 
 type MinioClient struct {
-	client *minio.Client
+	client       *minio.Client
+	urlExpiry    time.Duration // 预签名地址的有效期
+	publicBucket bool          // bucket 允许匿名读取时直接返回不带签名的地址
 }
 
-func (m *MinioClient) GetObjectURL(bucketName, objectName string) string {
-	presignedURL, err := m.client.PresignedGetObject(context.Background(), bucketName, objectName, time.Hour*24, make(url.Values))
-	if err != nil {
-		log.Fatalln(err)
+// 预签名地址缓存的 key 前缀
+const urlCachePrefix = "minio:url:"
+
+// 获取文件的访问地址
+// 公开 bucket 模式下直接拼接地址；否则返回预签名地址，并在临近过期前复用缓存
+func (m *MinioClient) GetObjectURL(bucketName, objectName string) (string, error) {
+	if m.publicBucket {
+		u := *m.client.EndpointURL()
+		u.Path = "/" + bucketName + "/" + objectName
+		return u.String(), nil
 	}
 
-	// return "http://" + m.client.EndpointURL().Host + "/" + bucketName + "/" + objectName
-	return presignedURL.String()
+	cacheKey := urlCachePrefix + bucketName + "/" + objectName
+	var cached string
+	if cache.Get(cacheKey, &cached) {
+		return cached, nil
+	}
+	presignedURL, err := m.client.PresignedGetObject(context.Background(), bucketName, objectName, m.urlExpiry, make(url.Values))
+	if err != nil {
+		return "", err
+	}
+	// 预留十分之一（最多一小时）的余量，避免返回的地址在客户端使用前过期
+	margin := min(m.urlExpiry/10, time.Hour)
+	cache.Set(cacheKey, presignedURL.String(), m.urlExpiry-margin)
+	return presignedURL.String(), nil
 }
 
 func (m *MinioClient) UploadFile(bucketName, originalFilename string, fileSize int64, fileContent io.Reader, contentType string) (string, int64, error) {
@@ -124,20 +144,60 @@ func (m *MinioClient) UploadFileBytes(bucketName, originalFilename string, fileS
 	return objectName, uploadInfo.Size, nil
 }
 
-func (m *MinioClient) GetDirectoryList() ([]minio.BucketInfo, error) {
+// 获取所有 bucket 的名称
+func (m *MinioClient) GetDirectoryList() ([]string, error) {
 	ctx := context.Background()
 
 	// 获取目录列表
-	objects, err := m.client.ListBuckets(ctx)
+	buckets, err := m.client.ListBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		names = append(names, bucket.Name)
+	}
+	return names, nil
+}
+
+func (m *MinioClient) GetFile(bucketName, objectName string) ([]byte, error) {
+	ctx := context.Background()
+	object, err := m.client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
+}
+
+// 打开存储中的文件，返回的对象支持 Seek，可用于 Range 请求
+func (m *MinioClient) OpenFile(bucketName, objectName string) (io.ReadSeekCloser, error) {
+	ctx := context.Background()
+	object, err := m.client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
 	if err != nil {
 		return nil, err
 	}
+	// GetObject 不会请求服务端，先 Stat 一次以便文件不存在时立即返回错误
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	return object, nil
+}
 
-	return objects, nil
+// 判断错误是否为文件或 bucket 不存在，其他存储实现用 fs.ErrNotExist 表示
+func IsNotFound(err error) bool {
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NoSuchBucket"
 }
 
 func (m *MinioClient) DeleteFile(bucketName, objectName string) error {
 	ctx := context.Background()
+	cache.Delete(urlCachePrefix + bucketName + "/" + objectName)
 	return m.client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
 }
 
@@ -152,16 +212,15 @@ func NewMinioClient(endpoint, accessKeyID, secretAccessKey string, useSSL bool)
 	}
 
 	return &MinioClient{
-		client: minioClient,
+		client:    minioClient,
+		urlExpiry: time.Hour * 24,
 	}
 }
 
 func InitMinioClient() {
 	// 初始化 MinIO 客户端
-	endpoint := ut.String().DefaultIfEmpty(config.H.Get("minio.endpoint"), "localhost:9000")
-	accessKeyID := ut.String().DefaultIfEmpty(config.H.Get("minio.accessKeyID"), "minioadmin")
-	secretAccessKey := ut.String().DefaultIfEmpty(config.H.Get("minio.secretAccessKey"), "minioadmin")
-	useSSL := ut.String().DefaultIfEmpty(config.H.Get("minio.useSSL"), "false")
-	useSSLBool, _ := strconv.ParseBool(useSSL)
-	Client = NewMinioClient(endpoint, accessKeyID, secretAccessKey, useSSLBool)
+	storage := config.C.Storage
+	Client = NewMinioClient(storage.Endpoint, storage.AccessKeyID, storage.SecretAccessKey, storage.UseSSL)
+	Client.urlExpiry = time.Duration(storage.URLExpiry) * time.Second
+	Client.publicBucket = storage.PublicBucket
 }
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"picture_storage/model"
+)
+
+// 用户角色
+const (
+	RoleViewer   = "viewer"   // 只能浏览
+	RoleUploader = "uploader" // 可以上传和编辑图片上的标签，不能删除图片或管理标签本身
+	RoleAdmin    = "admin"    // 全部权限
+)
+
+// 目录权限
+const (
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+)
+
+var (
+	ErrForbidden     = Errorf(CodeForbidden, "没有权限")
+	ErrImageNotFound = Errorf(CodeNotFound, "图片不存在")
+)
+
+// 操作者身份，UserID 为 0 表示匿名访问；所有数据都限定在 TenantID 租户内
+type Actor struct {
+	TenantID uint64
+	UserID   uint64
+	Role     string
+}
+
+// 匿名访问者只能看到默认租户
+func AnonymousActor() Actor {
+	return Actor{TenantID: DefaultTenantID}
+}
+
+func UserActor(user model.UserModel) Actor {
+	return Actor{TenantID: user.TenantID, UserID: user.ID, Role: user.Role}
+}
+
+func (actor Actor) IsAdmin() bool {
+	return actor.Role == RoleAdmin
+}
+
+// 默认租户的管理员负责管理其他租户
+func (actor Actor) IsInstanceAdmin() bool {
+	return actor.IsAdmin() && actor.TenantID == DefaultTenantID
+}
+
+func (actor Actor) CanUpload() bool {
+	return actor.Role == RoleUploader || actor.Role == RoleAdmin
+}
+
+func validateRole(role string) error {
+	switch role {
+	case RoleViewer, RoleUploader, RoleAdmin:
+		return nil
+	}
+	return Errorf(CodeInvalidArgument, "未知的角色 '%s'", role)
+}
+
+// 返回以指定身份操作的服务，所有查询和修改都按该身份过滤
+func (service *ImageService) As(actor Actor) *ImageService {
+	scoped := *service
+	scoped.actor = actor
+	return &scoped
+}
+
+func (service *ImageService) requireAdmin() error {
+	if !service.actor.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (service *ImageService) requireUpload() error {
+	if !service.actor.CanUpload() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// 当前身份可见的图片：管理员不受目录权限限制，其他身份只能看到未配置权限的公开目录和已授权的目录
+func (service *ImageService) visibleImages() ImageFilter {
+	filter := ImageFilter{TenantID: service.actor.TenantID}
+	if !service.actor.IsAdmin() {
+		filter.Viewer = &DirectoryViewer{UserID: service.actor.UserID}
+	}
+	return filter
+}
+
+// 检查当前身份能否访问目录
+func (service *ImageService) checkDirectory(directory string, needWrite bool) error {
+	if service.actor.IsAdmin() {
+		return nil
+	}
+	permissions, err := service.store.Images().DirectoryPermissions(service.actor.TenantID, directory)
+	if err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		return nil
+	}
+	for _, permission := range permissions {
+		if permission.UserID != service.actor.UserID {
+			continue
+		}
+		if !needWrite || permission.Permission == PermissionWrite {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// 检查图片是否都存在、属于当前租户且位于可访问的目录中
+func (service *ImageService) checkImages(store Store, imageIDs []uint64, needWrite bool) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	distinct := make(map[uint64]struct{})
+	for _, id := range imageIDs {
+		distinct[id] = struct{}{}
+	}
+	images, err := store.Images().FindByIDs(service.actor.TenantID, imageIDs)
+	if err != nil {
+		return err
+	}
+	// 不存在和属于其他租户的图片都按不存在处理，不暴露其他租户的图片 ID
+	if len(images) != len(distinct) {
+		return ErrImageNotFound
+	}
+	checked := make(map[string]bool)
+	for _, image := range images {
+		if checked[image.Directory] {
+			continue
+		}
+		if err := service.checkDirectory(image.Directory, needWrite); err != nil {
+			return err
+		}
+		checked[image.Directory] = true
+	}
+	return nil
+}
+
+// 获取目录权限配置
+func (service *ImageService) GetDirectoryPermissions(directory string) ([]model.DirectoryPermissionModel, error) {
+	if err := service.requireAdmin(); err != nil {
+		return nil, err
+	}
+	return service.store.Images().DirectoryPermissions(service.actor.TenantID, directory)
+}
+
+// 设置用户对目录的权限，permission 为空时移除授权
+func (service *ImageService) SetDirectoryPermission(directory string, userID uint64, permission string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+	if permission != "" && permission != PermissionRead && permission != PermissionWrite {
+		return Errorf(CodeInvalidArgument, "未知的权限 '%s'", permission)
+	}
+
+	err := service.store.Transaction(func(store Store) error {
+		if err := store.Images().DeleteDirectoryPermission(service.actor.TenantID, directory, userID); err != nil {
+			return err
+		}
+		if permission == "" {
+			return nil
+		}
+		if _, err := store.Users().FindByID(service.actor.TenantID, userID); err != nil {
+			return err
+		}
+		return store.Images().CreateDirectoryPermission(&model.DirectoryPermissionModel{
+			TenantID:   service.actor.TenantID,
+			Directory:  directory,
+			UserID:     userID,
+			Permission: permission,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"picture_storage/model"
+
+	"gorm.io/gorm"
+)
+
+type AlbumService struct {
+	imageService *ImageService
+}
+
+// 权限检查和图片访问复用 imageService
+func NewAlbumService(imageService *ImageService) *AlbumService {
+	return &AlbumService{
+		imageService: imageService,
+	}
+}
+
+// 返回以指定身份操作的服务
+func (service *AlbumService) As(actor Actor) *AlbumService {
+	return &AlbumService{
+		imageService: service.imageService.As(actor),
+	}
+}
+
+type AlbumItem struct {
+	model.AlbumModel
+	ImageCount int64 `json:"image_count"`
+	// 封面图片，未设置封面时取相册中的第一张
+	Cover *model.ImageModel `json:"-"`
+}
+
+func (service *AlbumService) tenantID() uint64 {
+	return service.imageService.actor.TenantID
+}
+
+func (service *AlbumService) store() Store {
+	return service.imageService.store
+}
+
+// 相册列表，包含图片数量和封面
+func (service *AlbumService) GetAlbums() ([]AlbumItem, error) {
+	albums, err := service.store().Albums().List(service.tenantID())
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]AlbumItem, 0, len(albums))
+	for _, album := range albums {
+		item := AlbumItem{AlbumModel: album}
+		item.ImageCount, err = service.store().Albums().ImageCount(album.ID)
+		if err != nil {
+			return nil, err
+		}
+		cover, err := service.albumCover(album)
+		if err != nil {
+			return nil, err
+		}
+		item.Cover = cover
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (service *AlbumService) albumCover(album model.AlbumModel) (*model.ImageModel, error) {
+	coverID := album.CoverImageID
+	if coverID == 0 {
+		first, err := service.store().Albums().FirstImage(album.ID)
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		coverID = first.ImageID
+	}
+
+	// 封面不可见时当作没有封面
+	filter := service.imageService.visibleImages()
+	filter.IDs = []uint64{coverID}
+	covers, err := service.store().Images().Find(filter)
+	if err != nil || len(covers) == 0 {
+		return nil, err
+	}
+	return &covers[0], nil
+}
+
+func (service *AlbumService) GetAlbum(albumID uint64) (model.AlbumModel, error) {
+	return service.store().Albums().FindByID(service.tenantID(), albumID)
+}
+
+// 创建相册
+func (service *AlbumService) CreateAlbum(title, description string, coverImageID uint64) (uint64, error) {
+	if err := service.imageService.requireUpload(); err != nil {
+		return 0, err
+	}
+	if err := service.checkCover(0, coverImageID); err != nil {
+		return 0, err
+	}
+	album := &model.AlbumModel{
+		TenantID:     service.tenantID(),
+		Title:        title,
+		Description:  description,
+		CoverImageID: coverImageID,
+		CreatedAt:    service.imageService.clock.Now(),
+	}
+	album.UpdatedAt = album.CreatedAt
+	if err := service.store().Albums().Create(album); err != nil {
+		return 0, err
+	}
+	// 封面图片自动加入相册
+	if coverImageID != 0 {
+		if err := service.AddAlbumImages(album.ID, []uint64{coverImageID}); err != nil {
+			return 0, err
+		}
+	}
+	return album.ID, nil
+}
+
+// 更新相册信息
+func (service *AlbumService) UpdateAlbum(albumID uint64, title, description string, coverImageID uint64) error {
+	if err := service.imageService.requireUpload(); err != nil {
+		return err
+	}
+	album, err := service.GetAlbum(albumID)
+	if err != nil {
+		return err
+	}
+	if err := service.checkCover(albumID, coverImageID); err != nil {
+		return err
+	}
+	album.Title = title
+	album.Description = description
+	album.CoverImageID = coverImageID
+	album.UpdatedAt = service.imageService.clock.Now()
+	return service.store().Albums().Update(&album)
+}
+
+// 封面必须是已存在的图片；相册已存在时还必须是相册中的图片
+func (service *AlbumService) checkCover(albumID, coverImageID uint64) error {
+	if coverImageID == 0 {
+		return nil
+	}
+	images, err := service.store().Images().FindByIDs(service.tenantID(), []uint64{coverImageID})
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return Errorf(CodeNotFound, "封面图片 %d 不存在", coverImageID)
+	}
+	if albumID == 0 {
+		return nil
+	}
+	_, err = service.store().Albums().FindImage(albumID, coverImageID)
+	if err == gorm.ErrRecordNotFound {
+		return Errorf(CodeInvalidArgument, "封面图片 %d 不在相册中", coverImageID)
+	}
+	return err
+}
+
+// 删除相册，不删除图片
+func (service *AlbumService) DeleteAlbum(albumID uint64) error {
+	if err := service.imageService.requireUpload(); err != nil {
+		return err
+	}
+	if _, err := service.GetAlbum(albumID); err != nil {
+		return err
+	}
+	return service.store().Transaction(func(store Store) error {
+		return store.Albums().Delete(albumID)
+	})
+}
+
+// 相册中的图片，按排序位置返回
+func (service *AlbumService) GetAlbumImages(albumID uint64, page model.Pagination) ([]model.ImageModel, int64, error) {
+	filter := service.imageService.visibleImages()
+	filter.AlbumID = albumID
+	return service.store().Images().List(filter, page)
+}
+
+// 添加图片到相册末尾，已在相册中的图片跳过
+func (service *AlbumService) AddAlbumImages(albumID uint64, imageIDs []uint64) error {
+	if err := service.imageService.requireUpload(); err != nil {
+		return err
+	}
+	if _, err := service.GetAlbum(albumID); err != nil {
+		return err
+	}
+
+	return service.store().Transaction(func(store Store) error {
+		albumImages, err := store.Albums().Images(albumID)
+		if err != nil {
+			return err
+		}
+		position := 0
+		existing := make(map[uint64]bool)
+		for _, albumImage := range albumImages {
+			existing[albumImage.ImageID] = true
+			position = max(position, albumImage.Position+1)
+		}
+
+		for _, imageID := range imageIDs {
+			images, err := store.Images().FindByIDs(service.tenantID(), []uint64{imageID})
+			if err != nil {
+				return err
+			}
+			if len(images) == 0 {
+				return Errorf(CodeNotFound, "图片 %d 不存在", imageID)
+			}
+			if err := service.imageService.checkImages(store, []uint64{imageID}, false); err != nil {
+				return err
+			}
+			if existing[imageID] {
+				continue
+			}
+
+			albumImage := &model.AlbumImageModel{
+				AlbumID:   albumID,
+				ImageID:   imageID,
+				Position:  position,
+				CreatedAt: service.imageService.clock.Now(),
+			}
+			if err := store.Albums().AddImage(albumImage); err != nil {
+				return err
+			}
+			existing[imageID] = true
+			position++
+		}
+		return nil
+	})
+}
+
+// 从相册移除图片，移除的是封面时清空封面
+func (service *AlbumService) RemoveAlbumImages(albumID uint64, imageIDs []uint64) error {
+	if err := service.imageService.requireUpload(); err != nil {
+		return err
+	}
+	if _, err := service.GetAlbum(albumID); err != nil {
+		return err
+	}
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	return service.store().Transaction(func(store Store) error {
+		return store.Albums().RemoveImages(albumID, imageIDs)
+	})
+}
+
+// 调整相册图片顺序，imageIDs 中的图片排在最前，其余图片保持原有相对顺序
+func (service *AlbumService) ReorderAlbumImages(albumID uint64, imageIDs []uint64) error {
+	if err := service.imageService.requireUpload(); err != nil {
+		return err
+	}
+	if _, err := service.GetAlbum(albumID); err != nil {
+		return err
+	}
+	return service.store().Transaction(func(store Store) error {
+		albumImages, err := store.Albums().Images(albumID)
+		if err != nil {
+			return err
+		}
+
+		albumImageMap := make(map[uint64]model.AlbumImageModel)
+		for _, albumImage := range albumImages {
+			albumImageMap[albumImage.ImageID] = albumImage
+		}
+
+		ordered := make([]model.AlbumImageModel, 0, len(albumImages))
+		seen := make(map[uint64]bool)
+		for _, imageID := range imageIDs {
+			albumImage, ok := albumImageMap[imageID]
+			if !ok {
+				return Errorf(CodeInvalidArgument, "图片 %d 不在相册中", imageID)
+			}
+			if seen[imageID] {
+				continue
+			}
+			seen[imageID] = true
+			ordered = append(ordered, albumImage)
+		}
+		for _, albumImage := range albumImages {
+			if !seen[albumImage.ImageID] {
+				ordered = append(ordered, albumImage)
+			}
+		}
+
+		for position, albumImage := range ordered {
+			if albumImage.Position == position {
+				continue
+			}
+			if err := store.Albums().SetPosition(albumImage.ID, position); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"picture_storage/config"
+	"picture_storage/db"
+	"picture_storage/model"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 会话有效期
+func SessionExpiry() time.Duration {
+	return time.Duration(config.C.Auth.SessionExpiry) * time.Second
+}
+
+// API Key 前缀，用于区分会话令牌
+const apiKeyPrefix = "ps_"
+
+var (
+	ErrUnauthorized       = Errorf(CodeUnauthorized, "未登录或登录已过期")
+	ErrInvalidCredentials = Errorf(CodeInvalidCredentials, "用户名或密码错误")
+	ErrRegisterClosed     = Errorf(CodeRegisterClosed, "已存在用户，请由已登录用户创建账号")
+)
+
+type AuthService struct {
+	actor Actor
+	clock Clock
+}
+
+// 会话过期和 API Key 使用时间按 clock 计算
+func NewAuthService(clock Clock) *AuthService {
+	return &AuthService{clock: clock}
+}
+
+// 返回以指定身份操作的服务，用户管理只允许租户管理员在自己的租户内进行
+func (service *AuthService) As(actor Actor) *AuthService {
+	return &AuthService{actor: actor, clock: service.clock}
+}
+
+func (service *AuthService) requireAdmin() error {
+	if !service.actor.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRandomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func validateCredentials(username, password string) error {
+	if strings.TrimSpace(username) == "" || len(username) > 64 {
+		return Errorf(CodeInvalidArgument, "用户名不合法")
+	}
+	if len(password) < 8 {
+		return Errorf(CodeInvalidArgument, "密码至少 8 位")
+	}
+	return nil
+}
+
+// 是否还没有任何用户，此时允许匿名注册第一个账号
+func (service *AuthService) NeedsBootstrap() (bool, error) {
+	var count int64
+	if err := db.DB.Model(&model.UserModel{}).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// 校验并构造用户，密码以 bcrypt 保存
+func newUser(username, password, role string) (model.UserModel, error) {
+	if err := validateCredentials(username, password); err != nil {
+		return model.UserModel{}, err
+	}
+	if err := validateRole(role); err != nil {
+		return model.UserModel{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return model.UserModel{}, err
+	}
+	return model.UserModel{
+		Username:     username,
+		PasswordHash: string(hash),
+		Role:         role,
+	}, nil
+}
+
+// 用户名全局唯一，登录时不需要指定租户
+func createUser(tx *gorm.DB, user *model.UserModel) error {
+	var count int64
+	if err := tx.Model(&model.UserModel{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return Errorf(CodeAlreadyExists, "用户 '%s' 已存在", user.Username)
+	}
+	return tx.Create(user).Error
+}
+
+// 管理员在自己的租户下创建用户
+func (service *AuthService) CreateUser(username, password, role string) (model.UserModel, error) {
+	if err := service.requireAdmin(); err != nil {
+		return model.UserModel{}, err
+	}
+	user, err := newUser(username, password, role)
+	if err != nil {
+		return user, err
+	}
+	user.TenantID = service.actor.TenantID
+	if err := createUser(db.DB, &user); err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// 创建第一个管理员：先锁住默认租户再检查用户数，避免并发注册出多个初始管理员
+func (service *AuthService) Bootstrap(username, password string) (model.UserModel, error) {
+	user, err := newUser(username, password, RoleAdmin)
+	if err != nil {
+		return user, err
+	}
+	user.TenantID = DefaultTenantID
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return user, tx.Error
+	}
+	var tenant model.TenantModel
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", DefaultTenantID).First(&tenant).Error; err != nil {
+		tx.Rollback()
+		return user, err
+	}
+	var count int64
+	if err := tx.Model(&model.UserModel{}).Count(&count).Error; err != nil {
+		tx.Rollback()
+		return user, err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return user, ErrRegisterClosed
+	}
+	if err := createUser(tx, &user); err != nil {
+		tx.Rollback()
+		return user, err
+	}
+	return user, tx.Commit().Error
+}
+
+// 登录，返回会话令牌
+func (service *AuthService) Login(username, password string) (string, time.Time, error) {
+	var user model.UserModel
+	err := db.DB.Where("username = ?", username).First(&user).Error
+	if err == gorm.ErrRecordNotFound {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	// 清理过期会话
+	if err := db.DB.Where("expires_at < ?", service.clock.Now()).Delete(&model.UserSessionModel{}).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	token, err := newRandomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	session := model.UserSessionModel{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: service.clock.Now().Add(SessionExpiry()),
+	}
+	if err := db.DB.Create(&session).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return token, session.ExpiresAt, nil
+}
+
+// 退出登录
+func (service *AuthService) Logout(token string) error {
+	return db.DB.Where("token_hash = ?", hashToken(token)).Delete(&model.UserSessionModel{}).Error
+}
+
+// 根据会话令牌或 API Key 获取用户
+func (service *AuthService) Authenticate(token string) (model.UserModel, error) {
+	var user model.UserModel
+	if token == "" {
+		return user, ErrUnauthorized
+	}
+
+	var userID uint64
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		var apiKey model.APIKeyModel
+		err := db.DB.Where("key_hash = ?", hashToken(token)).First(&apiKey).Error
+		if err == gorm.ErrRecordNotFound {
+			return user, ErrUnauthorized
+		}
+		if err != nil {
+			return user, err
+		}
+		if err := db.DB.Model(&apiKey).Update("last_used_at", service.clock.Now()).Error; err != nil {
+			return user, err
+		}
+		userID = apiKey.UserID
+	} else {
+		var session model.UserSessionModel
+		err := db.DB.Where("token_hash = ? AND expires_at > ?", hashToken(token), service.clock.Now()).First(&session).Error
+		if err == gorm.ErrRecordNotFound {
+			return user, ErrUnauthorized
+		}
+		if err != nil {
+			return user, err
+		}
+		userID = session.UserID
+	}
+
+	err := db.DB.Where("id = ?", userID).First(&user).Error
+	if err == gorm.ErrRecordNotFound {
+		return user, ErrUnauthorized
+	}
+	return user, err
+}
+
+// 修改密码，并使该用户的其他会话失效，currentToken 对应的会话保留
+func (service *AuthService) ChangePassword(userID uint64, currentToken, oldPassword, newPassword string) error {
+	var user model.UserModel
+	if err := db.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)) != nil {
+		return ErrInvalidCredentials
+	}
+	if err := validateCredentials(user.Username, newPassword); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := tx.Model(&user).Update("password_hash", string(hash)).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("user_id = ? AND token_hash <> ?", user.ID, hashToken(currentToken)).Delete(&model.UserSessionModel{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// 创建 API Key，明文只在创建时返回一次
+func (service *AuthService) CreateAPIKey(userID uint64, name string) (model.APIKeyModel, string, error) {
+	random, err := newRandomToken(32)
+	if err != nil {
+		return model.APIKeyModel{}, "", err
+	}
+	key := apiKeyPrefix + random
+	apiKey := model.APIKeyModel{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  key[:len(apiKeyPrefix)+6],
+		KeyHash: hashToken(key),
+	}
+	if err := db.DB.Create(&apiKey).Error; err != nil {
+		return apiKey, "", err
+	}
+	return apiKey, key, nil
+}
+
+// 用户的 API Key 列表
+func (service *AuthService) GetAPIKeys(userID uint64) ([]model.APIKeyModel, error) {
+	apiKeys := make([]model.APIKeyModel, 0)
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&apiKeys).Error; err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+// 删除 API Key
+func (service *AuthService) DeleteAPIKey(userID, apiKeyID uint64) error {
+	result := db.DB.Where("id = ? AND user_id = ?", apiKeyID, userID).Delete(&model.APIKeyModel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Errorf(CodeNotFound, "API Key 不存在")
+	}
+	return nil
+}
+
+// 租户下的用户列表
+func (service *AuthService) GetUsers() ([]model.UserModel, error) {
+	if err := service.requireAdmin(); err != nil {
+		return nil, err
+	}
+	users := make([]model.UserModel, 0)
+	if err := db.DB.Where("tenant_id = ?", service.actor.TenantID).Order("id ASC").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// 修改租户内用户的角色，不允许移除租户的最后一个管理员
+func (service *AuthService) SetUserRole(userID uint64, role string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+	if err := validateRole(role); err != nil {
+		return err
+	}
+	tenantID := service.actor.TenantID
+
+	var user model.UserModel
+	if err := db.DB.Where("id = ? AND tenant_id = ?", userID, tenantID).First(&user).Error; err != nil {
+		return err
+	}
+	if user.Role == RoleAdmin && role != RoleAdmin {
+		var count int64
+		if err := db.DB.Model(&model.UserModel{}).Where("tenant_id = ? AND role = ?", tenantID, RoleAdmin).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return Errorf(CodeConflict, "至少需要保留一个管理员")
+		}
+	}
+	return db.DB.Model(&user).Update("role", role).Error
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"math"
+	"picture_storage/model"
+
+	"github.com/disintegration/imaging"
+)
+
+// 自动标签规则
+const (
+	AutoTagRuleOrientation  = "orientation"
+	AutoTagRuleResolution   = "resolution"
+	AutoTagRuleAnimated     = "animated"
+	AutoTagRuleTransparency = "transparency"
+	AutoTagRuleColor        = "color"
+	AutoTagRuleFormat       = "format"
+)
+
+var AutoTagRules = []string{
+	AutoTagRuleOrientation,
+	AutoTagRuleResolution,
+	AutoTagRuleAnimated,
+	AutoTagRuleTransparency,
+	AutoTagRuleColor,
+	AutoTagRuleFormat,
+}
+
+// 图片属性
+type imageProperties struct {
+	Width           int
+	Height          int
+	Format          string
+	Animated        bool
+	HasTransparency bool
+	DominantColor   string
+}
+
+// 分析图片属性
+func analyzeImage(data []byte) (imageProperties, error) {
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return imageProperties{}, err
+	}
+	return imageAttributes(img, format, data), nil
+}
+
+// 根据已解码的图片计算属性，data 用于判断是否为动图
+func imageAttributes(img image.Image, format string, data []byte) imageProperties {
+	bounds := img.Bounds()
+	props := imageProperties{
+		Width:         bounds.Dx(),
+		Height:        bounds.Dy(),
+		Format:        format,
+		Animated:      isAnimated(data, format),
+		DominantColor: dominantColorName(img),
+	}
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		props.HasTransparency = !opaque.Opaque()
+	}
+	return props
+}
+
+// 判断是否为动图，支持 GIF 和 APNG
+func isAnimated(data []byte, format string) bool {
+	switch format {
+	case "gif":
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		return err == nil && len(g.Image) > 1
+	case "png":
+		// APNG 在第一个 IDAT 之前带有 acTL 块
+		idat := bytes.Index(data, []byte("IDAT"))
+		actl := bytes.Index(data, []byte("acTL"))
+		return actl >= 0 && (idat < 0 || actl < idat)
+	}
+	return false
+}
+
+// 计算主色调名称：缩小后按色相分桶统计，取像素最多的颜色
+func dominantColorName(img image.Image) string {
+	small := imaging.Resize(img, 32, 0, imaging.Box)
+	counts := make(map[string]int)
+	bounds := small.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := small.NRGBAAt(x, y)
+			// 忽略透明像素
+			if c.A < 128 {
+				continue
+			}
+			counts[colorName(c.R, c.G, c.B)]++
+		}
+	}
+
+	name, best := "", 0
+	for _, candidate := range colorNames {
+		if counts[candidate] > best {
+			name, best = candidate, counts[candidate]
+		}
+	}
+	return name
+}
+
+var colorNames = []string{"red", "orange", "yellow", "green", "cyan", "blue", "purple", "pink", "brown", "black", "white", "gray"}
+
+// 将 RGB 映射到颜色名称
+func colorName(r, g, b uint8) string {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	maxC := math.Max(rf, math.Max(gf, bf))
+	minC := math.Min(rf, math.Min(gf, bf))
+	v := maxC
+	delta := maxC - minC
+	s := 0.0
+	if maxC > 0 {
+		s = delta / maxC
+	}
+
+	if v < 0.2 {
+		return "black"
+	}
+	if s < 0.15 {
+		if v > 0.85 {
+			return "white"
+		}
+		return "gray"
+	}
+
+	var h float64
+	switch maxC {
+	case rf:
+		h = math.Mod((gf-bf)/delta, 6)
+	case gf:
+		h = (bf-rf)/delta + 2
+	default:
+		h = (rf-gf)/delta + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+
+	switch {
+	case h < 15 || h >= 340:
+		return "red"
+	case h < 40:
+		if v < 0.6 {
+			return "brown"
+		}
+		return "orange"
+	case h < 65:
+		return "yellow"
+	case h < 165:
+		return "green"
+	case h < 195:
+		return "cyan"
+	case h < 255:
+		return "blue"
+	case h < 290:
+		return "purple"
+	default:
+		return "pink"
+	}
+}
+
+// 根据启用的规则生成自动标签
+func autoTagsFor(props imageProperties, enabled map[string]bool) []string {
+	tags := make([]string, 0)
+	if enabled[AutoTagRuleOrientation] {
+		switch {
+		case props.Width > props.Height:
+			tags = append(tags, "orientation:landscape")
+		case props.Width < props.Height:
+			tags = append(tags, "orientation:portrait")
+		default:
+			tags = append(tags, "orientation:square")
+		}
+	}
+	if enabled[AutoTagRuleResolution] {
+		longSide := max(props.Width, props.Height)
+		shortSide := min(props.Width, props.Height)
+		switch {
+		case longSide >= 3840 && shortSide >= 2160:
+			tags = append(tags, "resolution:4k")
+		case longSide >= 1280 && shortSide >= 720:
+			tags = append(tags, "resolution:hd")
+		}
+	}
+	if enabled[AutoTagRuleAnimated] && props.Animated {
+		tags = append(tags, "animated")
+	}
+	if enabled[AutoTagRuleTransparency] && props.HasTransparency {
+		tags = append(tags, "transparent")
+	}
+	if enabled[AutoTagRuleColor] && props.DominantColor != "" {
+		tags = append(tags, "color:"+props.DominantColor)
+	}
+	if enabled[AutoTagRuleFormat] && props.Format != "" {
+		tags = append(tags, "format:"+props.Format)
+	}
+	return tags
+}
+
+// 获取目录的自动标签规则开关，未配置的规则默认启用
+func (service *ImageService) GetAutoTagRules(directory string) (map[string]bool, error) {
+	rules := make(map[string]bool)
+	for _, rule := range AutoTagRules {
+		rules[rule] = true
+	}
+
+	settings, err := service.store.Tags().AutoTagSettings(service.actor.TenantID, directory)
+	if err != nil {
+		return nil, err
+	}
+	for _, setting := range settings {
+		if _, ok := rules[setting.Rule]; ok {
+			rules[setting.Rule] = setting.Enabled
+		}
+	}
+	return rules, nil
+}
+
+// 设置目录的自动标签规则开关
+func (service *ImageService) SetAutoTagRules(directory string, rules map[string]bool) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
+	for rule := range rules {
+		if !isAutoTagRule(rule) {
+			return Errorf(CodeInvalidArgument, "未知的自动标签规则 '%s'", rule)
+		}
+	}
+
+	return service.store.Transaction(func(store Store) error {
+		settings, err := store.Tags().AutoTagSettings(service.actor.TenantID, directory)
+		if err != nil {
+			return err
+		}
+		for rule, enabled := range rules {
+			setting := model.DirectoryAutoTagModel{
+				TenantID:  service.actor.TenantID,
+				Directory: directory,
+				Rule:      rule,
+			}
+			for _, existing := range settings {
+				if existing.Rule == rule {
+					setting = existing
+				}
+			}
+			setting.Enabled = enabled
+			if err := store.Tags().SaveAutoTagSetting(&setting); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func isAutoTagRule(rule string) bool {
+	for _, r := range AutoTagRules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// 为图片写入自动标签，先清除旧的系统标签
+func (service *ImageService) applyAutoTags(store Store, image *model.ImageModel, props imageProperties) error {
+	rules, err := service.GetAutoTagRules(image.Directory)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Tags().DeleteImageTags(image.ID, true); err != nil {
+		return err
+	}
+
+	for _, tagName := range autoTagsFor(props, rules) {
+		tag, err := service.findOrCreateTag(store, tagName)
+		if err != nil {
+			return err
+		}
+		if err := service.addImageTag(store, image.ID, tag.ID, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 重新计算图片的自动标签，imageIDs 为空时处理整个目录
+func (service *ImageService) RecalculateAutoTags(directory string, imageIDs []uint64) (int, error) {
+	if err := service.requireUpload(); err != nil {
+		return 0, err
+	}
+
+	filter := ImageFilter{TenantID: service.actor.TenantID}
+	if len(imageIDs) > 0 {
+		if err := service.checkImages(service.store, imageIDs, true); err != nil {
+			return 0, err
+		}
+		filter.IDs = imageIDs
+	} else {
+		if err := service.checkDirectory(directory, true); err != nil {
+			return 0, err
+		}
+		filter.Directory = directory
+	}
+	images, err := service.store.Images().Find(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range images {
+		image := &images[i]
+		bucket, object := service.imageObject(*image, ImageVariantOriginal)
+		data, err := service.storage.GetFile(bucket, object)
+		if err != nil {
+			return i, err
+		}
+
+		props, err := analyzeImage(data)
+		if err != nil {
+			return i, err
+		}
+		err = service.store.Transaction(func(store Store) error {
+			return service.applyAutoTags(store, image, props)
+		})
+		if err != nil {
+			return i, err
+		}
+		service.invalidateTags()
+	}
+	return len(images), nil
+}
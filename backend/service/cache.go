@@ -0,0 +1,26 @@
+package service
+
+import (
+	"fmt"
+	"picture_storage/cache"
+)
+
+// 所有租户的 bucket 列表，上传可能新建 bucket，上传后失效
+const directoryCacheKey = "directories"
+
+// 标签相关的缓存按租户分组，标签或图片变化时整组失效
+func (service *ImageService) tagCacheKey(name string) string {
+	return fmt.Sprintf("tags:%d:%s", service.actor.TenantID, name)
+}
+
+// 结果依赖目录权限的缓存，需要再按可见范围区分
+func (service *ImageService) scopedTagCacheKey(name string) string {
+	if service.actor.IsAdmin() {
+		return service.tagCacheKey(name + ":admin")
+	}
+	return service.tagCacheKey(fmt.Sprintf("%s:user:%d", name, service.actor.UserID))
+}
+
+func (service *ImageService) invalidateTags() {
+	cache.DeletePrefix(fmt.Sprintf("tags:%d:", service.actor.TenantID))
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 错误码，客户端应按错误码区分失败原因，而不是错误信息的文字
+const (
+	CodeInvalidArgument      = "INVALID_ARGUMENT"
+	CodeUnauthorized         = "UNAUTHORIZED"
+	CodeInvalidCredentials   = "INVALID_CREDENTIALS"
+	CodeForbidden            = "FORBIDDEN"
+	CodeRegisterClosed       = "REGISTER_CLOSED"
+	CodeNotFound             = "NOT_FOUND"
+	CodeAlreadyExists        = "ALREADY_EXISTS"
+	CodeTagExists            = "TAG_EXISTS"
+	CodeConflict             = "CONFLICT"
+	CodeShareExpired         = "SHARE_EXPIRED"
+	CodeSharePasswordInvalid = "SHARE_PASSWORD_INVALID"
+	CodeFileTooLarge         = "FILE_TOO_LARGE"
+	CodeQuotaExceeded        = "QUOTA_EXCEEDED"
+	CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	CodeInvalidImage         = "INVALID_IMAGE"
+	CodeInternal             = "INTERNAL_ERROR"
+)
+
+// 错误信息支持的语言
+const (
+	LangZh = "zh"
+	LangEn = "en"
+)
+
+var (
+	ErrInvalidArgument = Errorf(CodeInvalidArgument, "参数错误")
+	ErrNotFound        = Errorf(CodeNotFound, "记录不存在")
+	ErrNoRoute         = Errorf(CodeNotFound, "接口不存在")
+	ErrInternal        = Errorf(CodeInternal, "服务器内部错误")
+)
+
+// 带错误码的业务错误；Format 是中文模板，同时作为查找英文翻译的键
+type Error struct {
+	Code   string
+	Format string
+	Args   []any
+}
+
+func Errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Format: format, Args: args}
+}
+
+func (e *Error) Error() string {
+	return e.Message(LangZh)
+}
+
+func (e *Error) Message(lang string) string {
+	return localize(lang, e.Format, e.Args)
+}
+
+// 按语言格式化错误信息，没有翻译时使用中文
+func localize(lang, format string, args []any) string {
+	if lang == LangEn {
+		if translated, ok := messagesEn[format]; ok {
+			format = translated
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// 返回错误的错误码和指定语言的信息；数据库和存储等未知错误不暴露细节，返回 CodeInternal
+func ErrorDetail(err error, lang string) (string, string) {
+	var serviceErr *Error
+	var quotaErr *QuotaError
+	var imageErr *ImageError
+	switch {
+	case errors.As(err, &serviceErr):
+		return serviceErr.Code, serviceErr.Message(lang)
+	case errors.As(err, &quotaErr):
+		return quotaErr.ErrorCode(), quotaErr.Message(lang)
+	case errors.As(err, &imageErr):
+		return CodeInvalidImage, imageErr.Message(lang)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound.Code, ErrNotFound.Message(lang)
+	default:
+		return ErrInternal.Code, ErrInternal.Message(lang)
+	}
+}
+
+// 从 Accept-Language 中选出权重最高的支持语言，都不支持时使用中文
+func ParseLanguage(header string) string {
+	lang, best := LangZh, -1.0
+	for _, item := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if _, err := fmt.Sscanf(value, "%g", &q); err != nil {
+				continue
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if (primary == LangZh || primary == LangEn) && q > best {
+			lang, best = primary, q
+		}
+	}
+	return lang
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// 图片内容校验的错误码
+const (
+	ImageCodeNotImage          = "not_image"
+	ImageCodeExtensionMismatch = "extension_mismatch"
+	ImageCodeTooManyPixels     = "too_many_pixels"
+)
+
+// 文件内容不是合法图片时返回的错误，Code 是更细的原因，对外的错误码是 CodeInvalidImage
+type ImageError struct {
+	Code   string
+	Format string
+	Args   []any
+}
+
+func (e *ImageError) Error() string {
+	return e.Message(LangZh)
+}
+
+func (e *ImageError) Message(lang string) string {
+	return localize(lang, e.Format, e.Args)
+}
+
+// 文件头魔数对应的图片格式
+var imageSignatures = []struct {
+	format string
+	offset int
+	magic  []byte
+}{
+	{"jpeg", 0, []byte{0xFF, 0xD8, 0xFF}},
+	{"png", 0, []byte("\x89PNG\r\n\x1a\n")},
+	{"gif", 0, []byte("GIF87a")},
+	{"gif", 0, []byte("GIF89a")},
+	{"webp", 8, []byte("WEBPVP8")},
+	{"bmp", 0, []byte("BM")},
+	{"tiff", 0, []byte("II*\x00")},
+	{"tiff", 0, []byte("MM\x00*")},
+}
+
+// 各格式允许的扩展名
+var imageFormatExtensions = map[string][]string{
+	"jpeg": {"jpg", "jpeg", "jpe", "jfif"},
+	"png":  {"png", "apng"},
+	"gif":  {"gif"},
+	"webp": {"webp"},
+	"bmp":  {"bmp"},
+	"tiff": {"tif", "tiff"},
+}
+
+var imageFormatMimeTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+}
+
+// 根据文件头识别图片格式，不是支持的图片时返回空字符串
+func sniffImageFormat(head []byte) string {
+	for _, signature := range imageSignatures {
+		if signature.format == "webp" && !bytes.HasPrefix(head, []byte("RIFF")) {
+			continue
+		}
+		if len(head) >= signature.offset+len(signature.magic) &&
+			bytes.Equal(head[signature.offset:signature.offset+len(signature.magic)], signature.magic) {
+			return signature.format
+		}
+	}
+	return ""
+}
+
+// 检查文件内容是图片，且扩展名与实际格式一致
+func checkImageFormat(filename string, head []byte) (string, error) {
+	format := sniffImageFormat(head)
+	if format == "" {
+		return "", &ImageError{
+			Code:   ImageCodeNotImage,
+			Format: "文件不是支持的图片格式",
+		}
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if !slices.Contains(imageFormatExtensions[format], ext) {
+		return "", &ImageError{
+			Code:   ImageCodeExtensionMismatch,
+			Format: "扩展名 '%s' 与文件的实际格式 %s 不符",
+			Args:   []any{ext, format},
+		}
+	}
+	return format, nil
+}
+
+// 只解析图片头部的宽高，像素数超过限制时拒绝，maxPixels 为 0 表示不限制
+func checkImagePixels(r io.Reader, maxPixels int64) error {
+	header, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return &ImageError{
+			Code:   ImageCodeNotImage,
+			Format: "无法解析图片: %v",
+			Args:   []any{err},
+		}
+	}
+	if header.Width <= 0 || header.Height <= 0 {
+		return &ImageError{
+			Code:   ImageCodeNotImage,
+			Format: "图片尺寸不合法",
+		}
+	}
+	if maxPixels > 0 && int64(header.Width)*int64(header.Height) > maxPixels {
+		return &ImageError{
+			Code:   ImageCodeTooManyPixels,
+			Format: "图片尺寸 %dx%d 超过最大像素数 %d",
+			Args:   []any{header.Width, header.Height, maxPixels},
+		}
+	}
+	return nil
+}
+
+// 先检查像素数再完整解码，避免超大图片在解码时占满内存
+func decodeImage(data []byte) (image.Image, string, error) {
+	if err := checkImagePixels(bytes.NewReader(data), uploadLimits().MaxPixels); err != nil {
+		return nil, "", err
+	}
+	return image.Decode(bytes.NewReader(data))
+}
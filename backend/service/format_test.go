@@ -0,0 +1,200 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"picture_storage/config"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 1x1 的无损 WebP，标准库和 x/image 都没有 WebP 编码器
+var webpPixel, _ = base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+
+// 模糊测试使用的像素上限，限制解码时的内存占用
+const fuzzMaxPixels = 1 << 20
+
+// 各格式的小图片，编码失败时测试直接失败
+func sampleImages(tb testing.TB) map[string][]byte {
+	tb.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 6; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 30), uint8(y * 40), 128, 255})
+		}
+	}
+	samples := map[string][]byte{"webp": webpPixel}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		tb.Fatal(err)
+	}
+	samples["png"] = slices.Clone(buffer.Bytes())
+	buffer.Reset()
+	if err := jpeg.Encode(&buffer, img, nil); err != nil {
+		tb.Fatal(err)
+	}
+	samples["jpeg"] = slices.Clone(buffer.Bytes())
+	buffer.Reset()
+	if err := gif.Encode(&buffer, img, nil); err != nil {
+		tb.Fatal(err)
+	}
+	samples["gif"] = slices.Clone(buffer.Bytes())
+	return samples
+}
+
+// 把图片头部声明的宽高改为 width x height，内容不变
+func withDimensions(tb testing.TB, format string, data []byte, width, height int) []byte {
+	tb.Helper()
+	data = slices.Clone(data)
+	switch format {
+	case "png":
+		// IHDR 紧跟在签名之后，修改后需要重新计算 CRC
+		binary.BigEndian.PutUint32(data[16:], uint32(width))
+		binary.BigEndian.PutUint32(data[20:], uint32(height))
+		binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	case "jpeg":
+		sof := bytes.Index(data, []byte{0xFF, 0xC0})
+		if sof < 0 {
+			tb.Fatal("jpeg without SOF0")
+		}
+		binary.BigEndian.PutUint16(data[sof+5:], uint16(height))
+		binary.BigEndian.PutUint16(data[sof+7:], uint16(width))
+	case "gif":
+		binary.LittleEndian.PutUint16(data[6:], uint16(width))
+		binary.LittleEndian.PutUint16(data[8:], uint16(height))
+	case "webp":
+		// VP8L 头部：14 位宽减一、14 位高减一、1 位透明度
+		bits := binary.LittleEndian.Uint32(data[21:])
+		bits = bits&^(1<<28-1) | uint32(width-1) | uint32(height-1)<<14
+		binary.LittleEndian.PutUint32(data[21:], bits)
+	}
+	return data
+}
+
+// 完整文件、各种长度的截断文件和声明了超大尺寸的文件
+func addImageSeeds(f *testing.F, add func(format string, data []byte)) {
+	for format, data := range sampleImages(f) {
+		add(format, data)
+		for _, n := range []int{0, 1, 4, 8, 12, 16, 24, 32, len(data) / 2, len(data) - 1} {
+			if n >= 0 && n < len(data) {
+				add(format, data[:n])
+			}
+		}
+		width, height := 65535, 65535
+		if format == "webp" {
+			width, height = 16384, 16384
+		}
+		add(format, withDimensions(f, format, data, width, height))
+	}
+}
+
+func TestWithDimensions(t *testing.T) {
+	for format, data := range sampleImages(t) {
+		header, decodedFormat, err := image.DecodeConfig(bytes.NewReader(withDimensions(t, format, data, 5000, 4000)))
+		if err != nil || decodedFormat != format || header.Width != 5000 || header.Height != 4000 {
+			t.Errorf("%s: %dx%d %s, %v", format, header.Width, header.Height, decodedFormat, err)
+		}
+	}
+}
+
+func FuzzCheckUploadFile(f *testing.F) {
+	addImageSeeds(f, func(format string, data []byte) {
+		for _, ext := range imageFormatExtensions[format] {
+			f.Add("image."+ext, int64(len(data)), data)
+		}
+		f.Add("image.PNG", int64(len(data)), data)
+		f.Add("image.txt", int64(len(data)), data)
+		f.Add("image", int64(len(data)), data)
+	})
+	f.Add("a.png", int64(-1), []byte("\x89PNG\r\n\x1a\n"))
+	f.Add("a.webp", int64(12), []byte("RIFF\x00\x00\x00\x00WEBPVP8"))
+	f.Add("a.bmp", int64(2), []byte("BM"))
+
+	limits := UploadLimits{
+		MaxFileSize:       1 << 20,
+		AllowedExtensions: []string{"png", "jpg", "jpeg", "gif", "webp"},
+		AllowedMimeTypes:  []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+	}
+	f.Fuzz(func(t *testing.T, filename string, size int64, head []byte) {
+		format, err := checkUploadFile(limits, filename, size, head)
+		if err != nil {
+			var quotaErr *QuotaError
+			var imageErr *ImageError
+			if !errors.As(err, &quotaErr) && !errors.As(err, &imageErr) {
+				t.Fatalf("error %T: %v", err, err)
+			}
+			if format != "" {
+				t.Fatalf("format %q returned with error", format)
+			}
+			return
+		}
+		// 通过检查的文件：格式由文件头决定，扩展名、大小和类型都在允许范围内
+		if format != sniffImageFormat(head) {
+			t.Fatalf("format = %q, sniffed %q", format, sniffImageFormat(head))
+		}
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+		if !slices.Contains(imageFormatExtensions[format], ext) || !slices.Contains(limits.AllowedExtensions, ext) {
+			t.Fatalf("extension of %q accepted as %s", filename, format)
+		}
+		if size > limits.MaxFileSize {
+			t.Fatalf("size %d accepted", size)
+		}
+		if !slices.Contains(limits.AllowedMimeTypes, imageFormatMimeTypes[format]) {
+			t.Fatalf("format %s accepted", format)
+		}
+	})
+}
+
+func FuzzDecodeImage(f *testing.F) {
+	addImageSeeds(f, func(_ string, data []byte) {
+		f.Add(data)
+	})
+
+	previous := config.C
+	config.C = config.Default()
+	config.C.Limits.MaxPixels = fuzzMaxPixels
+	f.Cleanup(func() { config.C = previous })
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, format, err := decodeImage(data)
+		if err != nil {
+			return
+		}
+		if img == nil || format == "" {
+			t.Fatalf("image = %v, format = %q", img, format)
+		}
+		// 解码成功的图片不能超过像素上限
+		bounds := img.Bounds()
+		if int64(bounds.Dx())*int64(bounds.Dy()) > fuzzMaxPixels {
+			t.Fatalf("decoded %dx%d image", bounds.Dx(), bounds.Dy())
+		}
+	})
+}
+
+func TestDecodeImageTooManyPixels(t *testing.T) {
+	previous := config.C
+	config.C = config.Default()
+	config.C.Limits.MaxPixels = fuzzMaxPixels
+	t.Cleanup(func() { config.C = previous })
+
+	for format, data := range sampleImages(t) {
+		if _, decodedFormat, err := decodeImage(data); err != nil || decodedFormat != format {
+			t.Errorf("%s: format %q, %v", format, decodedFormat, err)
+		}
+		_, _, err := decodeImage(withDimensions(t, format, data, 2048, 1024))
+		var imageErr *ImageError
+		if !errors.As(err, &imageErr) || imageErr.Code != ImageCodeTooManyPixels {
+			t.Errorf("%s oversized: %v", format, err)
+		}
+	}
+}
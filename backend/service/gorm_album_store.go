@@ -0,0 +1,166 @@
+package service
+
+import (
+	"picture_storage/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormAlbumRepository struct {
+	db *gorm.DB
+}
+
+func (repo gormAlbumRepository) List(tenantID uint64) ([]model.AlbumModel, error) {
+	albums := make([]model.AlbumModel, 0)
+	err := repo.db.Where("tenant_id = ?", tenantID).Order("created_at DESC").Find(&albums).Error
+	return albums, err
+}
+
+func (repo gormAlbumRepository) FindByID(tenantID, id uint64) (model.AlbumModel, error) {
+	var album model.AlbumModel
+	err := repo.db.Where("id = ? AND tenant_id = ?", id, tenantID).First(&album).Error
+	return album, err
+}
+
+func (repo gormAlbumRepository) Create(album *model.AlbumModel) error {
+	return repo.db.Create(album).Error
+}
+
+func (repo gormAlbumRepository) Update(album *model.AlbumModel) error {
+	return repo.db.Model(album).Updates(map[string]any{
+		"title":          album.Title,
+		"description":    album.Description,
+		"cover_image_id": album.CoverImageID,
+		"updated_at":     album.UpdatedAt,
+	}).Error
+}
+
+func (repo gormAlbumRepository) Delete(id uint64) error {
+	if err := repo.db.Where("album_id = ?", id).Delete(&model.AlbumImageModel{}).Error; err != nil {
+		return err
+	}
+	return repo.db.Where("id = ?", id).Delete(&model.AlbumModel{}).Error
+}
+
+func (repo gormAlbumRepository) Images(albumID uint64) ([]model.AlbumImageModel, error) {
+	albumImages := make([]model.AlbumImageModel, 0)
+	err := repo.db.Where("album_id = ?", albumID).Order("position ASC").Find(&albumImages).Error
+	return albumImages, err
+}
+
+func (repo gormAlbumRepository) FirstImage(albumID uint64) (model.AlbumImageModel, error) {
+	var albumImage model.AlbumImageModel
+	err := repo.db.Where("album_id = ?", albumID).Order("position ASC").First(&albumImage).Error
+	return albumImage, err
+}
+
+func (repo gormAlbumRepository) FindImage(albumID, imageID uint64) (model.AlbumImageModel, error) {
+	var albumImage model.AlbumImageModel
+	err := repo.db.Where("album_id = ? AND image_id = ?", albumID, imageID).First(&albumImage).Error
+	return albumImage, err
+}
+
+func (repo gormAlbumRepository) ImageCount(albumID uint64) (int64, error) {
+	var count int64
+	err := repo.db.Model(&model.AlbumImageModel{}).Where("album_id = ?", albumID).Count(&count).Error
+	return count, err
+}
+
+func (repo gormAlbumRepository) AddImage(albumImage *model.AlbumImageModel) error {
+	return repo.db.Create(albumImage).Error
+}
+
+func (repo gormAlbumRepository) RemoveImages(albumID uint64, imageIDs []uint64) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	if err := repo.db.Where("album_id = ? AND image_id IN ?", albumID, imageIDs).Delete(&model.AlbumImageModel{}).Error; err != nil {
+		return err
+	}
+	return repo.db.Model(&model.AlbumModel{}).Where("id = ? AND cover_image_id IN ?", albumID, imageIDs).Update("cover_image_id", 0).Error
+}
+
+func (repo gormAlbumRepository) SetPosition(albumImageID uint64, position int) error {
+	return repo.db.Model(&model.AlbumImageModel{}).Where("id = ?", albumImageID).Update("position", position).Error
+}
+
+type gormShareRepository struct {
+	db *gorm.DB
+}
+
+func (repo gormShareRepository) Create(share *model.ShareModel) error {
+	return repo.db.Create(share).Error
+}
+
+// 租户内的分享，createdBy 不为 0 时只包含该用户创建的
+func (repo gormShareRepository) owned(tenantID, createdBy uint64) *gorm.DB {
+	query := repo.db.Model(&model.ShareModel{}).Where("tenant_id = ?", tenantID)
+	if createdBy != 0 {
+		query = query.Where("created_by = ?", createdBy)
+	}
+	return query
+}
+
+func (repo gormShareRepository) List(tenantID, createdBy uint64) ([]model.ShareModel, error) {
+	shares := make([]model.ShareModel, 0)
+	err := repo.owned(tenantID, createdBy).Order("created_at DESC").Find(&shares).Error
+	return shares, err
+}
+
+func (repo gormShareRepository) FindByToken(token string) (model.ShareModel, error) {
+	var share model.ShareModel
+	err := repo.db.Where("token = ?", token).First(&share).Error
+	return share, err
+}
+
+func (repo gormShareRepository) Revoke(tenantID, createdBy, id uint64) (bool, error) {
+	result := repo.owned(tenantID, createdBy).Where("id = ?", id).Update("revoked", true)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (repo gormShareRepository) AddView(id uint64) error {
+	return repo.db.Model(&model.ShareModel{}).
+		Where("id = ?", id).
+		Update("view_count", gorm.Expr("view_count + ?", 1)).Error
+}
+
+type gormRandomRepository struct {
+	db *gorm.DB
+}
+
+func (repo gormRandomRepository) ServeHistory(filter ImageFilter, since time.Time) ([]model.ImageServeHistoryModel, error) {
+	history := make([]model.ImageServeHistoryModel, 0)
+	err := repo.db.Where("image_id IN (?) AND served_at >= ?", imageQuery(repo.db, filter).Select("image.id"), since).
+		Find(&history).Error
+	return history, err
+}
+
+func (repo gormRandomRepository) RecordServed(history []model.ImageServeHistoryModel) error {
+	if len(history) == 0 {
+		return nil
+	}
+	return repo.db.Create(&history).Error
+}
+
+func (repo gormRandomRepository) PurgeServeHistory(before time.Time) error {
+	return repo.db.Where("served_at < ?", before).Delete(&model.ImageServeHistoryModel{}).Error
+}
+
+func (repo gormRandomRepository) SessionImages(sessionKey string) ([]uint64, error) {
+	imageIDs := make([]uint64, 0)
+	err := repo.db.Model(&model.RandomSessionModel{}).Where("session_key = ?", sessionKey).Pluck("image_id", &imageIDs).Error
+	return imageIDs, err
+}
+
+func (repo gormRandomRepository) AddSessionImage(session *model.RandomSessionModel) error {
+	return repo.db.Create(session).Error
+}
+
+func (repo gormRandomRepository) ClearSession(sessionKey string) error {
+	return repo.db.Where("session_key = ?", sessionKey).Delete(&model.RandomSessionModel{}).Error
+}
+
+func (repo gormRandomRepository) PurgeSessions(before time.Time) error {
+	return repo.db.Where("created_at < ?", before).Delete(&model.RandomSessionModel{}).Error
+}
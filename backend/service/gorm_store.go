@@ -0,0 +1,275 @@
+package service
+
+import (
+	"picture_storage/model"
+
+	"gorm.io/gorm"
+)
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// 基于 gorm 的数据访问，tx 可以是普通连接或已开启的事务
+func NewGormStore(tx *gorm.DB) Store {
+	return gormStore{db: tx}
+}
+
+func (store gormStore) Images() ImageRepository {
+	return gormImageRepository{db: store.db}
+}
+
+func (store gormStore) Tags() TagRepository {
+	return gormTagRepository{db: store.db}
+}
+
+func (store gormStore) Albums() AlbumRepository {
+	return gormAlbumRepository{db: store.db}
+}
+
+func (store gormStore) Shares() ShareRepository {
+	return gormShareRepository{db: store.db}
+}
+
+func (store gormStore) Random() RandomRepository {
+	return gormRandomRepository{db: store.db}
+}
+
+func (store gormStore) Users() UserRepository {
+	return gormUserRepository{db: store.db}
+}
+
+func (store gormStore) Transaction(fn func(store Store) error) error {
+	tx := store.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(gormStore{db: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+type gormImageRepository struct {
+	db *gorm.DB
+}
+
+func (repo gormImageRepository) FindByIDs(tenantID uint64, ids []uint64) ([]model.ImageModel, error) {
+	images := make([]model.ImageModel, 0)
+	if len(ids) == 0 {
+		return images, nil
+	}
+	err := repo.db.Where("id IN ? AND tenant_id = ?", ids, tenantID).Find(&images).Error
+	return images, err
+}
+
+func (repo gormImageRepository) FindByCode(tenantID uint64, code string) (model.ImageModel, error) {
+	var image model.ImageModel
+	err := repo.db.Where("tenant_id = ? AND image_code = ?", tenantID, code).First(&image).Error
+	return image, err
+}
+
+func (repo gormImageRepository) FindByFile(tenantID uint64, directory, code, ext string) (model.ImageModel, error) {
+	var image model.ImageModel
+	err := repo.db.Where("tenant_id = ? AND directory = ? AND image_code = ? AND ext = ?", tenantID, directory, code, ext).
+		First(&image).Error
+	return image, err
+}
+
+func (repo gormImageRepository) FindByThumbnail(tenantID uint64, code, ext string) (model.ImageModel, error) {
+	var image model.ImageModel
+	err := repo.db.Where("tenant_id = ? AND thumbnail_code = ? AND ext = ?", tenantID, code, ext).First(&image).Error
+	return image, err
+}
+
+// 按条件构造图片查询，每次调用返回新的查询，可以作为子查询使用
+func imageQuery(db *gorm.DB, filter ImageFilter) *gorm.DB {
+	query := db.Model(&model.ImageModel{}).Where("image.tenant_id = ?", filter.TenantID)
+	if filter.Directory != "" {
+		query = query.Where("image.directory = ?", filter.Directory)
+	}
+	if len(filter.Tags) > 0 {
+		// 查询同时拥有所有指定标签的图片
+		// 在子查询中按 image_id 分组，外层直接查 image 表，避免 GROUP BY 后选择 image.* 在不同数据库上的差异
+		matched := db.Table("image_tag").
+			Joins("JOIN tag ON image_tag.tag_id = tag.id").
+			Where("tag.tag_name IN ? AND tag.tenant_id = ?", filter.Tags, filter.TenantID).
+			Group("image_tag.image_id").
+			Having("COUNT(DISTINCT tag.id) = ?", len(filter.Tags)).
+			Select("image_tag.image_id")
+		query = query.Where("image.id IN (?)", matched)
+	}
+	if len(filter.IDs) > 0 {
+		query = query.Where("image.id IN ?", filter.IDs)
+	}
+	if len(filter.ExcludeIDs) > 0 {
+		query = query.Where("image.id NOT IN ?", filter.ExcludeIDs)
+	}
+	if filter.AlbumID != 0 {
+		query = query.
+			Joins("JOIN album_image ON album_image.image_id = image.id").
+			Where("album_image.album_id = ?", filter.AlbumID)
+	}
+	if filter.ExcludeSession != "" {
+		// 已返回的图片通过子查询排除，不受绑定参数数量的限制
+		served := db.Model(&model.RandomSessionModel{}).Where("session_key = ?", filter.ExcludeSession).Select("image_id")
+		query = query.Where("image.id NOT IN (?)", served)
+	}
+	if filter.Viewer != nil {
+		restricted := db.Model(&model.DirectoryPermissionModel{}).
+			Where("tenant_id = ?", filter.TenantID).
+			Select("directory")
+		granted := db.Model(&model.DirectoryPermissionModel{}).
+			Where("tenant_id = ? AND user_id = ?", filter.TenantID, filter.Viewer.UserID).
+			Select("directory")
+		query = query.Where("(image.directory NOT IN (?) OR image.directory IN (?))", restricted, granted)
+	}
+	return query
+}
+
+func (repo gormImageRepository) List(filter ImageFilter, page model.Pagination) ([]model.ImageModel, int64, error) {
+	imageList := make([]model.ImageModel, 0)
+	var total int64
+
+	baseQuery := imageQuery(repo.db, filter)
+
+	// 统计总数
+	if err := baseQuery.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// 查询具体数据
+	order := "image.created_at DESC"
+	if filter.AlbumID != 0 {
+		order = "album_image.position ASC"
+	}
+	err := baseQuery.
+		Order(order).
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Select("image.*").
+		Find(&imageList).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return imageList, total, nil
+}
+
+func (repo gormImageRepository) Find(filter ImageFilter) ([]model.ImageModel, error) {
+	images := make([]model.ImageModel, 0)
+	err := imageQuery(repo.db, filter).Order("image.id ASC").Select("image.*").Find(&images).Error
+	return images, err
+}
+
+func (repo gormImageRepository) Candidates(filter ImageFilter) ([]model.ImageModel, error) {
+	images := make([]model.ImageModel, 0)
+	err := imageQuery(repo.db, filter).
+		Select("image.id, image.directory, image.created_at").
+		Order("image.id ASC").
+		Find(&images).Error
+	return images, err
+}
+
+func (repo gormImageRepository) Count(filter ImageFilter) (int64, error) {
+	var total int64
+	err := imageQuery(repo.db, filter).Count(&total).Error
+	return total, err
+}
+
+func (repo gormImageRepository) IDAt(filter ImageFilter, offset int64) (uint64, error) {
+	var ids []uint64
+	err := imageQuery(repo.db, filter).Order("image.id ASC").Offset(int(offset)).Limit(1).Pluck("image.id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return ids[0], nil
+}
+
+func (repo gormImageRepository) Directories(filter ImageFilter) ([]string, error) {
+	directories := make([]string, 0)
+	err := imageQuery(repo.db, filter).Distinct().Pluck("image.directory", &directories).Error
+	return directories, err
+}
+
+func (repo gormImageRepository) Create(image *model.ImageModel) error {
+	return repo.db.Create(image).Error
+}
+
+func (repo gormImageRepository) Delete(id uint64) error {
+	if err := repo.db.Where("image_id = ?", id).Delete(&model.ImageTagModel{}).Error; err != nil {
+		return err
+	}
+	if err := repo.db.Where("image_id = ?", id).Delete(&model.AlbumImageModel{}).Error; err != nil {
+		return err
+	}
+	if err := repo.db.Model(&model.AlbumModel{}).Where("cover_image_id = ?", id).Update("cover_image_id", 0).Error; err != nil {
+		return err
+	}
+	return repo.db.Where("id = ?", id).Delete(&model.ImageModel{}).Error
+}
+
+func (repo gormImageRepository) Usage(tenantID uint64, scope, target string) (int64, int64, error) {
+	query := repo.db.Model(&model.ImageModel{}).Where("tenant_id = ?", tenantID)
+	if scope == model.QuotaScopeDirectory {
+		query = query.Where("directory = ?", target)
+	} else {
+		query = query.Where("uploader_id = ?", target)
+	}
+	var usage struct {
+		Bytes  int64
+		Images int64
+	}
+	if err := query.Select("COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS images").Scan(&usage).Error; err != nil {
+		return 0, 0, err
+	}
+	return usage.Bytes, usage.Images, nil
+}
+
+func (repo gormImageRepository) Quota(tenantID uint64, scope, target string) (model.QuotaModel, error) {
+	var quota model.QuotaModel
+	err := repo.db.Where("tenant_id = ? AND scope = ? AND target = ?", tenantID, scope, target).First(&quota).Error
+	return quota, err
+}
+
+func (repo gormImageRepository) Quotas(tenantID uint64, scope string) ([]model.QuotaModel, error) {
+	quotas := make([]model.QuotaModel, 0)
+	err := repo.db.Where("tenant_id = ? AND scope = ?", tenantID, scope).Order("id ASC").Find(&quotas).Error
+	return quotas, err
+}
+
+func (repo gormImageRepository) CreateQuota(quota *model.QuotaModel) error {
+	return repo.db.Create(quota).Error
+}
+
+func (repo gormImageRepository) DeleteQuota(tenantID uint64, scope, target string) error {
+	return repo.db.Where("tenant_id = ? AND scope = ? AND target = ?", tenantID, scope, target).Delete(&model.QuotaModel{}).Error
+}
+
+func (repo gormImageRepository) DirectoryPermissions(tenantID uint64, directory string) ([]model.DirectoryPermissionModel, error) {
+	permissions := make([]model.DirectoryPermissionModel, 0)
+	err := repo.db.Where("tenant_id = ? AND directory = ?", tenantID, directory).Order("id ASC").Find(&permissions).Error
+	return permissions, err
+}
+
+func (repo gormImageRepository) CreateDirectoryPermission(permission *model.DirectoryPermissionModel) error {
+	return repo.db.Create(permission).Error
+}
+
+func (repo gormImageRepository) DeleteDirectoryPermission(tenantID uint64, directory string, userID uint64) error {
+	return repo.db.Where("tenant_id = ? AND directory = ? AND user_id = ?", tenantID, directory, userID).
+		Delete(&model.DirectoryPermissionModel{}).Error
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (repo gormUserRepository) FindByID(tenantID, id uint64) (model.UserModel, error) {
+	var user model.UserModel
+	err := repo.db.Where("id = ? AND tenant_id = ?", id, tenantID).First(&user).Error
+	return user, err
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"picture_storage/model"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormTagRepository struct {
+	db *gorm.DB
+}
+
+func (repo gormTagRepository) List(tenantID uint64) ([]model.TagModel, error) {
+	tags := make([]model.TagModel, 0)
+	err := repo.db.Where("tenant_id = ?", tenantID).Order("created_at ASC").Find(&tags).Error
+	return tags, err
+}
+
+func (repo gormTagRepository) FindByName(tenantID uint64, name string) (model.TagModel, error) {
+	var tag model.TagModel
+	err := repo.db.Where("tenant_id = ? AND tag_name = ?", tenantID, name).First(&tag).Error
+	return tag, err
+}
+
+func (repo gormTagRepository) FindByIDs(ids []uint64) ([]model.TagModel, error) {
+	tags := make([]model.TagModel, 0)
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	err := repo.db.Where("id IN ?", ids).Find(&tags).Error
+	return tags, err
+}
+
+func (repo gormTagRepository) ResolveAliases(tenantID uint64, names []string) (map[string]string, error) {
+	aliasMap := make(map[string]string)
+	if len(names) == 0 {
+		return aliasMap, nil
+	}
+	var aliases []struct {
+		AliasName string
+		TagName   string
+	}
+	err := repo.db.Table("tag_alias").
+		Joins("JOIN tag ON tag_alias.tag_id = tag.id").
+		Where("tag_alias.alias_name IN ? AND tag.tenant_id = ?", names, tenantID).
+		Select("tag_alias.alias_name, tag.tag_name").
+		Find(&aliases).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range aliases {
+		aliasMap[alias.AliasName] = alias.TagName
+	}
+	return aliasMap, nil
+}
+
+func (repo gormTagRepository) Create(tag *model.TagModel) error {
+	return repo.db.Create(tag).Error
+}
+
+func (repo gormTagRepository) Update(tag *model.TagModel) error {
+	return repo.db.Model(tag).Select("tag_name", "category").Updates(tag).Error
+}
+
+func (repo gormTagRepository) Delete(id uint64) error {
+	if err := repo.db.Where("tag_id = ?", id).Delete(&model.ImageTagModel{}).Error; err != nil {
+		return err
+	}
+	if err := repo.db.Where("tag_id = ?", id).Delete(&model.TagAliasModel{}).Error; err != nil {
+		return err
+	}
+	return repo.db.Where("id = ?", id).Delete(&model.TagModel{}).Error
+}
+
+func (repo gormTagRepository) ImageTags(imageIDs []uint64, includeSystem bool) ([]model.ImageTagModel, error) {
+	imageTags := make([]model.ImageTagModel, 0)
+	if len(imageIDs) == 0 {
+		return imageTags, nil
+	}
+	query := repo.db.Where("image_id IN ?", imageIDs)
+	if !includeSystem {
+		query = query.Where("is_system = ?", false)
+	}
+	err := query.Order("id ASC").Find(&imageTags).Error
+	return imageTags, err
+}
+
+func (repo gormTagRepository) FindImageTag(imageID, tagID uint64) (model.ImageTagModel, error) {
+	var imageTag model.ImageTagModel
+	err := repo.db.Where("image_id = ? AND tag_id = ?", imageID, tagID).First(&imageTag).Error
+	return imageTag, err
+}
+
+func (repo gormTagRepository) SaveImageTag(imageTag *model.ImageTagModel) error {
+	if imageTag.ID == 0 {
+		return repo.db.Create(imageTag).Error
+	}
+	return repo.db.Model(imageTag).Update("is_system", imageTag.IsSystem).Error
+}
+
+func (repo gormTagRepository) DeleteImageTags(imageID uint64, isSystem bool) error {
+	return repo.db.Where("image_id = ? AND is_system = ?", imageID, isSystem).Delete(&model.ImageTagModel{}).Error
+}
+
+func (repo gormTagRepository) AutoTagSettings(tenantID uint64, directory string) ([]model.DirectoryAutoTagModel, error) {
+	settings := make([]model.DirectoryAutoTagModel, 0)
+	err := repo.db.Where("tenant_id = ? AND directory = ?", tenantID, directory).Find(&settings).Error
+	return settings, err
+}
+
+func (repo gormTagRepository) FindByNames(tenantID uint64, names []string) ([]model.TagModel, error) {
+	tags := make([]model.TagModel, 0)
+	if len(names) == 0 {
+		return tags, nil
+	}
+	err := repo.db.Where("tenant_id = ? AND tag_name IN ?", tenantID, names).Find(&tags).Error
+	return tags, err
+}
+
+func (repo gormTagRepository) Merge(sourceID, targetID uint64) error {
+	// 已经拥有目标标签的图片，直接删除源标签关联，避免重复
+	var targetImageIDs []uint64
+	if err := repo.db.Model(&model.ImageTagModel{}).Where("tag_id = ?", targetID).Pluck("image_id", &targetImageIDs).Error; err != nil {
+		return err
+	}
+	if len(targetImageIDs) > 0 {
+		if err := repo.db.Where("tag_id = ? AND image_id IN ?", sourceID, targetImageIDs).Delete(&model.ImageTagModel{}).Error; err != nil {
+			return err
+		}
+	}
+
+	// 其余关联转移到目标标签
+	if err := repo.db.Model(&model.ImageTagModel{}).Where("tag_id = ?", sourceID).Update("tag_id", targetID).Error; err != nil {
+		return err
+	}
+
+	// 源标签原有的别名一并转移
+	if err := repo.db.Model(&model.TagAliasModel{}).Where("tag_id = ?", sourceID).Update("tag_id", targetID).Error; err != nil {
+		return err
+	}
+
+	return repo.db.Where("id = ?", sourceID).Delete(&model.TagModel{}).Error
+}
+
+func (repo gormTagRepository) Counts(filter ImageFilter) (map[uint64]int64, error) {
+	var rows []struct {
+		TagID uint64
+		Count int64
+	}
+	err := repo.db.Table("image_tag").
+		Where("image_tag.image_id IN (?)", imageQuery(repo.db, filter).Select("image.id")).
+		Group("image_tag.tag_id").
+		Select("image_tag.tag_id AS tag_id, COUNT(*) AS count").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint64]int64, len(rows))
+	for _, row := range rows {
+		counts[row.TagID] = row.Count
+	}
+	return counts, nil
+}
+
+// 转义 LIKE 通配符，配合 ESCAPE '!' 使用
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+func (repo gormTagRepository) Search(filter ImageFilter, query string, includeUnused bool, limit int) ([]TagUsage, error) {
+	// PostgreSQL 的 LIKE 区分大小写，统一转成小写后比较，与 SQLite 和 MySQL 的默认行为一致
+	escaped := escapeLike(strings.ToLower(query))
+	prefix := escaped + "%"
+	namespacedPrefix := "%:" + escaped + "%"
+	contains := "%" + escaped + "%"
+
+	// 别名命中时返回其规范标签
+	aliasQuery := repo.db.Model(&model.TagAliasModel{}).
+		Select("tag_id").
+		Where("LOWER(alias_name) LIKE ? ESCAPE '!'", contains)
+
+	// 不保留没有图片的标签时使用内连接
+	join := "JOIN"
+	if includeUnused {
+		join = "LEFT JOIN"
+	}
+	images := imageQuery(repo.db, filter).Select("image.id")
+
+	rows := make([]TagUsage, 0)
+	err := repo.db.Table("tag").
+		Joins(join+" image_tag ON image_tag.tag_id = tag.id AND image_tag.image_id IN (?)", images).
+		Where("tag.tenant_id = ?", filter.TenantID).
+		Where("(LOWER(tag.tag_name) LIKE ? ESCAPE '!' OR tag.id IN (?))", contains, aliasQuery).
+		Group("tag.id, tag.tag_name, tag.category").
+		Select("tag.tag_name AS name, tag.category AS category, COUNT(image_tag.id) AS count").
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "CASE WHEN LOWER(tag.tag_name) LIKE ? ESCAPE '!' THEN 0 WHEN LOWER(tag.tag_name) LIKE ? ESCAPE '!' THEN 1 ELSE 2 END, count DESC, tag.tag_name ASC",
+			Vars:               []any{prefix, namespacedPrefix},
+			WithoutParentheses: true,
+		}}).
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (repo gormTagRepository) Related(filter ImageFilter, limit int) ([]TagUsage, error) {
+	rows := make([]TagUsage, 0)
+	query := repo.db.Table("image_tag").
+		Joins("JOIN tag ON tag.id = image_tag.tag_id").
+		Where("image_tag.image_id IN (?)", imageQuery(repo.db, filter).Select("image.id"))
+	if len(filter.Tags) > 0 {
+		query = query.Where("tag.tag_name NOT IN ?", filter.Tags)
+	}
+	err := query.
+		Group("tag.id, tag.tag_name, tag.category").
+		Select("tag.tag_name AS name, tag.category AS category, COUNT(*) AS count").
+		Order("count DESC, tag.tag_name ASC").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (repo gormTagRepository) ImageTagNames(filter ImageFilter, names []string) (map[uint64][]string, error) {
+	result := make(map[uint64][]string)
+	if len(names) == 0 {
+		return result, nil
+	}
+	var rows []struct {
+		ImageID uint64
+		TagName string
+	}
+	// 图片通过子查询限定，不受绑定参数数量的限制
+	err := repo.db.Table("image_tag").
+		Joins("JOIN tag ON image_tag.tag_id = tag.id").
+		Where("image_tag.image_id IN (?) AND tag.tenant_id = ? AND LOWER(tag.tag_name) IN ?", imageQuery(repo.db, filter).Select("image.id"), filter.TenantID, names).
+		Select("image_tag.image_id AS image_id, tag.tag_name AS tag_name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.ImageID] = append(result[row.ImageID], row.TagName)
+	}
+	return result, nil
+}
+
+func (repo gormTagRepository) RemoveImageTags(imageIDs, tagIDs []uint64) error {
+	if len(imageIDs) == 0 || len(tagIDs) == 0 {
+		return nil
+	}
+	return repo.db.Where("image_id IN ? AND tag_id IN ?", imageIDs, tagIDs).Delete(&model.ImageTagModel{}).Error
+}
+
+func (repo gormTagRepository) Aliases(tagID uint64) ([]string, error) {
+	aliases := make([]string, 0)
+	err := repo.db.Model(&model.TagAliasModel{}).
+		Where("tag_id = ?", tagID).
+		Order("created_at ASC").
+		Pluck("alias_name", &aliases).Error
+	return aliases, err
+}
+
+func (repo gormTagRepository) CreateAlias(alias *model.TagAliasModel) error {
+	return repo.db.Create(alias).Error
+}
+
+func (repo gormTagRepository) DeleteAlias(tenantID uint64, aliasName string) (bool, error) {
+	tagIDs := repo.db.Model(&model.TagModel{}).Where("tenant_id = ?", tenantID).Select("id")
+	result := repo.db.Where("alias_name = ? AND tag_id IN (?)", aliasName, tagIDs).Delete(&model.TagAliasModel{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (repo gormTagRepository) Categories(tenantID uint64) ([]model.TagCategoryModel, error) {
+	categories := make([]model.TagCategoryModel, 0)
+	err := repo.db.Model(&model.TagCategoryModel{}).
+		Where("tenant_id = ?", tenantID).
+		Order("created_at ASC").
+		Find(&categories).Error
+	return categories, err
+}
+
+func (repo gormTagRepository) FindCategory(tenantID uint64, name string) (model.TagCategoryModel, error) {
+	var category model.TagCategoryModel
+	err := repo.db.Where("tenant_id = ? AND name = ?", tenantID, name).First(&category).Error
+	return category, err
+}
+
+func (repo gormTagRepository) CategoryExists(tenantID uint64, name string) (bool, error) {
+	var count int64
+	err := repo.db.Model(&model.TagCategoryModel{}).Where("tenant_id = ? AND name = ?", tenantID, name).Count(&count).Error
+	return count > 0, err
+}
+
+func (repo gormTagRepository) CreateCategory(category *model.TagCategoryModel) error {
+	if err := repo.db.Create(category).Error; err != nil {
+		return err
+	}
+	prefix := category.Name + ":"
+	return repo.db.Model(&model.TagModel{}).
+		Where("tenant_id = ? AND category = '' AND SUBSTR(tag_name, 1, ?) = ?", category.TenantID, len([]rune(prefix)), prefix).
+		Update("category", category.Name).Error
+}
+
+func (repo gormTagRepository) UpdateCategory(category *model.TagCategoryModel) error {
+	return repo.db.Model(category).Update("color", category.Color).Error
+}
+
+func (repo gormTagRepository) DeleteCategory(category model.TagCategoryModel) error {
+	if err := repo.db.Model(&model.TagModel{}).Where("tenant_id = ? AND category = ?", category.TenantID, category.Name).Update("category", "").Error; err != nil {
+		return err
+	}
+	return repo.db.Where("id = ?", category.ID).Delete(&model.TagCategoryModel{}).Error
+}
+
+func (repo gormTagRepository) SaveAutoTagSetting(setting *model.DirectoryAutoTagModel) error {
+	if setting.ID == 0 {
+		return repo.db.Create(setting).Error
+	}
+	return repo.db.Model(setting).Update("enabled", setting.Enabled).Error
+}
@@ -2,16 +2,21 @@ package service
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"math"
 	"mime/multipart"
+	"net/url"
 	"path/filepath"
-	"picture_storage/db"
+	"picture_storage/cache"
+	"picture_storage/config"
 	"picture_storage/model"
-	"picture_storage/pkg/minio"
+	"slices"
 	"strings"
 
 	"github.com/disintegration/imaging"
@@ -19,45 +24,57 @@ import (
 )
 
 type ImageService struct {
+	actor   Actor
+	storage Storage
+	store   Store
+	clock   Clock
 }
 
-func NewImageService() *ImageService {
-	return &ImageService{}
+// 生产环境使用 minio.Client、NewGormStore(db.DB) 和 SystemClock
+func NewImageService(storage Storage, store Store, clock Clock) *ImageService {
+	return &ImageService{
+		storage: storage,
+		store:   store,
+		clock:   clock,
+	}
+}
+
+// 服务使用的时钟，登录服务与图片服务共用
+func (service *ImageService) Clock() Clock {
+	return service.clock
 }
 
 func (service *ImageService) GetDirectoryList() ([]string, error) {
-	directoryList, err := minio.Client.GetDirectoryList()
-	if err != nil {
-		return nil, err
+	var buckets []string
+	if !cache.Get(directoryCacheKey, &buckets) {
+		directoryList, err := service.storage.GetDirectoryList()
+		if err != nil {
+			return nil, err
+		}
+		buckets = directoryList
+		cache.Set(directoryCacheKey, buckets, 0)
 	}
 	directoryNameList := make([]string, 0)
-	for _, object := range directoryList {
-		directoryNameList = append(directoryNameList, object.Name)
+	for _, bucket := range buckets {
+		// 只返回当前租户的目录，跳过缩略图目录和无权访问的目录
+		tenantID, directory := ParseTenantBucket(bucket)
+		if tenantID != service.actor.TenantID || directory == thumbnailDirectory() {
+			continue
+		}
+		err := service.checkDirectory(directory, false)
+		if err == ErrForbidden {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		directoryNameList = append(directoryNameList, directory)
 	}
 	return directoryNameList, nil
 }
 
-func (service *ImageService) UploadImage(directory string, file *multipart.FileHeader) (string, int64, error) {
-	// 打开文件
-	src, err := file.Open()
-	if err != nil {
-		return "", 0, err
-	}
-	defer src.Close()
-
-	// 上传到 MinIO
-	objectName := file.Filename
-
-	// 上传文件
-	md5WithExt, size, err := minio.Client.UploadFile(directory, objectName, file.Size, src, file.Header.Get("Content-Type"))
-	if err != nil {
-		return "", size, err
-	}
-
-	return md5WithExt, size, nil
-}
-
-func (service *ImageService) GetTagsByImageIDs(imageIDs []uint64) (map[uint64][]string, error) {
+// includeSystem 为 false 时不返回系统生成的自动标签
+func (service *ImageService) GetTagsByImageIDs(imageIDs []uint64, includeSystem bool) (map[uint64][]string, error) {
 	if len(imageIDs) == 0 {
 		return make(map[uint64][]string), nil
 	}
@@ -69,10 +86,7 @@ func (service *ImageService) GetTagsByImageIDs(imageIDs []uint64) (map[uint64][]
 	}
 
 	// 查询所有相关的图片标签关联
-	var imageTagList []model.ImageTagModel
-	err := db.DB.Model(&model.ImageTagModel{}).
-		Where("image_id IN ?", imageIDs).
-		Find(&imageTagList).Error
+	imageTagList, err := service.store.Tags().ImageTags(imageIDs, includeSystem)
 	if err != nil {
 		return nil, err
 	}
@@ -88,10 +102,7 @@ func (service *ImageService) GetTagsByImageIDs(imageIDs []uint64) (map[uint64][]
 	}
 
 	// 查询所有标签信息
-	var tags []model.TagModel
-	err = db.DB.Model(&model.TagModel{}).
-		Where("id IN ?", tagIDs).
-		Find(&tags).Error
+	tags, err := service.store.Tags().FindByIDs(tagIDs)
 	if err != nil {
 		return nil, err
 	}
@@ -113,83 +124,30 @@ func (service *ImageService) GetTagsByImageIDs(imageIDs []uint64) (map[uint64][]
 }
 
 func (service *ImageService) GetTagsByImageID(imageID uint64) ([]string, error) {
-	//cacheKey := fmt.Sprintf("image_tags_%d", imageID)
-	//if tags, err := cache.Get(cacheKey); err == nil {
-	//	return tags.([]string), nil
-	//}
+	cacheKey := service.tagCacheKey(fmt.Sprintf("image:%d", imageID))
 	var tags []string
-	var imageTagList []model.ImageTagModel
-	err := db.DB.Model(&model.ImageTagModel{}).Where("image_id = ?", imageID).Find(&imageTagList).Error
+	if cache.Get(cacheKey, &tags) {
+		return tags, nil
+	}
+	tagMap, err := service.GetTagsByImageIDs([]uint64{imageID}, true)
 	if err != nil {
 		return nil, err
 	}
-	for _, imageTag := range imageTagList {
-		var tag model.TagModel
-		err := db.DB.Model(&model.TagModel{}).Where("id = ?", imageTag.TagID).Find(&tag).Error
-		if err != nil {
-			return nil, err
-		}
-		tags = append(tags, tag.TagName)
-	}
-	//cache.Set(cacheKey, tags)
+	tags = tagMap[imageID]
+	cache.Set(cacheKey, tags, 0)
 	return tags, nil
 }
 
 func (service *ImageService) GetImageListByDirectory(directory string, tags []string, page model.Pagination) ([]model.ImageModel, int64, error) {
-	imageList := make([]model.ImageModel, 0)
-	var total int64
-	if len(tags) > 0 {
-		// 查询同时拥有所有指定标签的图片
-		// 使用 GROUP BY 和 HAVING 来确保图片拥有所有指定的标签
-		baseQuery := db.DB.Model(&model.ImageModel{}).
-			Joins("JOIN image_tag ON image_tag.image_id = image.id").
-			Joins("JOIN tag ON image_tag.tag_id = tag.id").
-			Where("tag.tag_name IN ? AND image.directory = ?", tags, directory).
-			Group("image.id").
-			Having("COUNT(DISTINCT tag.id) = ?", len(tags))
-
-		// 统计总数
-		var countResult []struct {
-			ID uint64
-		}
-		err := baseQuery.Select("image.id").Find(&countResult).Error
-		if err != nil {
-			return nil, 0, err
-		}
-		total = int64(len(countResult))
-
-		// 查询具体数据
-		result := baseQuery.
-			Order("image.created_at DESC").
-			Offset((page.Page - 1) * page.PageSize).
-			Limit(page.PageSize).
-			Select("image.*").
-			Find(&imageList)
-
-		err = result.Error
-		if err != nil {
-			return nil, 0, err
-		}
-
-	} else {
-		// 没有标签筛选时，查询该目录下的所有图片
-		baseQuery := db.DB.Where("directory = ?", directory).
-			Order("created_at DESC")
-
-		// 统计总数
-		baseQuery.Model(&model.ImageModel{}).Count(&total)
-
-		// 查询具体数据
-		result := baseQuery.
-			Offset((page.Page - 1) * page.PageSize).
-			Limit(page.PageSize).
-			Find(&imageList)
-		err := result.Error
-		if err != nil {
-			return nil, 0, err
-		}
+	if err := service.checkDirectory(directory, false); err != nil {
+		return nil, 0, err
+	}
+	tags, err := service.resolveTagNames(service.store, tags)
+	if err != nil {
+		return nil, 0, err
 	}
-	return imageList, total, nil
+	filter := ImageFilter{TenantID: service.actor.TenantID, Directory: directory, Tags: tags}
+	return service.store.Images().List(filter, page)
 }
 
 func (service *ImageService) GetImageListByTag(directory string, tag string, page model.Pagination) ([]model.ImageDTO, int64, error) {
@@ -198,25 +156,34 @@ func (service *ImageService) GetImageListByTag(directory string, tag string, pag
 	return []model.ImageDTO{}, 0, nil
 }
 
-// 根据图片类型创建缩略图
-func (service *ImageService) createThumbnail(file *multipart.FileHeader, maxWidth, maxHeight int) ([]byte, error) {
-	// 打开上传的文件
+// 读取上传文件的全部内容
+func readMultipartFile(file *multipart.FileHeader) ([]byte, error) {
 	src, err := file.Open()
 	if err != nil {
 		return nil, err
 	}
 	defer src.Close()
+	return io.ReadAll(src)
+}
 
-	// 读取文件内容
-	fileBytes, err := io.ReadAll(src)
+// 按最大宽高等比缩放图片，并按原格式重新编码；宽或高为 0 时只按另一边缩放
+func resizeImage(data []byte, maxWidth, maxHeight int) ([]byte, error) {
+	img, format, err := decodeImage(data)
 	if err != nil {
 		return nil, err
 	}
+	return encodeResized(img, format, maxWidth, maxHeight)
+}
 
-	// 解码图片
-	img, format, err := image.Decode(bytes.NewReader(fileBytes))
-	if err != nil {
-		return nil, err
+// 缩放已解码的图片并编码，format 为解码时得到的格式
+func encodeResized(img image.Image, format string, maxWidth, maxHeight int) ([]byte, error) {
+	var err error
+	// 未限制的一边视为不限
+	if maxWidth <= 0 {
+		maxWidth = math.MaxInt32
+	}
+	if maxHeight <= 0 {
+		maxHeight = math.MaxInt32
 	}
 
 	// 使用imaging库调整图片大小，保持宽高比
@@ -226,12 +193,12 @@ func (service *ImageService) createThumbnail(file *multipart.FileHeader, maxWidt
 	var buffer bytes.Buffer
 	switch format {
 	case "jpeg", "jpg":
-		err = jpeg.Encode(&buffer, resizedImg, &jpeg.Options{Quality: 85})
+		err = jpeg.Encode(&buffer, resizedImg, &jpeg.Options{Quality: config.C.Thumbnail.Quality})
 	case "png":
 		err = png.Encode(&buffer, resizedImg)
 	default:
 		// 默认使用JPEG
-		err = jpeg.Encode(&buffer, resizedImg, &jpeg.Options{Quality: 85})
+		err = jpeg.Encode(&buffer, resizedImg, &jpeg.Options{Quality: config.C.Thumbnail.Quality})
 	}
 
 	if err != nil {
@@ -241,368 +208,430 @@ func (service *ImageService) createThumbnail(file *multipart.FileHeader, maxWidt
 	return buffer.Bytes(), nil
 }
 
-// 上传缩略图到MinIO
-func (service *ImageService) uploadThumbnail(directory string, originalFilename string, thumbnailData []byte, contentType string) (string, int64, error) {
-	// 计算文件内容的MD5
-	fileSize := int64(len(thumbnailData))
-	md5WithExt, size, err := minio.Client.UploadFileBytes(directory, originalFilename, fileSize, thumbnailData, contentType)
-	if err != nil {
-		return "", 0, err
-	}
-
-	return md5WithExt, size, nil
+// 存储中的对象名是内容的 MD5 加原始扩展名，与 Storage 的命名方式一致
+func objectCode(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
 }
 
 func (service *ImageService) SaveImage(directory string, file *multipart.FileHeader, tags []string) (uint64, error) {
-	// 上传原图到 MinIO
-	imageCodeWithExt, size, err := service.UploadImage(directory, file)
-	if err != nil {
+	if err := service.requireUpload(); err != nil {
 		return 0, err
 	}
-
-	// 生成缩略图
-	thumbnailData, err := service.createThumbnail(file, 600, 600)
-	if err != nil {
+	if err := validateDirectory(service.actor.TenantID, directory); err != nil {
 		return 0, err
 	}
-
-	// 上传缩略图到 MinIO
-	thumbnailCodeWithExt, _, err := service.uploadThumbnail("tmp-thumbnail", file.Filename, thumbnailData, file.Header.Get("Content-Type"))
-	if err != nil {
+	if err := service.checkDirectory(directory, true); err != nil {
 		return 0, err
 	}
-
-	// 提取文件扩展名
-	extension := strings.TrimPrefix(filepath.Ext(imageCodeWithExt), ".")
-	// 提取文件名（去掉扩展名）
-	imageCode := strings.TrimSuffix(imageCodeWithExt, filepath.Ext(imageCodeWithExt))
-	// 开启事务
-	tx := db.DB.Begin()
-	if tx.Error != nil {
-		return 0, tx.Error
+	if err := service.checkUploadQuota(directory, file); err != nil {
+		return 0, err
 	}
 
-	// 先查询是否存在
-	var image *model.ImageModel = &model.ImageModel{}
-	err = tx.Model(&model.ImageModel{}).Where("image_code = ?", imageCode).Find(image).Error
+	// 只读取和解码一次，缩略图和自动标签共用解码结果
+	data, err := readMultipartFile(file)
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
-	if image.ID != 0 {
-		return image.ID, nil
-	}
-
-	// 保存图片信息
-	image = &model.ImageModel{
-		ImageName:     file.Filename,
-		ImageCode:     imageCode,
-		Directory:     directory,
-		Ext:           extension,
-		Size:          size,
-		ThumbnailCode: strings.TrimSuffix(thumbnailCodeWithExt, filepath.Ext(thumbnailCodeWithExt)),
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return 0, err
 	}
-	if err := tx.Create(image).Error; err != nil {
-		tx.Rollback()
+	thumbnailData, err := encodeResized(img, format, config.C.Thumbnail.MaxWidth, config.C.Thumbnail.MaxHeight)
+	if err != nil {
 		return 0, err
 	}
 
-	// 处理标签
-	if len(tags) > 0 {
-		// 先删除旧的标签关联
-		if err := tx.Where("image_id = ?", image.ID).Delete(&model.ImageTagModel{}).Error; err != nil {
-			tx.Rollback()
-			return 0, err
+	imageCode := objectCode(data)
+	extension := strings.TrimPrefix(filepath.Ext(file.Filename), ".")
+	contentType := file.Header.Get("Content-Type")
+	bucket := TenantBucket(service.actor.TenantID, directory)
+	thumbnailBucket := TenantBucket(service.actor.TenantID, thumbnailDirectory())
+
+	// 先在事务中写入记录和标签，最后上传文件：内容重复时不上传，上传失败时事务回滚
+	var imageID uint64
+	var uploaded []string
+	err = service.store.Transaction(func(store Store) error {
+		image, err := store.Images().FindByCode(service.actor.TenantID, imageCode)
+		if err == nil {
+			imageID = image.ID
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
 		}
 
-		// 处理每个标签
-		for _, tagName := range tags {
-			// 查找或创建标签
-			var tag model.TagModel
-			if err := tx.Where("tag_name = ?", tagName).First(&tag).Error; err != nil {
-				if err == gorm.ErrRecordNotFound {
-					// 标签不存在，创建新标签
-					tag = model.TagModel{
-						TagName: tagName,
-					}
-					if err := tx.Create(&tag).Error; err != nil {
-						tx.Rollback()
-						return 0, err
-					}
-				} else {
-					tx.Rollback()
-					return 0, err
-				}
-			}
+		// 其他图片已经使用相同的缩略图时对象已存在，失败时不能删除
+		thumbnailCode := objectCode(thumbnailData)
+		_, err = store.Images().FindByThumbnail(service.actor.TenantID, thumbnailCode, extension)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		thumbnailShared := err == nil
+
+		image = model.ImageModel{
+			TenantID:      service.actor.TenantID,
+			ImageName:     file.Filename,
+			ImageCode:     imageCode,
+			Directory:     directory,
+			UploaderID:    service.actor.UserID,
+			Ext:           extension,
+			Size:          int64(len(data)),
+			ThumbnailCode: thumbnailCode,
+			CreatedAt:     service.clock.Now(),
+		}
+		if err := store.Images().Create(&image); err != nil {
+			return err
+		}
+		imageID = image.ID
 
-			// 创建标签关联
-			imageTag := &model.ImageTagModel{
-				ImageID: image.ID,
-				TagID:   tag.ID,
-			}
-			if err := tx.Create(imageTag).Error; err != nil {
-				tx.Rollback()
-				return 0, err
+		if len(tags) > 0 {
+			if err := service.replaceImageTags(store, image.ID, tags); err != nil {
+				return err
 			}
 		}
-	}
+		// 根据目录规则生成自动标签
+		if err := service.applyAutoTags(store, &image, imageAttributes(img, format, data)); err != nil {
+			return err
+		}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
+		if _, _, err := service.storage.UploadFileBytes(bucket, file.Filename, image.Size, data, contentType); err != nil {
+			return err
+		}
+		uploaded = append(uploaded, bucket, image.ImageCode+"."+image.Ext)
+		if _, _, err := service.storage.UploadFileBytes(thumbnailBucket, file.Filename, int64(len(thumbnailData)), thumbnailData, contentType); err != nil {
+			return err
+		}
+		if !thumbnailShared {
+			uploaded = append(uploaded, thumbnailBucket, image.ThumbnailCode+"."+image.Ext)
+		}
+		return nil
+	})
+	if err != nil {
+		// 记录没有写入，删除本次上传新建的文件
+		for i := 0; i < len(uploaded); i += 2 {
+			service.storage.DeleteFile(uploaded[i], uploaded[i+1])
+		}
 		return 0, err
 	}
+	if len(uploaded) > 0 {
+		cache.Delete(directoryCacheKey)
+	}
+	service.invalidateTags()
 
-	return image.ID, nil
+	return imageID, nil
 }
 
+// 标签名列表，与 GetTagDetails 一样只包含当前身份可见的标签
 func (service *ImageService) GetTags() ([]string, error) {
-	var tags []model.TagModel
-	err := db.DB.Model(&model.TagModel{}).Order("created_at ASC").Find(&tags).Error
+	tagDetails, err := service.GetTagDetails()
 	if err != nil {
 		return nil, err
 	}
-	tagList := make([]string, 0)
-	for _, tag := range tags {
-		tagList = append(tagList, tag.TagName)
+	tagList := make([]string, 0, len(tagDetails))
+	for _, tag := range tagDetails {
+		tagList = append(tagList, tag.Name)
 	}
 	return tagList, nil
 }
 
-func (service *ImageService) GetRandomImage(directory string, tags []string, count int64) ([]string, error) {
-	imageList := make([]model.ImageModel, 0)
-
-	if len(tags) > 0 {
-		// 查询同时拥有所有指定标签的图片
-		baseQuery := db.DB.Model(&model.ImageModel{}).
-			Joins("JOIN image_tag ON image_tag.image_id = image.id").
-			Joins("JOIN tag ON image_tag.tag_id = tag.id").
-			Where("tag.tag_name IN ?", tags).
-			Group("image.id").
-			Having("COUNT(DISTINCT tag.id) = ?", len(tags))
-
-		// 如果指定了目录，添加目录条件
-		if directory != "" {
-			baseQuery = baseQuery.Where("image.directory = ?", directory)
-		}
+func (service *ImageService) DeleteImages(ids []int) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+	imageIDs := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		imageIDs = append(imageIDs, uint64(id))
+	}
+	if err := service.checkImages(service.store, imageIDs, true); err != nil {
+		return err
+	}
 
-		// 随机排序并限制数量
-		err := baseQuery.
-			Order("RAND()").
-			Limit(int(count)).
-			Select("image.*").
-			Find(&imageList).Error
+	// 事务中只收集要删除的文件，提交后再删除，回滚时记录对应的文件仍然存在
+	var objects [][2]string
+	err := service.store.Transaction(func(store Store) error {
+		objects = nil
+		images, err := store.Images().FindByIDs(service.actor.TenantID, imageIDs)
 		if err != nil {
-			return nil, err
+			return err
 		}
-	} else {
-		// 没有标签筛选时，查询图片
-		baseQuery := db.DB.Model(&model.ImageModel{})
-
-		// 如果指定了目录，添加目录条件
-		if directory != "" {
-			baseQuery = baseQuery.Where("directory = ?", directory)
+		for _, image := range images {
+			if err := store.Images().Delete(image.ID); err != nil {
+				return err
+			}
 		}
-
-		// 随机排序并限制数量
-		err := baseQuery.
-			Order("RAND()").
-			Limit(int(count)).
-			Find(&imageList).Error
-		if err != nil {
-			return nil, err
+		for _, image := range images {
+			bucket, object := service.imageObject(image, ImageVariantOriginal)
+			objects = append(objects, [2]string{bucket, object})
+			// 其他图片仍在使用相同的缩略图时保留
+			_, err := store.Images().FindByThumbnail(image.TenantID, image.ThumbnailCode, image.Ext)
+			if err == nil {
+				continue
+			}
+			if err != gorm.ErrRecordNotFound {
+				return err
+			}
+			bucket, object = service.imageObject(image, ImageVariantThumbnail)
+			if !slices.Contains(objects, [2]string{bucket, object}) {
+				objects = append(objects, [2]string{bucket, object})
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	service.invalidateTags()
 
-	// 转换为 minio URL
-	urls := make([]string, 0)
-	for _, image := range imageList {
-		url := minio.Client.GetObjectURL(image.Directory, image.ImageCode+"."+image.Ext)
-		urls = append(urls, url)
+	// 记录已经删除，文件删除失败只会留下无人引用的对象，继续删除其余文件后返回第一个错误
+	var deleteErr error
+	for _, object := range objects {
+		if err := service.storage.DeleteFile(object[0], object[1]); err != nil && deleteErr == nil {
+			deleteErr = err
+		}
 	}
-
-	return urls, nil
+	return deleteErr
 }
 
-func (service *ImageService) DeleteImages(ids []int) error {
-	tx := db.DB.Begin()
+func (service *ImageService) AddTags(imageIDs []uint64, tags []string) error {
+	if err := service.requireUpload(); err != nil {
+		return err
+	}
 
-	for _, id := range ids {
-		var image model.ImageModel
-		if err := tx.Where("id = ?", id).First(&image).Error; err != nil {
-			tx.Rollback()
+	err := service.store.Transaction(func(store Store) error {
+		if err := service.checkImages(store, imageIDs, true); err != nil {
 			return err
 		}
-		if err := tx.Where("image_id = ?", id).Delete(&model.ImageTagModel{}).Error; err != nil {
-			tx.Rollback()
-			return err
-		}
-		if err := tx.Where("id = ?", id).Delete(&model.ImageModel{}).Error; err != nil {
-			tx.Rollback()
-			return err
-		}
-		// 同时删除 minio 的图片
-		imageCodeWithExt := image.ImageCode + "." + image.Ext
-		thumbnailCodeWithExt := image.ThumbnailCode + ".jpg"
-		if err := minio.Client.DeleteFile(image.Directory, imageCodeWithExt); err != nil {
-			tx.Rollback()
-			return err
-		}
-		if err := minio.Client.DeleteFile("tmp-thumbnail", thumbnailCodeWithExt); err != nil {
-			tx.Rollback()
+
+		tags, err := service.resolveTagNames(store, tags)
+		if err != nil {
 			return err
 		}
-	}
-	if err := tx.Commit().Error; err != nil {
-		return err
-	}
-	return nil
-}
 
-func (service *ImageService) AddTags(imageIDs []uint64, tags []string) error {
-	tx := db.DB.Begin()
-	if tx.Error != nil {
-		return tx.Error
-	}
-
-	for _, tagName := range tags {
-		var tag model.TagModel
-		if err := tx.Where("tag_name = ?", tagName).First(&tag).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				tag = model.TagModel{
-					TagName: tagName,
-				}
-				if err := tx.Create(&tag).Error; err != nil {
-					tx.Rollback()
-					return err
-				}
-			} else {
-				tx.Rollback()
+		for _, tagName := range tags {
+			tag, err := service.findOrCreateTag(store, tagName)
+			if err != nil {
 				return err
 			}
-		}
-		for _, imageID := range imageIDs {
-			imageTag := &model.ImageTagModel{
-				ImageID: imageID,
-				TagID:   tag.ID,
-			}
-			if err := tx.Where("image_id = ? AND tag_id = ?", imageID, tag.ID).First(&model.ImageTagModel{}).Error; err != nil {
-				if err == gorm.ErrRecordNotFound {
-					if err := tx.Create(imageTag).Error; err != nil {
-						tx.Rollback()
-						return err
-					}
+			for _, imageID := range imageIDs {
+				if err := service.addImageTag(store, imageID, tag.ID, false); err != nil {
+					return err
 				}
 			}
 		}
-	}
-
-	if err := tx.Commit().Error; err != nil {
+		return nil
+	})
+	if err != nil {
 		return err
 	}
+	service.invalidateTags()
 	return nil
 }
 
 type TagDetailItem struct {
-	Name  string `json:"name"`
-	Count int64  `json:"count"`
+	Name     string `json:"name"`
+	Count    int64  `json:"count"`
+	Category string `json:"category"`
+	Color    string `json:"color"`
 }
 
 func (service *ImageService) GetTagDetails() ([]TagDetailItem, error) {
-	var tags []model.TagModel
-	err := db.DB.Model(&model.TagModel{}).Order("created_at ASC").Find(&tags).Error
+	// 数量只统计可见的图片，缓存按可见范围区分
+	cacheKey := service.scopedTagCacheKey("details")
+	tagDetails := make([]TagDetailItem, 0)
+	if cache.Get(cacheKey, &tagDetails) {
+		return tagDetails, nil
+	}
+
+	tags, err := service.store.Tags().List(service.actor.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	colorMap, err := service.tagCategoryColors()
+	if err != nil {
+		return nil, err
+	}
+
+	// 统计每个标签的图片数量，只统计当前身份可见的图片
+	counts, err := service.store.Tags().Counts(service.visibleImages())
 	if err != nil {
 		return nil, err
 	}
 
-	tagDetails := make([]TagDetailItem, 0)
 	for _, tag := range tags {
-		// 统计每个标签的图片数量
-		var count int64
-		err := db.DB.Table("image_tag").
-			Joins("JOIN image ON image_tag.image_id = image.id").
-			Where("image_tag.tag_id = ?", tag.ID).
-			Count(&count).Error
-		if err != nil {
-			return nil, err
+		// 非管理员看不到没有可见图片的标签
+		if counts[tag.ID] == 0 && !service.actor.IsAdmin() {
+			continue
 		}
-
 		tagDetails = append(tagDetails, TagDetailItem{
-			Name:  tag.TagName,
-			Count: count,
+			Name:     tag.TagName,
+			Count:    counts[tag.ID],
+			Category: tag.Category,
+			Color:    colorMap[tag.Category],
 		})
 	}
 
+	cache.Set(cacheKey, tagDetails, 0)
 	return tagDetails, nil
 }
 
 func (service *ImageService) CreateTag(tagName string) error {
-	// 检查标签是否已存在
-	var existingTag model.TagModel
-	err := db.DB.Where("tag_name = ?", tagName).First(&existingTag).Error
-	if err == nil {
-		return fmt.Errorf("标签 '%s' 已存在", tagName)
+	if err := service.requireUpload(); err != nil {
+		return err
 	}
-	if err != gorm.ErrRecordNotFound {
+
+	// 检查标签或别名是否已存在
+	if err := service.checkTagNameAvailable(service.store, tagName); err != nil {
 		return err
 	}
 
 	// 创建新标签
-	tag := model.TagModel{
-		TagName: tagName,
+	tag, err := service.newTag(service.store, tagName)
+	if err != nil {
+		return err
+	}
+	if err := service.store.Tags().Create(&tag); err != nil {
+		return err
 	}
-	return db.DB.Create(&tag).Error
+	service.invalidateTags()
+	return nil
 }
 
 func (service *ImageService) UpdateTag(oldName, newName string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
 	// 检查旧标签是否存在
-	var tag model.TagModel
-	err := db.DB.Where("tag_name = ?", oldName).First(&tag).Error
+	tag, err := service.findTag(service.store, oldName)
 	if err != nil {
 		return err
 	}
 
 	// 检查新标签名是否已存在
 	if oldName != newName {
-		var existingTag model.TagModel
-		err := db.DB.Where("tag_name = ?", newName).First(&existingTag).Error
-		if err == nil {
-			return fmt.Errorf("标签 '%s' 已存在", newName)
-		}
-		if err != gorm.ErrRecordNotFound {
+		if err := service.checkTagNameAvailable(service.store, newName); err != nil {
 			return err
 		}
 	}
 
+	// 新名称带有已知命名空间时同步更新分类
+	category, err := service.tagCategoryOf(service.store, newName)
+	if err != nil {
+		return err
+	}
+	tag.TagName = newName
+	if category != "" {
+		tag.Category = category
+	}
+
 	// 更新标签名
-	return db.DB.Model(&tag).Update("tag_name", newName).Error
+	if err := service.store.Tags().Update(&tag); err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
 }
 
 func (service *ImageService) DeleteTag(tagName string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
 	// 查找标签
-	var tag model.TagModel
-	err := db.DB.Where("tag_name = ?", tagName).First(&tag).Error
+	tag, err := service.findTag(service.store, tagName)
 	if err != nil {
 		return err
 	}
 
-	// 开启事务
-	tx := db.DB.Begin()
-	if tx.Error != nil {
-		return tx.Error
+	// 删除标签及其关联和别名
+	err = service.store.Transaction(func(store Store) error {
+		return store.Tags().Delete(tag.ID)
+	})
+	if err != nil {
+		return err
 	}
+	service.invalidateTags()
+	return nil
+}
 
-	// 删除标签关联
-	if err := tx.Where("tag_id = ?", tag.ID).Delete(&model.ImageTagModel{}).Error; err != nil {
-		tx.Rollback()
-		return err
+// 图片变体
+const (
+	ImageVariantOriginal  = "original"
+	ImageVariantThumbnail = "thumbnail"
+	ImageVariantResized   = "resized"
+)
+
+// 变体缩放的最大边长
+const maxResizeDimension = 4096
+
+// 获取图片或缩略图在存储中的位置
+func (service *ImageService) imageObject(image model.ImageModel, variant string) (string, string) {
+	if variant == ImageVariantThumbnail {
+		return TenantBucket(image.TenantID, thumbnailDirectory()), image.ThumbnailCode + "." + image.Ext
 	}
+	return TenantBucket(image.TenantID, image.Directory), image.ImageCode + "." + image.Ext
+}
 
-	// 删除标签
-	if err := tx.Where("id = ?", tag.ID).Delete(&model.TagModel{}).Error; err != nil {
-		tx.Rollback()
-		return err
+// 获取图片变体的访问地址，resized 变体没有固定地址
+// 默认返回后端 /files 路由的固定地址以便浏览器缓存，storage.urlMode 为 presigned 时返回存储的签名地址
+func (service *ImageService) GetImageURL(image model.ImageModel, variant string) (string, error) {
+	if variant == ImageVariantResized {
+		return "", Errorf(CodeInvalidArgument, "变体 '%s' 不支持生成地址", variant)
+	}
+	if config.C.Storage.URLMode == "presigned" {
+		bucket, object := service.imageObject(image, variant)
+		return service.storage.GetObjectURL(bucket, object)
+	}
+	path := fmt.Sprintf("/files/%s/%s.%s", url.PathEscape(image.Directory), image.ImageCode, image.Ext)
+	if variant == ImageVariantThumbnail {
+		path += "?variant=" + ImageVariantThumbnail
+	}
+	return path, nil
+}
+
+// 按目录和文件名查找图片，用于 /files 路由
+func (service *ImageService) GetImageByFile(directory, code, ext string) (model.ImageModel, error) {
+	if err := service.checkDirectory(directory, false); err != nil {
+		return model.ImageModel{}, err
 	}
+	return service.store.Images().FindByFile(service.actor.TenantID, directory, code, ext)
+}
 
-	// 提交事务
-	return tx.Commit().Error
+// 打开图片变体在存储中的文件，同时返回对象名，调用方负责关闭
+func (service *ImageService) OpenImage(image model.ImageModel, variant string) (io.ReadSeekCloser, string, error) {
+	if variant != ImageVariantOriginal && variant != ImageVariantThumbnail {
+		return nil, "", Errorf(CodeInvalidArgument, "未知的图片变体 '%s'", variant)
+	}
+	bucket, object := service.imageObject(image, variant)
+	file, err := service.storage.OpenFile(bucket, object)
+	if err != nil {
+		return nil, "", err
+	}
+	return file, object, nil
+}
+
+// 获取图片变体的内容，resized 变体按 width/height 实时缩放
+func (service *ImageService) GetImageContent(image model.ImageModel, variant string, width, height int) ([]byte, error) {
+	switch variant {
+	case ImageVariantOriginal, ImageVariantThumbnail:
+		bucket, object := service.imageObject(image, variant)
+		return service.storage.GetFile(bucket, object)
+	case ImageVariantResized:
+		if width <= 0 && height <= 0 {
+			return nil, Errorf(CodeInvalidArgument, "缩放需要指定 width 或 height")
+		}
+		if width > maxResizeDimension || height > maxResizeDimension {
+			return nil, Errorf(CodeInvalidArgument, "缩放尺寸不能超过 %d", maxResizeDimension)
+		}
+		bucket, object := service.imageObject(image, ImageVariantOriginal)
+		data, err := service.storage.GetFile(bucket, object)
+		if err != nil {
+			return nil, err
+		}
+		return resizeImage(data, width, height)
+	default:
+		return nil, Errorf(CodeInvalidArgument, "未知的图片变体 '%s'", variant)
+	}
 }
@@ -0,0 +1,384 @@
+package service_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"picture_storage/config"
+	"picture_storage/model"
+	"picture_storage/service"
+	"slices"
+	"testing"
+)
+
+func TestSaveImage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		data := pngData(t, 8, 4, color.White)
+		id, err := e.As(uploaderActor).SaveImage("photos", fileHeader(t, "a.png", data), []string{"cat"})
+		if err != nil {
+			t.Fatalf("save image: %v", err)
+		}
+
+		list, total, err := e.GetImageListByDirectory("photos", nil, model.Pagination{Page: 1, PageSize: 10})
+		if err != nil || total != 1 || len(list) != 1 {
+			t.Fatalf("list = %v, %d, %v", list, total, err)
+		}
+		image := list[0]
+		if image.ID != id || image.ImageName != "a.png" || image.Ext != "png" || image.Size != int64(len(data)) || image.UploaderID != uploaderActor.UserID {
+			t.Errorf("image = %+v", image)
+		}
+		if !e.Storage.Exists(service.TenantBucket(service.DefaultTenantID, "photos"), image.ImageCode+".png") {
+			t.Error("original not uploaded")
+		}
+		if thumbnail, err := e.Storage.GetFile(service.TenantBucket(service.DefaultTenantID, config.C.Thumbnail.Bucket), image.ThumbnailCode+".png"); err != nil || len(thumbnail) == 0 {
+			t.Errorf("thumbnail = %d bytes, %v", len(thumbnail), err)
+		}
+
+		tags, err := e.GetTagsByImageIDs([]uint64{id}, false)
+		if err != nil || !slices.Equal(tags[id], []string{"cat"}) {
+			t.Errorf("user tags = %v, %v", tags[id], err)
+		}
+		// 自动标签作为系统标签写入
+		all, err := e.GetTagsByImageID(id)
+		if err != nil || !slices.Contains(all, "format:png") || !slices.Contains(all, "orientation:landscape") {
+			t.Errorf("tags = %v, %v", all, err)
+		}
+
+		// 相同内容不会重复保存
+		again, err := e.SaveImage("photos", fileHeader(t, "b.png", data), nil)
+		if err != nil || again != id {
+			t.Errorf("duplicate = %d, %v; want %d", again, err, id)
+		}
+		if _, total, _ := e.GetImageListByDirectory("photos", nil, model.Pagination{Page: 1, PageSize: 10}); total != 1 {
+			t.Errorf("total after duplicate = %d", total)
+		}
+
+		if _, err := e.As(viewerActor).SaveImage("photos", fileHeader(t, "c.png", pngData(t, 4, 4, color.Black)), nil); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("viewer upload: %v", err)
+		}
+		if _, err := e.SaveImage("photos", fileHeader(t, "d.png", []byte("not an image")), nil); err == nil {
+			t.Error("invalid image accepted")
+		}
+	})
+}
+
+func TestGetImageListByDirectory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		a := e.upload(t, "photos", 10, "cat")
+		b := e.upload(t, "photos", 20, "cat", "dog")
+		c := e.upload(t, "photos", 30, "dog")
+		e.upload(t, "other", 40, "cat")
+
+		page := model.Pagination{Page: 1, PageSize: 10}
+		cases := []struct {
+			name  string
+			tags  []string
+			page  model.Pagination
+			want  []uint64
+			total int64
+		}{
+			{"按上传时间倒序", nil, page, []uint64{c, b, a}, 3},
+			{"分页", nil, model.Pagination{Page: 2, PageSize: 2}, []uint64{a}, 3},
+			{"单个标签", []string{"cat"}, page, []uint64{b, a}, 2},
+			{"同时拥有全部标签", []string{"cat", "dog"}, page, []uint64{b}, 1},
+			{"不存在的标签", []string{"bird"}, page, []uint64{}, 0},
+		}
+		for _, tc := range cases {
+			ids, total := listIDs(t, e.ImageService, "photos", tc.tags, tc.page)
+			if !slices.Equal(ids, tc.want) || total != tc.total {
+				t.Errorf("%s: ids = %v, total = %d; want %v, %d", tc.name, ids, total, tc.want, tc.total)
+			}
+		}
+
+		// 别名按规范标签过滤
+		if err := e.AddTagAlias("cat", "kitty"); err != nil {
+			t.Fatal(err)
+		}
+		if ids, _ := listIDs(t, e.ImageService, "photos", []string{"kitty"}, page); !slices.Equal(ids, []uint64{b, a}) {
+			t.Errorf("alias: ids = %v", ids)
+		}
+
+		// 受限目录对未授权的用户不可见
+		e.restrict(t, "photos")
+		if _, _, err := e.As(viewerActor).GetImageListByDirectory("photos", nil, page); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("viewer list restricted: %v", err)
+		}
+		if ids, _ := listIDs(t, e.As(viewerActor), "other", nil, page); len(ids) != 1 {
+			t.Errorf("viewer list public: %v", ids)
+		}
+	})
+}
+
+func TestTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		a := e.upload(t, "photos", 10, "cat")
+		b := e.upload(t, "photos", 20)
+		secret := e.upload(t, "private", 30, "secret", "cat")
+		e.restrict(t, "private")
+
+		if err := e.As(uploaderActor).AddTags([]uint64{a, b}, []string{"red"}); err != nil {
+			t.Fatalf("add tags: %v", err)
+		}
+		counts := tagCounts(t, e.ImageService)
+		if counts["red"] != 2 || counts["cat"] != 2 || counts["secret"] != 1 {
+			t.Errorf("admin counts = %v", counts)
+		}
+		// 其他身份只统计可见目录中的图片
+		counts = tagCounts(t, e.As(viewerActor))
+		if counts["red"] != 2 || counts["cat"] != 1 {
+			t.Errorf("viewer counts = %v", counts)
+		}
+		if _, ok := counts["secret"]; ok {
+			t.Errorf("viewer sees restricted tag: %v", counts)
+		}
+		if err := e.As(uploaderActor).AddTags([]uint64{secret}, []string{"red"}); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("tag restricted image: %v", err)
+		}
+		if err := e.AddTags([]uint64{a, 999}, []string{"red"}); !errors.Is(err, service.ErrImageNotFound) {
+			t.Errorf("tag missing image: %v", err)
+		}
+
+		if err := e.CreateTag("blue"); err != nil {
+			t.Fatalf("create tag: %v", err)
+		}
+		if err := e.CreateTag("blue"); err == nil {
+			t.Error("duplicate tag created")
+		}
+		if err := e.UpdateTag("red", "crimson"); err != nil {
+			t.Fatalf("update tag: %v", err)
+		}
+		tags, _ := e.GetTagsByImageIDs([]uint64{a}, false)
+		if !slices.Contains(tags[a], "crimson") || slices.Contains(tags[a], "red") {
+			t.Errorf("renamed tags = %v", tags[a])
+		}
+
+		if err := e.RemoveTags([]uint64{a}, []string{"crimson"}); err != nil {
+			t.Fatalf("remove tags: %v", err)
+		}
+		if counts := tagCounts(t, e.ImageService); counts["crimson"] != 1 {
+			t.Errorf("count after remove = %d", counts["crimson"])
+		}
+
+		if err := e.As(uploaderActor).DeleteTag("crimson"); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("uploader delete tag: %v", err)
+		}
+		if err := e.DeleteTag("crimson"); err != nil {
+			t.Fatalf("delete tag: %v", err)
+		}
+		names, err := e.GetTags()
+		if err != nil || slices.Contains(names, "crimson") || !slices.Contains(names, "blue") {
+			t.Errorf("tags = %v, %v", names, err)
+		}
+		tags, _ = e.GetTagsByImageIDs([]uint64{b}, false)
+		if len(tags[b]) != 0 {
+			t.Errorf("tags of b after delete = %v", tags[b])
+		}
+	})
+}
+
+func TestDeleteImages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		a := e.upload(t, "photos", 10, "cat")
+		b := e.upload(t, "photos", 20, "cat")
+		albums := service.NewAlbumService(e.ImageService)
+		albumID, err := albums.CreateAlbum("album", "", a)
+		if err != nil {
+			t.Fatalf("create album: %v", err)
+		}
+		if err := albums.AddAlbumImages(albumID, []uint64{b}); err != nil {
+			t.Fatalf("add album images: %v", err)
+		}
+		images, err := e.Store.Images().FindByIDs(service.DefaultTenantID, []uint64{a})
+		if err != nil || len(images) != 1 {
+			t.Fatalf("find image: %v, %v", images, err)
+		}
+		image := images[0]
+
+		if err := e.As(uploaderActor).DeleteImages([]int{int(a)}); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("uploader delete: %v", err)
+		}
+		if err := e.DeleteImages([]int{int(a), 999}); !errors.Is(err, service.ErrImageNotFound) {
+			t.Errorf("delete missing image: %v", err)
+		}
+		if err := e.DeleteImages([]int{int(a)}); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+
+		if ids, total := listIDs(t, e.ImageService, "photos", nil, model.Pagination{Page: 1, PageSize: 10}); !slices.Equal(ids, []uint64{b}) || total != 1 {
+			t.Errorf("list after delete = %v, %d", ids, total)
+		}
+		if e.Storage.Exists(service.TenantBucket(service.DefaultTenantID, "photos"), image.ImageCode+".png") {
+			t.Error("original not deleted")
+		}
+		if e.Storage.Exists(service.TenantBucket(service.DefaultTenantID, config.C.Thumbnail.Bucket), image.ThumbnailCode+".png") {
+			t.Error("thumbnail not deleted")
+		}
+		if counts := tagCounts(t, e.ImageService); counts["cat"] != 1 {
+			t.Errorf("cat count = %d", counts["cat"])
+		}
+
+		// 相册中的关联和封面一并清除
+		album, err := albums.GetAlbum(albumID)
+		if err != nil || album.CoverImageID != 0 {
+			t.Errorf("album = %+v, %v", album, err)
+		}
+		list, total, err := albums.GetAlbumImages(albumID, model.Pagination{Page: 1, PageSize: 10})
+		if err != nil || total != 1 || list[0].ID != b {
+			t.Errorf("album images = %v, %d, %v", list, total, err)
+		}
+	})
+}
+
+// 删除指定图片时失败，用于验证事务回滚
+type failingStore struct {
+	service.Store
+	failID uint64
+}
+
+func (s failingStore) Images() service.ImageRepository {
+	return failingImages{s.Store.Images(), s.failID}
+}
+
+func (s failingStore) Transaction(fn func(store service.Store) error) error {
+	return s.Store.Transaction(func(store service.Store) error {
+		return fn(failingStore{store, s.failID})
+	})
+}
+
+type failingImages struct {
+	service.ImageRepository
+	failID uint64
+}
+
+func (repo failingImages) Delete(id uint64) error {
+	if id == repo.failID {
+		return errors.New("delete failed")
+	}
+	return repo.ImageRepository.Delete(id)
+}
+
+func TestDeleteImagesRollback(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		a := e.upload(t, "photos", 10)
+		b := e.upload(t, "photos", 20)
+		images, err := e.Store.Images().FindByIDs(service.DefaultTenantID, []uint64{a})
+		if err != nil || len(images) != 1 {
+			t.Fatalf("find image: %v, %v", images, err)
+		}
+
+		failing := service.NewImageService(e.Storage, failingStore{e.Store, b}, e.Clock).As(adminActor)
+		if err := failing.DeleteImages([]int{int(a), int(b)}); err == nil {
+			t.Fatal("delete succeeded")
+		}
+		// 记录回滚后文件仍然存在
+		if ids, _ := listIDs(t, e.ImageService, "photos", nil, model.Pagination{Page: 1, PageSize: 10}); len(ids) != 2 {
+			t.Errorf("list after rollback = %v", ids)
+		}
+		if !e.Storage.Exists(service.TenantBucket(service.DefaultTenantID, "photos"), images[0].ImageCode+".png") {
+			t.Error("original deleted by rolled back transaction")
+		}
+		if !e.Storage.Exists(service.TenantBucket(service.DefaultTenantID, config.C.Thumbnail.Bucket), images[0].ThumbnailCode+".png") {
+			t.Error("thumbnail deleted by rolled back transaction")
+		}
+	})
+}
+
+// 像素相同、编码不同的两张图片，内容不同而缩略图相同
+func sharedThumbnailPNGs(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	var compressed, uncompressed bytes.Buffer
+	if err := png.Encode(&compressed, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(&uncompressed, img); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes(), uncompressed.Bytes()
+}
+
+func TestDeleteImagesSharedThumbnail(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		compressed, uncompressed := sharedThumbnailPNGs(t)
+		a, err := e.SaveImage("photos", fileHeader(t, "a.png", compressed), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := e.SaveImage("photos", fileHeader(t, "b.png", uncompressed), nil)
+		if err != nil || a == b {
+			t.Fatalf("save b = %d, %v", b, err)
+		}
+		images, err := e.Store.Images().FindByIDs(service.DefaultTenantID, []uint64{a, b})
+		if err != nil || len(images) != 2 || images[0].ThumbnailCode != images[1].ThumbnailCode {
+			t.Fatalf("images = %+v, %v", images, err)
+		}
+		thumbnailBucket := service.TenantBucket(service.DefaultTenantID, config.C.Thumbnail.Bucket)
+		thumbnail := images[0].ThumbnailCode + ".png"
+
+		if err := e.DeleteImages([]int{int(a)}); err != nil {
+			t.Fatal(err)
+		}
+		if !e.Storage.Exists(thumbnailBucket, thumbnail) {
+			t.Error("shared thumbnail deleted")
+		}
+		if err := e.DeleteImages([]int{int(b)}); err != nil {
+			t.Fatal(err)
+		}
+		if e.Storage.Exists(thumbnailBucket, thumbnail) {
+			t.Error("thumbnail not deleted with the last image")
+		}
+	})
+}
+
+// 事务中的操作全部成功后提交失败
+type commitFailingStore struct {
+	service.Store
+}
+
+func (s commitFailingStore) Transaction(fn func(store service.Store) error) error {
+	return s.Store.Transaction(func(store service.Store) error {
+		if err := fn(store); err != nil {
+			return err
+		}
+		return errors.New("commit failed")
+	})
+}
+
+func TestSaveImageCommitFailure(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		compressed, uncompressed := sharedThumbnailPNGs(t)
+		a, err := e.SaveImage("photos", fileHeader(t, "a.png", compressed), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images, err := e.Store.Images().FindByIDs(service.DefaultTenantID, []uint64{a})
+		if err != nil || len(images) != 1 {
+			t.Fatalf("find image: %v, %v", images, err)
+		}
+
+		failing := service.NewImageService(e.Storage, commitFailingStore{e.Store}, e.Clock).As(adminActor)
+		if _, err := failing.SaveImage("photos", fileHeader(t, "b.png", uncompressed), nil); err == nil {
+			t.Fatal("save succeeded")
+		}
+		// 新上传的原图被清理，其他图片使用的缩略图保留
+		if e.Storage.Exists(service.TenantBucket(service.DefaultTenantID, "photos"), objectName(uncompressed)+".png") {
+			t.Error("original of failed upload not removed")
+		}
+		if !e.Storage.Exists(service.TenantBucket(service.DefaultTenantID, config.C.Thumbnail.Bucket), images[0].ThumbnailCode+".png") {
+			t.Error("shared thumbnail removed")
+		}
+		if ids, _ := listIDs(t, e.ImageService, "photos", nil, model.Pagination{Page: 1, PageSize: 10}); !slices.Equal(ids, []uint64{a}) {
+			t.Errorf("list = %v", ids)
+		}
+	})
+}
+
+// 与存储相同，以内容的 MD5 命名对象
+func objectName(data []byte) string {
+	hash := md5.Sum(data)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,70 @@
+//go:build integration
+
+// 在真实的 MySQL 或 PostgreSQL 上运行全部服务测试，验证各方言下的标签过滤、统计和自动补全，连接信息通过配置文件或环境变量指定：
+//
+//	PS_DB_DRIVER=postgres PS_DB_DSN="host=127.0.0.1 user=postgres dbname=ps_test sslmode=disable" go test -tags integration ./service
+//	PS_DB_DRIVER=mysql MYSQL_HOST=127.0.0.1 MYSQL_USERNAME=root MYSQL_DATABASE=ps_test go test -tags integration ./service
+//
+// 每个测试都会删除数据库中的所有表，只能使用专门的测试库
+package service_test
+
+import (
+	"os"
+	"picture_storage/config"
+	"picture_storage/db"
+	"picture_storage/model"
+	"picture_storage/service"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	stores = append(stores, struct {
+		name string
+		new  func(t *testing.T, users []model.UserModel) service.Store
+	}{"integration", integrationStore})
+}
+
+// 按配置连接测试库，清空后执行正式的迁移脚本
+func integrationStore(t *testing.T, users []model.UserModel) service.Store {
+	cfg, err := config.Load(os.Getenv("PS_CONFIG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DB.Driver == "sqlite" {
+		t.Skip("SQLite 已经由 sqlite 子测试覆盖")
+	}
+	previous := config.C
+	config.C = cfg
+	defer func() { config.C = previous }()
+
+	if err := db.Init(); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	conn := db.DB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	tables, err := conn.Migrator().GetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		if err := conn.Migrator().DropTable(table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, user := range users {
+		if err := conn.Create(&user).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	return service.NewGormStore(conn)
+}
@@ -0,0 +1,296 @@
+package memory
+
+import (
+	"picture_storage/model"
+	"picture_storage/service"
+	"slices"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type albumRepository struct {
+	s *Store
+}
+
+func (repo albumRepository) List(tenantID uint64) ([]model.AlbumModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	albums := make([]model.AlbumModel, 0)
+	for _, album := range repo.s.data.albums {
+		if album.TenantID == tenantID {
+			albums = append(albums, album)
+		}
+	}
+	sort.SliceStable(albums, func(i, j int) bool {
+		return albums[i].CreatedAt.After(albums[j].CreatedAt)
+	})
+	return albums, nil
+}
+
+func (repo albumRepository) FindByID(tenantID, id uint64) (model.AlbumModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, album := range repo.s.data.albums {
+		if album.ID == id && album.TenantID == tenantID {
+			return album, nil
+		}
+	}
+	return model.AlbumModel{}, gorm.ErrRecordNotFound
+}
+
+func (repo albumRepository) Create(album *model.AlbumModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	album.ID = repo.s.newID()
+	repo.s.data.albums = append(repo.s.data.albums, *album)
+	return nil
+}
+
+func (repo albumRepository) Update(album *model.AlbumModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for i := range repo.s.data.albums {
+		if repo.s.data.albums[i].ID == album.ID {
+			repo.s.data.albums[i].Title = album.Title
+			repo.s.data.albums[i].Description = album.Description
+			repo.s.data.albums[i].CoverImageID = album.CoverImageID
+			repo.s.data.albums[i].UpdatedAt = album.UpdatedAt
+		}
+	}
+	return nil
+}
+
+func (repo albumRepository) Delete(id uint64) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.albumImages = slices.DeleteFunc(repo.s.data.albumImages, func(albumImage model.AlbumImageModel) bool {
+		return albumImage.AlbumID == id
+	})
+	repo.s.data.albums = slices.DeleteFunc(repo.s.data.albums, func(album model.AlbumModel) bool {
+		return album.ID == id
+	})
+	return nil
+}
+
+func (repo albumRepository) Images(albumID uint64) ([]model.AlbumImageModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	albumImages := make([]model.AlbumImageModel, 0)
+	for _, albumImage := range repo.s.data.albumImages {
+		if albumImage.AlbumID == albumID {
+			albumImages = append(albumImages, albumImage)
+		}
+	}
+	sort.SliceStable(albumImages, func(i, j int) bool {
+		return albumImages[i].Position < albumImages[j].Position
+	})
+	return albumImages, nil
+}
+
+func (repo albumRepository) FirstImage(albumID uint64) (model.AlbumImageModel, error) {
+	albumImages, _ := repo.Images(albumID)
+	if len(albumImages) == 0 {
+		return model.AlbumImageModel{}, gorm.ErrRecordNotFound
+	}
+	return albumImages[0], nil
+}
+
+func (repo albumRepository) FindImage(albumID, imageID uint64) (model.AlbumImageModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	i := repo.s.albumImageIndex(albumID, imageID)
+	if i < 0 {
+		return model.AlbumImageModel{}, gorm.ErrRecordNotFound
+	}
+	return repo.s.data.albumImages[i], nil
+}
+
+func (repo albumRepository) ImageCount(albumID uint64) (int64, error) {
+	albumImages, _ := repo.Images(albumID)
+	return int64(len(albumImages)), nil
+}
+
+func (repo albumRepository) AddImage(albumImage *model.AlbumImageModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	// 与数据库的唯一索引 (album_id, image_id) 保持一致
+	if repo.s.albumImageIndex(albumImage.AlbumID, albumImage.ImageID) >= 0 {
+		return ErrDuplicateKey
+	}
+	albumImage.ID = repo.s.newID()
+	repo.s.data.albumImages = append(repo.s.data.albumImages, *albumImage)
+	return nil
+}
+
+func (repo albumRepository) RemoveImages(albumID uint64, imageIDs []uint64) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.albumImages = slices.DeleteFunc(repo.s.data.albumImages, func(albumImage model.AlbumImageModel) bool {
+		return albumImage.AlbumID == albumID && slices.Contains(imageIDs, albumImage.ImageID)
+	})
+	for i, album := range repo.s.data.albums {
+		if album.ID == albumID && slices.Contains(imageIDs, album.CoverImageID) {
+			repo.s.data.albums[i].CoverImageID = 0
+		}
+	}
+	return nil
+}
+
+func (repo albumRepository) SetPosition(albumImageID uint64, position int) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for i := range repo.s.data.albumImages {
+		if repo.s.data.albumImages[i].ID == albumImageID {
+			repo.s.data.albumImages[i].Position = position
+		}
+	}
+	return nil
+}
+
+type shareRepository struct {
+	s *Store
+}
+
+func (repo shareRepository) Create(share *model.ShareModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	// 与数据库的唯一索引 (token) 保持一致
+	for _, existing := range repo.s.data.shares {
+		if existing.Token == share.Token {
+			return ErrDuplicateKey
+		}
+	}
+	share.ID = repo.s.newID()
+	repo.s.data.shares = append(repo.s.data.shares, *share)
+	return nil
+}
+
+// 租户内的分享，createdBy 不为 0 时只包含该用户创建的
+func owned(share model.ShareModel, tenantID, createdBy uint64) bool {
+	return share.TenantID == tenantID && (createdBy == 0 || share.CreatedBy == createdBy)
+}
+
+func (repo shareRepository) List(tenantID, createdBy uint64) ([]model.ShareModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	shares := make([]model.ShareModel, 0)
+	for _, share := range repo.s.data.shares {
+		if owned(share, tenantID, createdBy) {
+			shares = append(shares, share)
+		}
+	}
+	sort.SliceStable(shares, func(i, j int) bool {
+		return shares[i].CreatedAt.After(shares[j].CreatedAt)
+	})
+	return shares, nil
+}
+
+func (repo shareRepository) FindByToken(token string) (model.ShareModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, share := range repo.s.data.shares {
+		if share.Token == token {
+			return share, nil
+		}
+	}
+	return model.ShareModel{}, gorm.ErrRecordNotFound
+}
+
+func (repo shareRepository) Revoke(tenantID, createdBy, id uint64) (bool, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for i, share := range repo.s.data.shares {
+		if share.ID == id && owned(share, tenantID, createdBy) {
+			repo.s.data.shares[i].Revoked = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (repo shareRepository) AddView(id uint64) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for i := range repo.s.data.shares {
+		if repo.s.data.shares[i].ID == id {
+			repo.s.data.shares[i].ViewCount++
+		}
+	}
+	return nil
+}
+
+type randomRepository struct {
+	s *Store
+}
+
+func (repo randomRepository) ServeHistory(filter service.ImageFilter, since time.Time) ([]model.ImageServeHistoryModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	imageIDs := repo.s.matchedImageIDs(filter)
+	history := make([]model.ImageServeHistoryModel, 0)
+	for _, served := range repo.s.data.serveHistory {
+		if imageIDs[served.ImageID] && !served.ServedAt.Before(since) {
+			history = append(history, served)
+		}
+	}
+	return history, nil
+}
+
+func (repo randomRepository) RecordServed(history []model.ImageServeHistoryModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for i := range history {
+		history[i].ID = repo.s.newID()
+		repo.s.data.serveHistory = append(repo.s.data.serveHistory, history[i])
+	}
+	return nil
+}
+
+func (repo randomRepository) PurgeServeHistory(before time.Time) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.serveHistory = slices.DeleteFunc(repo.s.data.serveHistory, func(served model.ImageServeHistoryModel) bool {
+		return served.ServedAt.Before(before)
+	})
+	return nil
+}
+
+func (repo randomRepository) SessionImages(sessionKey string) ([]uint64, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	imageIDs := make([]uint64, 0)
+	for _, session := range repo.s.data.sessions {
+		if session.SessionKey == sessionKey {
+			imageIDs = append(imageIDs, session.ImageID)
+		}
+	}
+	return imageIDs, nil
+}
+
+func (repo randomRepository) AddSessionImage(session *model.RandomSessionModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	session.ID = repo.s.newID()
+	repo.s.data.sessions = append(repo.s.data.sessions, *session)
+	return nil
+}
+
+func (repo randomRepository) ClearSession(sessionKey string) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.sessions = slices.DeleteFunc(repo.s.data.sessions, func(session model.RandomSessionModel) bool {
+		return session.SessionKey == sessionKey
+	})
+	return nil
+}
+
+func (repo randomRepository) PurgeSessions(before time.Time) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.sessions = slices.DeleteFunc(repo.s.data.sessions, func(session model.RandomSessionModel) bool {
+		return session.CreatedAt.Before(before)
+	})
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package memory 提供 service 依赖的内存实现，用于测试和本地调试
+package memory
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// 内存中的对象存储，行为与 minio.Client 一致：以内容的 MD5 命名对象，bucket 按需创建
+type Storage struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+	// 不为空时 GetObjectURL 返回该错误，用于测试签名失败
+	URLError error
+}
+
+func NewStorage() *Storage {
+	return &Storage{buckets: make(map[string]map[string][]byte)}
+}
+
+func (s *Storage) UploadFile(bucket, originalFilename string, size int64, content io.Reader, contentType string) (string, int64, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", 0, err
+	}
+	return s.UploadFileBytes(bucket, originalFilename, size, data, contentType)
+}
+
+func (s *Storage) UploadFileBytes(bucket, originalFilename string, size int64, content []byte, contentType string) (string, int64, error) {
+	hash := md5.Sum(content)
+	objectName := hex.EncodeToString(hash[:]) + filepath.Ext(originalFilename)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		objects = make(map[string][]byte)
+		s.buckets[bucket] = objects
+	}
+	if existing, ok := objects[objectName]; ok {
+		return objectName, int64(len(existing)), nil
+	}
+	objects[objectName] = bytes.Clone(content)
+	return objectName, int64(len(content)), nil
+}
+
+func (s *Storage) GetDirectoryList() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.buckets))
+	for name := range s.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Storage) GetFile(bucket, object string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.buckets[bucket][object]
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: %w", bucket, object, fs.ErrNotExist)
+	}
+	return bytes.Clone(data), nil
+}
+
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
+
+func (s *Storage) OpenFile(bucket, object string) (io.ReadSeekCloser, error) {
+	data, err := s.GetFile(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	return readSeekNopCloser{bytes.NewReader(data)}, nil
+}
+
+func (s *Storage) GetObjectURL(bucket, object string) (string, error) {
+	if s.URLError != nil {
+		return "", s.URLError
+	}
+	return "memory://" + bucket + "/" + object, nil
+}
+
+// 与 MinIO 一样，删除不存在的对象不报错
+func (s *Storage) DeleteFile(bucket, object string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[bucket], object)
+	return nil
+}
+
+// 对象是否存在，方便测试断言
+func (s *Storage) Exists(bucket, object string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.buckets[bucket][object]
+	return ok
+}
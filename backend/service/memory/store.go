@@ -0,0 +1,539 @@
+package memory
+
+import (
+	"errors"
+	"picture_storage/model"
+	"picture_storage/service"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// 违反唯一约束时返回
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// 内存中的业务数据，与数据库表一一对应，不包含租户、会话和 API Key
+// 事务通过快照实现：fn 返回错误时恢复到开始前的数据，同一时间只执行一个事务
+type Store struct {
+	txMu sync.Mutex
+	mu   sync.Mutex
+	data tables
+}
+
+type tables struct {
+	nextID       uint64
+	images       []model.ImageModel
+	tags         []model.TagModel
+	imageTags    []model.ImageTagModel
+	aliases      []model.TagAliasModel
+	categories   []model.TagCategoryModel
+	quotas       []model.QuotaModel
+	permissions  []model.DirectoryPermissionModel
+	autoTags     []model.DirectoryAutoTagModel
+	albums       []model.AlbumModel
+	albumImages  []model.AlbumImageModel
+	shares       []model.ShareModel
+	serveHistory []model.ImageServeHistoryModel
+	sessions     []model.RandomSessionModel
+	users        []model.UserModel
+}
+
+func (t tables) clone() tables {
+	return tables{
+		nextID:       t.nextID,
+		images:       slices.Clone(t.images),
+		tags:         slices.Clone(t.tags),
+		imageTags:    slices.Clone(t.imageTags),
+		aliases:      slices.Clone(t.aliases),
+		categories:   slices.Clone(t.categories),
+		quotas:       slices.Clone(t.quotas),
+		permissions:  slices.Clone(t.permissions),
+		autoTags:     slices.Clone(t.autoTags),
+		albums:       slices.Clone(t.albums),
+		albumImages:  slices.Clone(t.albumImages),
+		shares:       slices.Clone(t.shares),
+		serveHistory: slices.Clone(t.serveHistory),
+		sessions:     slices.Clone(t.sessions),
+		users:        slices.Clone(t.users),
+	}
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+func (s *Store) Images() service.ImageRepository {
+	return imageRepository{s}
+}
+
+func (s *Store) Tags() service.TagRepository {
+	return tagRepository{s}
+}
+
+func (s *Store) Albums() service.AlbumRepository {
+	return albumRepository{s}
+}
+
+func (s *Store) Shares() service.ShareRepository {
+	return shareRepository{s}
+}
+
+func (s *Store) Random() service.RandomRepository {
+	return randomRepository{s}
+}
+
+func (s *Store) Users() service.UserRepository {
+	return userRepository{s}
+}
+
+func (s *Store) Transaction(fn func(store service.Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.data.clone()
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.data = snapshot
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// 分配自增 ID，调用方需持有 mu
+func (s *Store) newID() uint64 {
+	s.data.nextID++
+	return s.data.nextID
+}
+
+// 以下方法用于准备测试数据，ID 为 0 时自动分配
+
+func (s *Store) AddTagAlias(alias model.TagAliasModel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if alias.ID == 0 {
+		alias.ID = s.newID()
+	}
+	s.data.aliases = append(s.data.aliases, alias)
+}
+
+func (s *Store) AddTagCategory(category model.TagCategoryModel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if category.ID == 0 {
+		category.ID = s.newID()
+	}
+	s.data.categories = append(s.data.categories, category)
+}
+
+func (s *Store) AddQuota(quota model.QuotaModel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if quota.ID == 0 {
+		quota.ID = s.newID()
+	}
+	s.data.quotas = append(s.data.quotas, quota)
+}
+
+func (s *Store) AddDirectoryPermission(permission model.DirectoryPermissionModel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if permission.ID == 0 {
+		permission.ID = s.newID()
+	}
+	s.data.permissions = append(s.data.permissions, permission)
+}
+
+func (s *Store) AddAutoTagSetting(setting model.DirectoryAutoTagModel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if setting.ID == 0 {
+		setting.ID = s.newID()
+	}
+	s.data.autoTags = append(s.data.autoTags, setting)
+}
+
+func (s *Store) AddUser(user model.UserModel) model.UserModel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user.ID == 0 {
+		user.ID = s.newID()
+	}
+	s.data.users = append(s.data.users, user)
+	return user
+}
+
+// 图片是否匹配查询条件，与 gorm 实现的 imageQuery 保持一致，调用方需持有 mu
+func (s *Store) matches(filter service.ImageFilter, image model.ImageModel) bool {
+	if image.TenantID != filter.TenantID {
+		return false
+	}
+	if filter.Directory != "" && image.Directory != filter.Directory {
+		return false
+	}
+	if len(filter.IDs) > 0 && !slices.Contains(filter.IDs, image.ID) {
+		return false
+	}
+	if slices.Contains(filter.ExcludeIDs, image.ID) {
+		return false
+	}
+	if len(filter.Tags) > 0 {
+		names := s.imageTagNames(image.ID, filter.TenantID)
+		for _, name := range filter.Tags {
+			if !slices.Contains(names, name) {
+				return false
+			}
+		}
+	}
+	if filter.AlbumID != 0 && s.albumImageIndex(filter.AlbumID, image.ID) < 0 {
+		return false
+	}
+	if filter.ExcludeSession != "" && slices.ContainsFunc(s.data.sessions, func(session model.RandomSessionModel) bool {
+		return session.SessionKey == filter.ExcludeSession && session.ImageID == image.ID
+	}) {
+		return false
+	}
+	if filter.Viewer != nil {
+		restricted, granted := false, false
+		for _, permission := range s.data.permissions {
+			if permission.TenantID != filter.TenantID || permission.Directory != image.Directory {
+				continue
+			}
+			restricted = true
+			if permission.UserID == filter.Viewer.UserID {
+				granted = true
+			}
+		}
+		if restricted && !granted {
+			return false
+		}
+	}
+	return true
+}
+
+// 按 ID 升序返回匹配的图片，调用方需持有 mu
+func (s *Store) matchedImages(filter service.ImageFilter) []model.ImageModel {
+	images := make([]model.ImageModel, 0)
+	for _, image := range s.data.images {
+		if s.matches(filter, image) {
+			images = append(images, image)
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].ID < images[j].ID
+	})
+	return images
+}
+
+// 匹配图片的 ID 集合，调用方需持有 mu
+func (s *Store) matchedImageIDs(filter service.ImageFilter) map[uint64]bool {
+	ids := make(map[uint64]bool)
+	for _, image := range s.matchedImages(filter) {
+		ids[image.ID] = true
+	}
+	return ids
+}
+
+// 图片在租户内的标签名，调用方需持有 mu
+func (s *Store) imageTagNames(imageID, tenantID uint64) []string {
+	names := make([]string, 0)
+	for _, imageTag := range s.data.imageTags {
+		if imageTag.ImageID != imageID {
+			continue
+		}
+		if tag, ok := s.tag(imageTag.TagID); ok && tag.TenantID == tenantID {
+			names = append(names, tag.TagName)
+		}
+	}
+	return names
+}
+
+// 调用方需持有 mu
+func (s *Store) tag(id uint64) (model.TagModel, bool) {
+	for _, tag := range s.data.tags {
+		if tag.ID == id {
+			return tag, true
+		}
+	}
+	return model.TagModel{}, false
+}
+
+// 相册中图片关联的下标，不存在时返回 -1，调用方需持有 mu
+func (s *Store) albumImageIndex(albumID, imageID uint64) int {
+	return slices.IndexFunc(s.data.albumImages, func(albumImage model.AlbumImageModel) bool {
+		return albumImage.AlbumID == albumID && albumImage.ImageID == imageID
+	})
+}
+
+type imageRepository struct {
+	s *Store
+}
+
+func (repo imageRepository) FindByIDs(tenantID uint64, ids []uint64) ([]model.ImageModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	images := make([]model.ImageModel, 0)
+	for _, image := range repo.s.data.images {
+		if image.TenantID == tenantID && slices.Contains(ids, image.ID) {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (repo imageRepository) find(match func(image model.ImageModel) bool) (model.ImageModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, image := range repo.s.data.images {
+		if match(image) {
+			return image, nil
+		}
+	}
+	return model.ImageModel{}, gorm.ErrRecordNotFound
+}
+
+func (repo imageRepository) FindByCode(tenantID uint64, code string) (model.ImageModel, error) {
+	return repo.find(func(image model.ImageModel) bool {
+		return image.TenantID == tenantID && image.ImageCode == code
+	})
+}
+
+func (repo imageRepository) FindByFile(tenantID uint64, directory, code, ext string) (model.ImageModel, error) {
+	return repo.find(func(image model.ImageModel) bool {
+		return image.TenantID == tenantID && image.Directory == directory && image.ImageCode == code && image.Ext == ext
+	})
+}
+
+func (repo imageRepository) FindByThumbnail(tenantID uint64, code, ext string) (model.ImageModel, error) {
+	return repo.find(func(image model.ImageModel) bool {
+		return image.TenantID == tenantID && image.ThumbnailCode == code && image.Ext == ext
+	})
+}
+
+func (repo imageRepository) List(filter service.ImageFilter, page model.Pagination) ([]model.ImageModel, int64, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+
+	matched := repo.s.matchedImages(filter)
+	if filter.AlbumID != 0 {
+		position := make(map[uint64]int)
+		for _, albumImage := range repo.s.data.albumImages {
+			if albumImage.AlbumID == filter.AlbumID {
+				position[albumImage.ImageID] = albumImage.Position
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			return position[matched[i].ID] < position[matched[j].ID]
+		})
+	} else {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].CreatedAt.After(matched[j].CreatedAt)
+		})
+	}
+
+	total := int64(len(matched))
+	start := min(max((page.Page-1)*page.PageSize, 0), len(matched))
+	end := len(matched)
+	if page.PageSize > 0 {
+		end = min(start+page.PageSize, len(matched))
+	}
+	return slices.Clone(matched[start:end]), total, nil
+}
+
+func (repo imageRepository) Find(filter service.ImageFilter) ([]model.ImageModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	return repo.s.matchedImages(filter), nil
+}
+
+func (repo imageRepository) Candidates(filter service.ImageFilter) ([]model.ImageModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	candidates := make([]model.ImageModel, 0)
+	for _, image := range repo.s.matchedImages(filter) {
+		candidates = append(candidates, model.ImageModel{
+			ID:        image.ID,
+			Directory: image.Directory,
+			CreatedAt: image.CreatedAt,
+		})
+	}
+	return candidates, nil
+}
+
+func (repo imageRepository) Count(filter service.ImageFilter) (int64, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	return int64(len(repo.s.matchedImages(filter))), nil
+}
+
+func (repo imageRepository) IDAt(filter service.ImageFilter, offset int64) (uint64, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	images := repo.s.matchedImages(filter)
+	if offset < 0 || offset >= int64(len(images)) {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return images[offset].ID, nil
+}
+
+func (repo imageRepository) Directories(filter service.ImageFilter) ([]string, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	directories := make([]string, 0)
+	for _, image := range repo.s.matchedImages(filter) {
+		if !slices.Contains(directories, image.Directory) {
+			directories = append(directories, image.Directory)
+		}
+	}
+	return directories, nil
+}
+
+func (repo imageRepository) Create(image *model.ImageModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	image.ID = repo.s.newID()
+	repo.s.data.images = append(repo.s.data.images, *image)
+	return nil
+}
+
+func (repo imageRepository) Delete(id uint64) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.imageTags = slices.DeleteFunc(repo.s.data.imageTags, func(imageTag model.ImageTagModel) bool {
+		return imageTag.ImageID == id
+	})
+	repo.s.data.albumImages = slices.DeleteFunc(repo.s.data.albumImages, func(albumImage model.AlbumImageModel) bool {
+		return albumImage.ImageID == id
+	})
+	for i := range repo.s.data.albums {
+		if repo.s.data.albums[i].CoverImageID == id {
+			repo.s.data.albums[i].CoverImageID = 0
+		}
+	}
+	repo.s.data.images = slices.DeleteFunc(repo.s.data.images, func(image model.ImageModel) bool {
+		return image.ID == id
+	})
+	return nil
+}
+
+func (repo imageRepository) Usage(tenantID uint64, scope, target string) (int64, int64, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	var bytes, images int64
+	for _, image := range repo.s.data.images {
+		if image.TenantID != tenantID {
+			continue
+		}
+		if scope == model.QuotaScopeDirectory && image.Directory != target {
+			continue
+		}
+		if scope == model.QuotaScopeUser && strconv.FormatUint(image.UploaderID, 10) != target {
+			continue
+		}
+		bytes += image.Size
+		images++
+	}
+	return bytes, images, nil
+}
+
+func (repo imageRepository) Quota(tenantID uint64, scope, target string) (model.QuotaModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, quota := range repo.s.data.quotas {
+		if quota.TenantID == tenantID && quota.Scope == scope && quota.Target == target {
+			return quota, nil
+		}
+	}
+	return model.QuotaModel{}, gorm.ErrRecordNotFound
+}
+
+func (repo imageRepository) Quotas(tenantID uint64, scope string) ([]model.QuotaModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	quotas := make([]model.QuotaModel, 0)
+	for _, quota := range repo.s.data.quotas {
+		if quota.TenantID == tenantID && quota.Scope == scope {
+			quotas = append(quotas, quota)
+		}
+	}
+	return quotas, nil
+}
+
+func (repo imageRepository) CreateQuota(quota *model.QuotaModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	// 与数据库的唯一索引 (tenant_id, scope, target) 保持一致
+	for _, existing := range repo.s.data.quotas {
+		if existing.TenantID == quota.TenantID && existing.Scope == quota.Scope && existing.Target == quota.Target {
+			return ErrDuplicateKey
+		}
+	}
+	quota.ID = repo.s.newID()
+	repo.s.data.quotas = append(repo.s.data.quotas, *quota)
+	return nil
+}
+
+func (repo imageRepository) DeleteQuota(tenantID uint64, scope, target string) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.quotas = slices.DeleteFunc(repo.s.data.quotas, func(quota model.QuotaModel) bool {
+		return quota.TenantID == tenantID && quota.Scope == scope && quota.Target == target
+	})
+	return nil
+}
+
+func (repo imageRepository) DirectoryPermissions(tenantID uint64, directory string) ([]model.DirectoryPermissionModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	permissions := make([]model.DirectoryPermissionModel, 0)
+	for _, permission := range repo.s.data.permissions {
+		if permission.TenantID == tenantID && permission.Directory == directory {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions, nil
+}
+
+func (repo imageRepository) CreateDirectoryPermission(permission *model.DirectoryPermissionModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	// 与数据库的唯一索引 (tenant_id, directory, user_id) 保持一致
+	for _, existing := range repo.s.data.permissions {
+		if existing.TenantID == permission.TenantID && existing.Directory == permission.Directory && existing.UserID == permission.UserID {
+			return ErrDuplicateKey
+		}
+	}
+	permission.ID = repo.s.newID()
+	repo.s.data.permissions = append(repo.s.data.permissions, *permission)
+	return nil
+}
+
+func (repo imageRepository) DeleteDirectoryPermission(tenantID uint64, directory string, userID uint64) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.permissions = slices.DeleteFunc(repo.s.data.permissions, func(permission model.DirectoryPermissionModel) bool {
+		return permission.TenantID == tenantID && permission.Directory == directory && permission.UserID == userID
+	})
+	return nil
+}
+
+type userRepository struct {
+	s *Store
+}
+
+func (repo userRepository) FindByID(tenantID, id uint64) (model.UserModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, user := range repo.s.data.users {
+		if user.ID == id && user.TenantID == tenantID {
+			return user, nil
+		}
+	}
+	return model.UserModel{}, gorm.ErrRecordNotFound
+}
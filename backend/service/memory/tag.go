@@ -0,0 +1,473 @@
+package memory
+
+import (
+	"picture_storage/model"
+	"picture_storage/service"
+	"slices"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type tagRepository struct {
+	s *Store
+}
+
+func (repo tagRepository) List(tenantID uint64) ([]model.TagModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	tags := make([]model.TagModel, 0)
+	for _, tag := range repo.s.data.tags {
+		if tag.TenantID == tenantID {
+			tags = append(tags, tag)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].CreatedAt.Before(tags[j].CreatedAt)
+	})
+	return tags, nil
+}
+
+func (repo tagRepository) FindByName(tenantID uint64, name string) (model.TagModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, tag := range repo.s.data.tags {
+		if tag.TenantID == tenantID && tag.TagName == name {
+			return tag, nil
+		}
+	}
+	return model.TagModel{}, gorm.ErrRecordNotFound
+}
+
+func (repo tagRepository) FindByNames(tenantID uint64, names []string) ([]model.TagModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	tags := make([]model.TagModel, 0)
+	for _, tag := range repo.s.data.tags {
+		if tag.TenantID == tenantID && slices.Contains(names, tag.TagName) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (repo tagRepository) FindByIDs(ids []uint64) ([]model.TagModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	tags := make([]model.TagModel, 0)
+	for _, tag := range repo.s.data.tags {
+		if slices.Contains(ids, tag.ID) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (repo tagRepository) ResolveAliases(tenantID uint64, names []string) (map[string]string, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	aliasMap := make(map[string]string)
+	for _, alias := range repo.s.data.aliases {
+		if !slices.Contains(names, alias.AliasName) {
+			continue
+		}
+		if tag, ok := repo.s.tag(alias.TagID); ok && tag.TenantID == tenantID {
+			aliasMap[alias.AliasName] = tag.TagName
+		}
+	}
+	return aliasMap, nil
+}
+
+func (repo tagRepository) Create(tag *model.TagModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	// 与数据库的唯一索引 (tenant_id, tag_name) 保持一致
+	for _, existing := range repo.s.data.tags {
+		if existing.TenantID == tag.TenantID && existing.TagName == tag.TagName {
+			return ErrDuplicateKey
+		}
+	}
+	tag.ID = repo.s.newID()
+	repo.s.data.tags = append(repo.s.data.tags, *tag)
+	return nil
+}
+
+func (repo tagRepository) Update(tag *model.TagModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, existing := range repo.s.data.tags {
+		if existing.ID != tag.ID && existing.TenantID == tag.TenantID && existing.TagName == tag.TagName {
+			return ErrDuplicateKey
+		}
+	}
+	for i := range repo.s.data.tags {
+		if repo.s.data.tags[i].ID == tag.ID {
+			repo.s.data.tags[i].TagName = tag.TagName
+			repo.s.data.tags[i].Category = tag.Category
+		}
+	}
+	return nil
+}
+
+func (repo tagRepository) Delete(id uint64) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.imageTags = slices.DeleteFunc(repo.s.data.imageTags, func(imageTag model.ImageTagModel) bool {
+		return imageTag.TagID == id
+	})
+	repo.s.data.aliases = slices.DeleteFunc(repo.s.data.aliases, func(alias model.TagAliasModel) bool {
+		return alias.TagID == id
+	})
+	repo.s.data.tags = slices.DeleteFunc(repo.s.data.tags, func(tag model.TagModel) bool {
+		return tag.ID == id
+	})
+	return nil
+}
+
+func (repo tagRepository) Merge(sourceID, targetID uint64) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	// 已经拥有目标标签的图片，直接删除源标签关联，避免重复
+	targetImages := make(map[uint64]bool)
+	for _, imageTag := range repo.s.data.imageTags {
+		if imageTag.TagID == targetID {
+			targetImages[imageTag.ImageID] = true
+		}
+	}
+	repo.s.data.imageTags = slices.DeleteFunc(repo.s.data.imageTags, func(imageTag model.ImageTagModel) bool {
+		return imageTag.TagID == sourceID && targetImages[imageTag.ImageID]
+	})
+	for i := range repo.s.data.imageTags {
+		if repo.s.data.imageTags[i].TagID == sourceID {
+			repo.s.data.imageTags[i].TagID = targetID
+		}
+	}
+	for i := range repo.s.data.aliases {
+		if repo.s.data.aliases[i].TagID == sourceID {
+			repo.s.data.aliases[i].TagID = targetID
+		}
+	}
+	repo.s.data.tags = slices.DeleteFunc(repo.s.data.tags, func(tag model.TagModel) bool {
+		return tag.ID == sourceID
+	})
+	return nil
+}
+
+// 每个标签在匹配图片上的使用次数，调用方需持有 mu
+func (s *Store) tagCounts(filter service.ImageFilter) map[uint64]int64 {
+	imageIDs := s.matchedImageIDs(filter)
+	counts := make(map[uint64]int64)
+	for _, imageTag := range s.data.imageTags {
+		if imageIDs[imageTag.ImageID] {
+			counts[imageTag.TagID]++
+		}
+	}
+	return counts
+}
+
+func (repo tagRepository) Counts(filter service.ImageFilter) (map[uint64]int64, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	return repo.s.tagCounts(filter), nil
+}
+
+// 与数据库中 LOWER(...) LIKE 的匹配一致，不区分大小写
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func (repo tagRepository) Search(filter service.ImageFilter, query string, includeUnused bool, limit int) ([]service.TagUsage, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+
+	counts := repo.s.tagCounts(filter)
+	rank := make(map[string]int)
+	rows := make([]service.TagUsage, 0)
+	for _, tag := range repo.s.data.tags {
+		if tag.TenantID != filter.TenantID {
+			continue
+		}
+		// 别名命中时返回其规范标签
+		matched := containsFold(tag.TagName, query) || slices.ContainsFunc(repo.s.data.aliases, func(alias model.TagAliasModel) bool {
+			return alias.TagID == tag.ID && containsFold(alias.AliasName, query)
+		})
+		if !matched || (!includeUnused && counts[tag.ID] == 0) {
+			continue
+		}
+		name := strings.ToLower(tag.TagName)
+		switch {
+		case strings.HasPrefix(name, strings.ToLower(query)):
+			rank[tag.TagName] = 0
+		case strings.Contains(name, ":"+strings.ToLower(query)):
+			rank[tag.TagName] = 1
+		default:
+			rank[tag.TagName] = 2
+		}
+		rows = append(rows, service.TagUsage{Name: tag.TagName, Category: tag.Category, Count: counts[tag.ID]})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rank[rows[i].Name] != rank[rows[j].Name] {
+			return rank[rows[i].Name] < rank[rows[j].Name]
+		}
+		return usageLess(rows[i], rows[j])
+	})
+	return rows[:min(limit, len(rows))], nil
+}
+
+// 按使用次数倒序，同次数按名称升序
+func usageLess(a, b service.TagUsage) bool {
+	if a.Count != b.Count {
+		return a.Count > b.Count
+	}
+	return a.Name < b.Name
+}
+
+func (repo tagRepository) Related(filter service.ImageFilter, limit int) ([]service.TagUsage, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	rows := make([]service.TagUsage, 0)
+	for tagID, count := range repo.s.tagCounts(filter) {
+		tag, ok := repo.s.tag(tagID)
+		if !ok || slices.Contains(filter.Tags, tag.TagName) {
+			continue
+		}
+		rows = append(rows, service.TagUsage{Name: tag.TagName, Category: tag.Category, Count: count})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return usageLess(rows[i], rows[j])
+	})
+	return rows[:min(limit, len(rows))], nil
+}
+
+func (repo tagRepository) ImageTagNames(filter service.ImageFilter, names []string) (map[uint64][]string, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	result := make(map[uint64][]string)
+	if len(names) == 0 {
+		return result, nil
+	}
+	for imageID := range repo.s.matchedImageIDs(filter) {
+		for _, name := range repo.s.imageTagNames(imageID, filter.TenantID) {
+			if slices.Contains(names, strings.ToLower(name)) {
+				result[imageID] = append(result[imageID], name)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (repo tagRepository) ImageTags(imageIDs []uint64, includeSystem bool) ([]model.ImageTagModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	imageTags := make([]model.ImageTagModel, 0)
+	for _, imageTag := range repo.s.data.imageTags {
+		if slices.Contains(imageIDs, imageTag.ImageID) && (includeSystem || !imageTag.IsSystem) {
+			imageTags = append(imageTags, imageTag)
+		}
+	}
+	return imageTags, nil
+}
+
+func (repo tagRepository) FindImageTag(imageID, tagID uint64) (model.ImageTagModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, imageTag := range repo.s.data.imageTags {
+		if imageTag.ImageID == imageID && imageTag.TagID == tagID {
+			return imageTag, nil
+		}
+	}
+	return model.ImageTagModel{}, gorm.ErrRecordNotFound
+}
+
+func (repo tagRepository) SaveImageTag(imageTag *model.ImageTagModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	if imageTag.ID == 0 {
+		// 与数据库的唯一索引 (image_id, tag_id) 保持一致
+		for _, existing := range repo.s.data.imageTags {
+			if existing.ImageID == imageTag.ImageID && existing.TagID == imageTag.TagID {
+				return ErrDuplicateKey
+			}
+		}
+		imageTag.ID = repo.s.newID()
+		repo.s.data.imageTags = append(repo.s.data.imageTags, *imageTag)
+		return nil
+	}
+	for i := range repo.s.data.imageTags {
+		if repo.s.data.imageTags[i].ID == imageTag.ID {
+			repo.s.data.imageTags[i].IsSystem = imageTag.IsSystem
+		}
+	}
+	return nil
+}
+
+func (repo tagRepository) DeleteImageTags(imageID uint64, isSystem bool) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.imageTags = slices.DeleteFunc(repo.s.data.imageTags, func(imageTag model.ImageTagModel) bool {
+		return imageTag.ImageID == imageID && imageTag.IsSystem == isSystem
+	})
+	return nil
+}
+
+func (repo tagRepository) RemoveImageTags(imageIDs, tagIDs []uint64) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	repo.s.data.imageTags = slices.DeleteFunc(repo.s.data.imageTags, func(imageTag model.ImageTagModel) bool {
+		return slices.Contains(imageIDs, imageTag.ImageID) && slices.Contains(tagIDs, imageTag.TagID)
+	})
+	return nil
+}
+
+func (repo tagRepository) Aliases(tagID uint64) ([]string, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	aliases := make([]model.TagAliasModel, 0)
+	for _, alias := range repo.s.data.aliases {
+		if alias.TagID == tagID {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.SliceStable(aliases, func(i, j int) bool {
+		return aliases[i].CreatedAt.Before(aliases[j].CreatedAt)
+	})
+	names := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		names = append(names, alias.AliasName)
+	}
+	return names, nil
+}
+
+func (repo tagRepository) CreateAlias(alias *model.TagAliasModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	alias.ID = repo.s.newID()
+	repo.s.data.aliases = append(repo.s.data.aliases, *alias)
+	return nil
+}
+
+func (repo tagRepository) DeleteAlias(tenantID uint64, aliasName string) (bool, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	before := len(repo.s.data.aliases)
+	repo.s.data.aliases = slices.DeleteFunc(repo.s.data.aliases, func(alias model.TagAliasModel) bool {
+		tag, ok := repo.s.tag(alias.TagID)
+		return alias.AliasName == aliasName && ok && tag.TenantID == tenantID
+	})
+	return len(repo.s.data.aliases) < before, nil
+}
+
+func (repo tagRepository) Categories(tenantID uint64) ([]model.TagCategoryModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	categories := make([]model.TagCategoryModel, 0)
+	for _, category := range repo.s.data.categories {
+		if category.TenantID == tenantID {
+			categories = append(categories, category)
+		}
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		return categories[i].CreatedAt.Before(categories[j].CreatedAt)
+	})
+	return categories, nil
+}
+
+func (repo tagRepository) FindCategory(tenantID uint64, name string) (model.TagCategoryModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for _, category := range repo.s.data.categories {
+		if category.TenantID == tenantID && category.Name == name {
+			return category, nil
+		}
+	}
+	return model.TagCategoryModel{}, gorm.ErrRecordNotFound
+}
+
+func (repo tagRepository) CategoryExists(tenantID uint64, name string) (bool, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	return slices.ContainsFunc(repo.s.data.categories, func(category model.TagCategoryModel) bool {
+		return category.TenantID == tenantID && category.Name == name
+	}), nil
+}
+
+func (repo tagRepository) CreateCategory(category *model.TagCategoryModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	// 与数据库的唯一索引 (tenant_id, name) 保持一致
+	for _, existing := range repo.s.data.categories {
+		if existing.TenantID == category.TenantID && existing.Name == category.Name {
+			return ErrDuplicateKey
+		}
+	}
+	category.ID = repo.s.newID()
+	repo.s.data.categories = append(repo.s.data.categories, *category)
+
+	prefix := category.Name + ":"
+	for i, tag := range repo.s.data.tags {
+		if tag.TenantID == category.TenantID && tag.Category == "" && strings.HasPrefix(tag.TagName, prefix) {
+			repo.s.data.tags[i].Category = category.Name
+		}
+	}
+	return nil
+}
+
+func (repo tagRepository) UpdateCategory(category *model.TagCategoryModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for i := range repo.s.data.categories {
+		if repo.s.data.categories[i].ID == category.ID {
+			repo.s.data.categories[i].Color = category.Color
+		}
+	}
+	return nil
+}
+
+func (repo tagRepository) DeleteCategory(category model.TagCategoryModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	for i, tag := range repo.s.data.tags {
+		if tag.TenantID == category.TenantID && tag.Category == category.Name {
+			repo.s.data.tags[i].Category = ""
+		}
+	}
+	repo.s.data.categories = slices.DeleteFunc(repo.s.data.categories, func(existing model.TagCategoryModel) bool {
+		return existing.ID == category.ID
+	})
+	return nil
+}
+
+func (repo tagRepository) AutoTagSettings(tenantID uint64, directory string) ([]model.DirectoryAutoTagModel, error) {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	settings := make([]model.DirectoryAutoTagModel, 0)
+	for _, setting := range repo.s.data.autoTags {
+		if setting.TenantID == tenantID && setting.Directory == directory {
+			settings = append(settings, setting)
+		}
+	}
+	return settings, nil
+}
+
+func (repo tagRepository) SaveAutoTagSetting(setting *model.DirectoryAutoTagModel) error {
+	repo.s.mu.Lock()
+	defer repo.s.mu.Unlock()
+	if setting.ID == 0 {
+		// 与数据库的唯一索引 (tenant_id, directory, rule) 保持一致
+		for _, existing := range repo.s.data.autoTags {
+			if existing.TenantID == setting.TenantID && existing.Directory == setting.Directory && existing.Rule == setting.Rule {
+				return ErrDuplicateKey
+			}
+		}
+		setting.ID = repo.s.newID()
+		repo.s.data.autoTags = append(repo.s.data.autoTags, *setting)
+		return nil
+	}
+	for i := range repo.s.data.autoTags {
+		if repo.s.data.autoTags[i].ID == setting.ID {
+			repo.s.data.autoTags[i].Enabled = setting.Enabled
+		}
+	}
+	return nil
+}
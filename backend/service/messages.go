@@ -0,0 +1,70 @@
+package service
+
+// 错误信息的英文翻译，键是代码中使用的中文模板，两者的格式化参数必须一致
+var messagesEn = map[string]string{
+	"参数错误":         "invalid parameters",
+	"记录不存在":        "record not found",
+	"接口不存在":        "no such endpoint",
+	"服务器内部错误":      "internal server error",
+	"获取文件失败":       "failed to read the uploaded file",
+	"权重 '%s' 格式错误": "malformed weight '%s'",
+
+	"未登录或登录已过期":         "not logged in or session expired",
+	"用户名或密码错误":          "invalid username or password",
+	"已存在用户，请由已登录用户创建账号": "registration is closed, ask a logged-in user to create the account",
+	"用户名不合法":            "invalid username",
+	"密码至少 8 位":          "password must be at least 8 characters",
+	"用户 '%s' 已存在":       "user '%s' already exists",
+	"API Key 不存在":       "API key not found",
+	"至少需要保留一个管理员":       "at least one admin must remain",
+	"没有权限":              "permission denied",
+	"未知的角色 '%s'":        "unknown role '%s'",
+	"未知的权限 '%s'":        "unknown permission '%s'",
+	"目录名 '%s' 不合法":      "invalid directory name '%s'",
+	"租户名不能为空":           "tenant name must not be empty",
+	"租户 '%s' 已存在":       "tenant '%s' already exists",
+
+	"标签 '%s' 已存在":               "tag '%s' already exists",
+	"'%s' 已是其他标签的别名":            "'%s' is already an alias of another tag",
+	"别名 '%s' 不存在":               "alias '%s' not found",
+	"分类名 '%s' 不合法":              "invalid category name '%s'",
+	"颜色 '%s' 不合法，应为 #RRGGBB 格式": "invalid color '%s', expected #RRGGBB",
+	"分类 '%s' 已存在":               "category '%s' already exists",
+	"分类 '%s' 不存在":               "category '%s' not found",
+	"未知的自动标签规则 '%s'":            "unknown auto tag rule '%s'",
+
+	"变体 '%s' 不支持生成地址":       "variant '%s' has no URL",
+	"未知的图片变体 '%s'":          "unknown image variant '%s'",
+	"缩放需要指定 width 或 height": "resize requires width or height",
+	"缩放尺寸不能超过 %d":           "resize dimension must not exceed %d",
+	"未知的随机策略 '%s'":          "unknown random strategy '%s'",
+	"'%s' 的权重不合法":           "invalid weight for '%s'",
+
+	"封面图片 %d 不存在":   "cover image %d not found",
+	"封面图片 %d 不在相册中": "cover image %d is not in the album",
+	"图片 %d 不存在":     "image %d not found",
+	"图片 %d 不在相册中":   "image %d is not in the album",
+
+	"分享不存在":          "share not found",
+	"图片不存在":          "image not found",
+	"分享已过期":          "share has expired",
+	"分享密码错误":         "wrong share password",
+	"标签分享需要指定标签":     "a tag share requires a tag",
+	"未知的分享类型 '%s'":   "unknown share type '%s'",
+	"分享有效期不能超过 %d 天": "share expiry must not exceed %d days",
+
+	"未知的配额范围 '%s'":            "unknown quota scope '%s'",
+	"配额参数不合法":                 "invalid quota parameters",
+	"文件大小超过限制 %d 字节":          "file exceeds the size limit of %d bytes",
+	"不允许上传扩展名为 '%s' 的文件":      "files with extension '%s' are not allowed",
+	"不允许上传类型为 '%s' 的文件":       "files of type '%s' are not allowed",
+	"目录存储空间不足，已使用 %d / %d 字节": "directory storage is full, %d / %d bytes used",
+	"用户存储空间不足，已使用 %d / %d 字节": "user storage is full, %d / %d bytes used",
+	"目录图片数量已达上限 %d":           "directory has reached the limit of %d images",
+	"用户图片数量已达上限 %d":           "user has reached the limit of %d images",
+	"文件不是支持的图片格式":             "file is not a supported image format",
+	"扩展名 '%s' 与文件的实际格式 %s 不符": "extension '%s' does not match the actual format %s",
+	"无法解析图片: %v":              "cannot decode image: %v",
+	"图片尺寸不合法":                 "invalid image dimensions",
+	"图片尺寸 %dx%d 超过最大像素数 %d":   "image size %dx%d exceeds the maximum of %d pixels",
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"picture_storage/config"
+	"picture_storage/model"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kiririx/krutils/ut"
+	"gorm.io/gorm"
+)
+
+// 配额错误码
+const (
+	QuotaCodeFileTooLarge        = "file_too_large"
+	QuotaCodeExtensionNotAllowed = "extension_not_allowed"
+	QuotaCodeMimeTypeNotAllowed  = "mime_type_not_allowed"
+	QuotaCodeBytesExceeded       = "quota_bytes_exceeded"
+	QuotaCodeImagesExceeded      = "quota_images_exceeded"
+)
+
+// 上传被配额拒绝时返回的错误，Code 是更细的原因，ErrorCode 返回对外的错误码
+type QuotaError struct {
+	Code   string
+	Format string
+	Args   []any
+}
+
+func (e *QuotaError) Error() string {
+	return e.Message(LangZh)
+}
+
+func (e *QuotaError) Message(lang string) string {
+	return localize(lang, e.Format, e.Args)
+}
+
+func (e *QuotaError) ErrorCode() string {
+	switch e.Code {
+	case QuotaCodeFileTooLarge:
+		return CodeFileTooLarge
+	case QuotaCodeBytesExceeded, QuotaCodeImagesExceeded:
+		return CodeQuotaExceeded
+	default:
+		return CodeUnsupportedMediaType
+	}
+}
+
+// 单个文件的上传限制，来自配置，0 或空表示不限制
+type UploadLimits struct {
+	MaxFileSize       int64    `json:"max_file_size"`
+	AllowedExtensions []string `json:"allowed_extensions"`
+	AllowedMimeTypes  []string `json:"allowed_mime_types"`
+	MaxPixels         int64    `json:"max_pixels"`
+}
+
+type QuotaUsage struct {
+	Scope      string `json:"scope"`
+	Target     string `json:"target"`
+	UsedBytes  int64  `json:"used_bytes"`
+	UsedImages int64  `json:"used_images"`
+	MaxBytes   int64  `json:"max_bytes"`
+	MaxImages  int64  `json:"max_images"`
+}
+
+func uploadLimits() UploadLimits {
+	return UploadLimits{
+		MaxFileSize:       config.C.Limits.MaxFileSize,
+		AllowedExtensions: config.C.Limits.AllowedExtensions,
+		AllowedMimeTypes:  config.C.Limits.AllowedMimeTypes,
+		MaxPixels:         config.C.Limits.MaxPixels,
+	}
+}
+
+// 未单独配置时使用的默认配额
+func defaultQuota(scope string) model.QuotaModel {
+	quota := model.QuotaModel{Scope: scope}
+	if scope == model.QuotaScopeDirectory {
+		quota.MaxBytes = config.C.Limits.DirectoryMaxBytes
+		quota.MaxImages = config.C.Limits.DirectoryMaxImages
+	} else {
+		quota.MaxBytes = config.C.Limits.UserMaxBytes
+		quota.MaxImages = config.C.Limits.UserMaxImages
+	}
+	return quota
+}
+
+// 按大小、扩展名和文件头嗅探出的格式检查单个文件，返回实际的图片格式
+func checkUploadFile(limits UploadLimits, filename string, size int64, head []byte) (string, error) {
+	if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+		return "", &QuotaError{
+			Code:   QuotaCodeFileTooLarge,
+			Format: "文件大小超过限制 %d 字节",
+			Args:   []any{limits.MaxFileSize},
+		}
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if len(limits.AllowedExtensions) > 0 && !slices.Contains(limits.AllowedExtensions, ext) {
+		return "", &QuotaError{
+			Code:   QuotaCodeExtensionNotAllowed,
+			Format: "不允许上传扩展名为 '%s' 的文件",
+			Args:   []any{ext},
+		}
+	}
+	format, err := checkImageFormat(filename, head)
+	if err != nil {
+		return "", err
+	}
+	mimeType := imageFormatMimeTypes[format]
+	if len(limits.AllowedMimeTypes) > 0 && !slices.Contains(limits.AllowedMimeTypes, mimeType) {
+		return "", &QuotaError{
+			Code:   QuotaCodeMimeTypeNotAllowed,
+			Format: "不允许上传类型为 '%s' 的文件",
+			Args:   []any{mimeType},
+		}
+	}
+	return format, nil
+}
+
+// 目录或用户的配额，未单独配置时使用默认值
+func (service *ImageService) effectiveQuota(scope, target string) (model.QuotaModel, error) {
+	quota, err := service.store.Images().Quota(service.actor.TenantID, scope, target)
+	if err == gorm.ErrRecordNotFound {
+		quota = defaultQuota(scope)
+		quota.Target = target
+		return quota, nil
+	}
+	return quota, err
+}
+
+// 统计目录或用户已使用的字节数和图片数
+func (service *ImageService) quotaUsage(scope, target string) (int64, int64, error) {
+	return service.store.Images().Usage(service.actor.TenantID, scope, target)
+}
+
+func (service *ImageService) checkQuota(scope, target string, size int64) error {
+	quota, err := service.effectiveQuota(scope, target)
+	if err != nil {
+		return err
+	}
+	if quota.MaxBytes <= 0 && quota.MaxImages <= 0 {
+		return nil
+	}
+	usedBytes, usedImages, err := service.quotaUsage(scope, target)
+	if err != nil {
+		return err
+	}
+	directory := scope == model.QuotaScopeDirectory
+	if quota.MaxBytes > 0 && usedBytes+size > quota.MaxBytes {
+		return &QuotaError{
+			Code:   QuotaCodeBytesExceeded,
+			Format: ut.Then(directory, "目录存储空间不足，已使用 %d / %d 字节", "用户存储空间不足，已使用 %d / %d 字节"),
+			Args:   []any{usedBytes, quota.MaxBytes},
+		}
+	}
+	if quota.MaxImages > 0 && usedImages+1 > quota.MaxImages {
+		return &QuotaError{
+			Code:   QuotaCodeImagesExceeded,
+			Format: ut.Then(directory, "目录图片数量已达上限 %d", "用户图片数量已达上限 %d"),
+			Args:   []any{quota.MaxImages},
+		}
+	}
+	return nil
+}
+
+// 上传前检查文件限制和目录、用户配额，不通过时不会写入存储
+func (service *ImageService) checkUploadQuota(directory string, file *multipart.FileHeader) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	src.Close()
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+
+	limits := uploadLimits()
+	format, err := checkUploadFile(limits, file.Filename, file.Size, head[:n])
+	if err != nil {
+		return err
+	}
+	src, err = file.Open()
+	if err != nil {
+		return err
+	}
+	err = checkImagePixels(src, limits.MaxPixels)
+	src.Close()
+	if err != nil {
+		return err
+	}
+	// 存储时使用嗅探出的类型，不信任客户端声明的 Content-Type
+	file.Header.Set("Content-Type", imageFormatMimeTypes[format])
+
+	if err := service.checkQuota(model.QuotaScopeDirectory, directory, file.Size); err != nil {
+		return err
+	}
+	if service.actor.UserID != 0 {
+		userID := strconv.FormatUint(service.actor.UserID, 10)
+		if err := service.checkQuota(model.QuotaScopeUser, userID, file.Size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 当前用户和可访问目录的配额使用情况
+func (service *ImageService) GetQuotaUsage() (UploadLimits, []QuotaUsage, error) {
+	limits := uploadLimits()
+	usages := make([]QuotaUsage, 0)
+
+	targets := make([][2]string, 0)
+	if service.actor.UserID != 0 {
+		targets = append(targets, [2]string{model.QuotaScopeUser, strconv.FormatUint(service.actor.UserID, 10)})
+	}
+
+	// 有图片或单独配置了配额的目录
+	directories, err := service.store.Images().Directories(service.visibleImages())
+	if err != nil {
+		return limits, nil, err
+	}
+	quotas, err := service.store.Images().Quotas(service.actor.TenantID, model.QuotaScopeDirectory)
+	if err != nil {
+		return limits, nil, err
+	}
+	for _, quota := range quotas {
+		if slices.Contains(directories, quota.Target) {
+			continue
+		}
+		if err := service.checkDirectory(quota.Target, false); err == nil {
+			directories = append(directories, quota.Target)
+		}
+	}
+	slices.Sort(directories)
+	for _, directory := range directories {
+		targets = append(targets, [2]string{model.QuotaScopeDirectory, directory})
+	}
+
+	for _, target := range targets {
+		quota, err := service.effectiveQuota(target[0], target[1])
+		if err != nil {
+			return limits, nil, err
+		}
+		usedBytes, usedImages, err := service.quotaUsage(target[0], target[1])
+		if err != nil {
+			return limits, nil, err
+		}
+		usages = append(usages, QuotaUsage{
+			Scope:      target[0],
+			Target:     target[1],
+			UsedBytes:  usedBytes,
+			UsedImages: usedImages,
+			MaxBytes:   quota.MaxBytes,
+			MaxImages:  quota.MaxImages,
+		})
+	}
+	return limits, usages, nil
+}
+
+// 设置目录或用户的配额，两项都为 0 时恢复默认配额
+func (service *ImageService) SetQuota(scope, target string, maxBytes, maxImages int64) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+	if scope != model.QuotaScopeDirectory && scope != model.QuotaScopeUser {
+		return Errorf(CodeInvalidArgument, "未知的配额范围 '%s'", scope)
+	}
+	if target == "" || maxBytes < 0 || maxImages < 0 {
+		return Errorf(CodeInvalidArgument, "配额参数不合法")
+	}
+
+	return service.store.Transaction(func(store Store) error {
+		if err := store.Images().DeleteQuota(service.actor.TenantID, scope, target); err != nil {
+			return err
+		}
+		if maxBytes == 0 && maxImages == 0 {
+			return nil
+		}
+		return store.Images().CreateQuota(&model.QuotaModel{
+			TenantID:  service.actor.TenantID,
+			Scope:     scope,
+			Target:    target,
+			MaxBytes:  maxBytes,
+			MaxImages: maxImages,
+		})
+	})
+}
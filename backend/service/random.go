@@ -0,0 +1,521 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"picture_storage/cache"
+	"picture_storage/model"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 不重复会话的保留时间，超过后记录被清理
+const randomSessionTTL = 30 * 24 * time.Hour
+
+// 返回记录的保留时间
+const serveHistoryRetention = 30 * 24 * time.Hour
+
+// 随机策略
+const (
+	// 等概率
+	RandomStrategyUniform = "uniform"
+	// 越新上传的图片权重越高
+	RandomStrategyRecent = "recent"
+	// 按请求中的标签、目录权重
+	RandomStrategyWeighted = "weighted"
+	// 最近返回过的图片权重降低
+	RandomStrategyHistory = "history"
+)
+
+// 各策略默认的半衰期
+const (
+	defaultRecentHalfLife  = 30 * 24 * time.Hour
+	defaultHistoryHalfLife = 24 * time.Hour
+)
+
+// 单次最多返回的图片数，等概率抽样每张图片需要一次查询
+const maxRandomCount = 100
+
+// history 策略下权重的下限，保证每张图片都有机会被选中
+const minHistoryWeight = 0.01
+
+type RandomOptions struct {
+	Directory string
+	Tags      []string
+	Count     int64
+	// 相同的 seed 在图片集合不变时返回相同结果，例如每日一图
+	Seed string
+	// 非空时同一会话内不重复返回图片，直到所有候选图片都返回过一次
+	Session string
+	// 随机策略，为空时等概率
+	Strategy string
+	// recent 策略下权重减半的时间；history 策略下返回过的图片权重恢复一半的时间
+	HalfLife time.Duration
+	// weighted 策略下的标签和目录权重，未指定的为 1，0 表示排除
+	TagWeights       map[string]float64
+	DirectoryWeights map[string]float64
+}
+
+type randomCandidate struct {
+	ID        uint64
+	Directory string
+	CreatedAt time.Time
+	Weight    float64
+}
+
+// 随机选取图片：等概率时在数据库中按随机偏移抽样，其他策略只查询候选图片的 ID、目录和时间，在内存中按权重抽样
+func (service *ImageService) GetRandomImages(opts RandomOptions) ([]model.ImageModel, error) {
+	tags, err := service.resolveTagNames(service.store, opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Tags = tags
+	if err := validateRandomOptions(opts); err != nil {
+		return nil, err
+	}
+	if opts.TagWeights, err = service.resolveTagWeights(opts.TagWeights); err != nil {
+		return nil, err
+	}
+
+	count := min(int(opts.Count), maxRandomCount)
+	if count <= 0 {
+		count = 1
+	}
+	now := service.clock.Now()
+	r := newRandom(opts.Seed)
+
+	var pickedIDs []uint64
+	if opts.Strategy == "" || opts.Strategy == RandomStrategyUniform {
+		pickedIDs, err = service.pickUniform(opts, count, r)
+	} else {
+		pickedIDs, err = service.pickWeighted(opts, count, r, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 只有 history 策略使用返回记录
+	if opts.Strategy == RandomStrategyHistory {
+		if err := service.recordServed(pickedIDs, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return service.imagesByIDs(pickedIDs)
+}
+
+func validateRandomOptions(opts RandomOptions) error {
+	switch opts.Strategy {
+	case "", RandomStrategyUniform, RandomStrategyRecent, RandomStrategyHistory:
+		return nil
+	case RandomStrategyWeighted:
+		if err := validateWeights(opts.TagWeights); err != nil {
+			return err
+		}
+		return validateWeights(opts.DirectoryWeights)
+	default:
+		return Errorf(CodeInvalidArgument, "未知的随机策略 '%s'", opts.Strategy)
+	}
+}
+
+// 满足条件且当前身份可见的图片
+func (service *ImageService) randomFilter(opts RandomOptions) ImageFilter {
+	filter := service.visibleImages()
+	filter.Directory = opts.Directory
+	filter.Tags = opts.Tags
+	return filter
+}
+
+// 等概率抽样：先统计数量，再按随机偏移逐条读取，不把候选集合加载到内存
+func (service *ImageService) pickUniform(opts RandomOptions, count int, r *rand.Rand) ([]uint64, error) {
+	filter := service.randomFilter(opts)
+	if opts.Session == "" {
+		return sampleOffsets(service.store.Images(), filter, count, r)
+	}
+
+	sessionKey := randomSessionKey(service.actor.TenantID, opts)
+	return service.withRandomSession(sessionKey, func(store Store) ([]uint64, bool, error) {
+		unserved := filter
+		unserved.ExcludeSession = sessionKey
+		picked, err := sampleOffsets(store.Images(), unserved, count, r)
+		if err != nil || len(picked) == count {
+			return picked, false, err
+		}
+		// 本轮已用尽，剩余数量从本次未选中的图片中补足
+		rest := filter
+		rest.ExcludeIDs = picked
+		restPicked, err := sampleOffsets(store.Images(), rest, count-len(picked), r)
+		return append(picked, restPicked...), true, err
+	})
+}
+
+// 从匹配 filter 的图片中不重复地随机取 count 张，按 ID 排序保证同一 seed 结果稳定
+func sampleOffsets(images ImageRepository, filter ImageFilter, count int, r *rand.Rand) ([]uint64, error) {
+	total, err := images.Count(filter)
+	if err != nil {
+		return nil, err
+	}
+	count = int(min(int64(count), total))
+	offsets := make([]int64, 0, count)
+	seen := make(map[int64]bool)
+	for len(offsets) < count {
+		offset := r.Int64N(total)
+		if !seen[offset] {
+			seen[offset] = true
+			offsets = append(offsets, offset)
+		}
+	}
+
+	ids := make([]uint64, 0, count)
+	for _, offset := range offsets {
+		id, err := images.IDAt(filter, offset)
+		// 统计后被删除的图片跳过
+		if err == gorm.ErrRecordNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// 按权重抽样需要每张候选图片的权重，只查询计算权重所需的列
+func (service *ImageService) pickWeighted(opts RandomOptions, count int, r *rand.Rand, now time.Time) ([]uint64, error) {
+	candidates, err := service.randomCandidates(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.applyRandomWeights(candidates, opts, now); err != nil {
+		return nil, err
+	}
+	if opts.Session == "" {
+		return weightedPick(candidates, count, r), nil
+	}
+
+	sessionKey := randomSessionKey(service.actor.TenantID, opts)
+	return service.withRandomSession(sessionKey, func(store Store) ([]uint64, bool, error) {
+		servedIDs, err := store.Random().SessionImages(sessionKey)
+		if err != nil {
+			return nil, false, err
+		}
+		picked := weightedPick(excludeCandidates(candidates, servedIDs), count, r)
+		if len(picked) == count {
+			return picked, false, nil
+		}
+		picked = append(picked, weightedPick(excludeCandidates(candidates, picked), count-len(picked), r)...)
+		return picked, true, nil
+	})
+}
+
+// 查询满足条件的图片，按 ID 排序保证同一 seed 结果稳定
+func (service *ImageService) randomCandidates(opts RandomOptions) ([]randomCandidate, error) {
+	images, err := service.store.Images().Candidates(service.randomFilter(opts))
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]randomCandidate, 0, len(images))
+	for _, image := range images {
+		candidates = append(candidates, randomCandidate{
+			ID:        image.ID,
+			Directory: image.Directory,
+			CreatedAt: image.CreatedAt,
+			Weight:    1,
+		})
+	}
+	return candidates, nil
+}
+
+// 按策略计算候选图片的权重
+func (service *ImageService) applyRandomWeights(candidates []randomCandidate, opts RandomOptions, now time.Time) error {
+	switch opts.Strategy {
+	case "", RandomStrategyUniform:
+		return nil
+	case RandomStrategyRecent:
+		applyRecencyWeights(candidates, now, durationOrDefault(opts.HalfLife, defaultRecentHalfLife))
+		return nil
+	case RandomStrategyWeighted:
+		imageTags, err := service.candidateTags(opts, opts.TagWeights)
+		if err != nil {
+			return err
+		}
+		applyCustomWeights(candidates, imageTags, opts.TagWeights, opts.DirectoryWeights)
+		return nil
+	case RandomStrategyHistory:
+		servedAt, err := service.candidateServeHistory(opts, now)
+		if err != nil {
+			return err
+		}
+		applyHistoryWeights(candidates, servedAt, now, durationOrDefault(opts.HalfLife, defaultHistoryHalfLife))
+		return nil
+	default:
+		return Errorf(CodeInvalidArgument, "未知的随机策略 '%s'", opts.Strategy)
+	}
+}
+
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+func validateWeights(weights map[string]float64) error {
+	for name, weight := range weights {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return Errorf(CodeInvalidArgument, "'%s' 的权重不合法", name)
+		}
+	}
+	return nil
+}
+
+// 权重随上传时间按半衰期指数衰减
+func applyRecencyWeights(candidates []randomCandidate, now time.Time, halfLife time.Duration) {
+	for i := range candidates {
+		age := max(now.Sub(candidates[i].CreatedAt), 0)
+		candidates[i].Weight *= math.Pow(0.5, float64(age)/float64(halfLife))
+	}
+}
+
+// 将标签权重的键按别名解析为规范标签名并转为小写，指向同一标签的权重相乘
+func (service *ImageService) resolveTagWeights(weights map[string]float64) (map[string]float64, error) {
+	if len(weights) == 0 {
+		return weights, nil
+	}
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	aliasMap, err := service.store.Tags().ResolveAliases(service.actor.TenantID, names)
+	if err != nil {
+		return nil, err
+	}
+	resolved := make(map[string]float64, len(weights))
+	for name, weight := range weights {
+		if canonical, ok := aliasMap[name]; ok {
+			name = canonical
+		}
+		name = strings.ToLower(name)
+		if previous, ok := resolved[name]; ok {
+			weight *= previous
+		}
+		resolved[name] = weight
+	}
+	return resolved, nil
+}
+
+// 权重为目录权重与所有命中标签权重的乘积，标签权重的键已转为小写
+func applyCustomWeights(candidates []randomCandidate, imageTags map[uint64][]string, tagWeights, directoryWeights map[string]float64) {
+	for i := range candidates {
+		if weight, ok := directoryWeights[candidates[i].Directory]; ok {
+			candidates[i].Weight *= weight
+		}
+		for _, tagName := range imageTags[candidates[i].ID] {
+			if weight, ok := tagWeights[strings.ToLower(tagName)]; ok {
+				candidates[i].Weight *= weight
+			}
+		}
+	}
+}
+
+// 每次返回记录都会降低权重，随时间按半衰期恢复
+func applyHistoryWeights(candidates []randomCandidate, servedAt map[uint64][]time.Time, now time.Time, halfLife time.Duration) {
+	for i := range candidates {
+		weight := 1.0
+		for _, t := range servedAt[candidates[i].ID] {
+			elapsed := max(now.Sub(t), 0)
+			weight *= 1 - math.Pow(0.5, float64(elapsed)/float64(halfLife))
+		}
+		candidates[i].Weight *= max(weight, minHistoryWeight)
+	}
+}
+
+// 查询候选图片上带有权重的标签
+func (service *ImageService) candidateTags(opts RandomOptions, tagWeights map[string]float64) (map[uint64][]string, error) {
+	if len(tagWeights) == 0 {
+		return make(map[uint64][]string), nil
+	}
+	tagNames := make([]string, 0, len(tagWeights))
+	for name := range tagWeights {
+		tagNames = append(tagNames, name)
+	}
+	return service.store.Tags().ImageTagNames(service.randomFilter(opts), tagNames)
+}
+
+// 查询候选图片在保留期内的返回记录
+func (service *ImageService) candidateServeHistory(opts RandomOptions, now time.Time) (map[uint64][]time.Time, error) {
+	history, err := service.store.Random().ServeHistory(service.randomFilter(opts), now.Add(-serveHistoryRetention))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint64][]time.Time)
+	for _, h := range history {
+		result[h.ImageID] = append(result[h.ImageID], h.ServedAt)
+	}
+	return result, nil
+}
+
+// 过期记录的清理间隔，同一缓存内的实例共用
+const randomPurgeInterval = time.Hour
+
+// 距上次清理超过间隔时执行 purge
+func purgePeriodically(name string, purge func() error) error {
+	cacheKey := "random:purge:" + name
+	var purged bool
+	if cache.Get(cacheKey, &purged) {
+		return nil
+	}
+	if err := purge(); err != nil {
+		return err
+	}
+	cache.Set(cacheKey, true, randomPurgeInterval)
+	return nil
+}
+
+// 记录返回的图片，过期记录定期清理
+func (service *ImageService) recordServed(ids []uint64, now time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := purgePeriodically("history", func() error {
+		return service.store.Random().PurgeServeHistory(now.Add(-serveHistoryRetention))
+	})
+	if err != nil {
+		return err
+	}
+	history := make([]model.ImageServeHistoryModel, 0, len(ids))
+	for _, id := range ids {
+		history = append(history, model.ImageServeHistoryModel{ImageID: id, ServedAt: now})
+	}
+	return service.store.Random().RecordServed(history)
+}
+
+// 按选取顺序查询图片
+func (service *ImageService) imagesByIDs(ids []uint64) ([]model.ImageModel, error) {
+	if len(ids) == 0 {
+		return []model.ImageModel{}, nil
+	}
+	images, err := service.store.Images().FindByIDs(service.actor.TenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+	imageMap := make(map[uint64]model.ImageModel)
+	for _, image := range images {
+		imageMap[image.ID] = image
+	}
+	result := make([]model.ImageModel, 0, len(ids))
+	for _, id := range ids {
+		if image, ok := imageMap[id]; ok {
+			result = append(result, image)
+		}
+	}
+	return result, nil
+}
+
+// seed 为空时使用随机种子
+func newRandom(seed string) *rand.Rand {
+	if seed == "" {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	sum := h.Sum64()
+	return rand.New(rand.NewPCG(sum, sum))
+}
+
+// 按权重不放回抽样（Efraimidis-Spirakis），权重为 0 的候选不会被选中
+func weightedPick(candidates []randomCandidate, count int, r *rand.Rand) []uint64 {
+	type keyed struct {
+		id  uint64
+		key float64
+	}
+	keys := make([]keyed, 0, len(candidates))
+	for _, candidate := range candidates {
+		// 每个候选都消耗一次随机数，保证同一 seed 下结果只取决于候选集合
+		u := 1 - r.Float64()
+		if candidate.Weight <= 0 {
+			continue
+		}
+		// log(u)/w 与 u^(1/w) 单调一致，避免小权重下溢
+		keys = append(keys, keyed{id: candidate.ID, key: math.Log(u) / candidate.Weight})
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].key > keys[j].key
+	})
+
+	count = min(count, len(keys))
+	ids := make([]uint64, 0, count)
+	for _, k := range keys[:count] {
+		ids = append(ids, k.id)
+	}
+	return ids
+}
+
+// 会话键包含租户和筛选条件，同一客户端换了筛选条件时重新开始计数
+func randomSessionKey(tenantID uint64, opts RandomOptions) string {
+	tags := slices.Clone(opts.Tags)
+	slices.Sort(tags)
+	h := sha1.New()
+	fmt.Fprintf(h, "%d\x00", tenantID)
+	h.Write([]byte(opts.Session + "\x00" + opts.Directory + "\x00" + strings.Join(tags, "\x00")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 在事务中执行不重复会话的抽样：pick 返回选中的图片和本轮是否已用尽，用尽时先清空会话记录再写入本次结果
+func (service *ImageService) withRandomSession(sessionKey string, pick func(store Store) ([]uint64, bool, error)) ([]uint64, error) {
+	now := service.clock.Now()
+	err := purgePeriodically("session", func() error {
+		return service.store.Random().PurgeSessions(now.Add(-randomSessionTTL))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var picked []uint64
+	err = service.store.Transaction(func(store Store) error {
+		var exhausted bool
+		var err error
+		picked, exhausted, err = pick(store)
+		if err != nil {
+			return err
+		}
+		if exhausted {
+			if err := store.Random().ClearSession(sessionKey); err != nil {
+				return err
+			}
+		}
+		for _, id := range picked {
+			if err := store.Random().AddSessionImage(&model.RandomSessionModel{SessionKey: sessionKey, ImageID: id, CreatedAt: now}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return picked, nil
+}
+
+func excludeCandidates(candidates []randomCandidate, excluded []uint64) []randomCandidate {
+	excludedSet := make(map[uint64]bool)
+	for _, id := range excluded {
+		excludedSet[id] = true
+	}
+	result := make([]randomCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !excludedSet[candidate.ID] {
+			result = append(result, candidate)
+		}
+	}
+	return result
+}
@@ -0,0 +1,300 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"picture_storage/model"
+	"picture_storage/service"
+	"picture_storage/service/memory"
+	"slices"
+	"testing"
+	"time"
+)
+
+// 每个分布检验的抽样次数
+const randomDraws = 3000
+
+// 卡方检验在显著性水平 0.001 下的临界值，下标为自由度
+var chiSquareCritical = []float64{0, 10.83, 13.82, 16.27, 18.47, 20.52}
+
+// 直接写入图片记录，createdAt 决定 recent 策略下的权重
+func addImage(t *testing.T, e *env, directory string, createdAt time.Time, tags ...string) uint64 {
+	t.Helper()
+	image := model.ImageModel{
+		TenantID:  service.DefaultTenantID,
+		ImageName: "image.png",
+		ImageCode: fmt.Sprintf("%s-%d", directory, createdAt.UnixNano()),
+		Ext:       "png",
+		Directory: directory,
+		CreatedAt: createdAt,
+	}
+	if err := e.Store.Images().Create(&image); err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) > 0 {
+		if err := e.AddTags([]uint64{image.ID}, tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return image.ID
+}
+
+// 用不同的 seed 各抽一张，统计每张图片被选中的次数；seed 固定，结果可以复现
+func drawRandom(t *testing.T, images *service.ImageService, opts service.RandomOptions, draws int) map[uint64]int {
+	t.Helper()
+	counts := make(map[uint64]int)
+	for i := 0; i < draws; i++ {
+		opts.Count = 1
+		opts.Seed = fmt.Sprintf("%s-%d", t.Name(), i)
+		picked, err := images.GetRandomImages(opts)
+		if err != nil {
+			t.Fatalf("random: %v", err)
+		}
+		if len(picked) != 1 {
+			t.Fatalf("picked %d images", len(picked))
+		}
+		counts[picked[0].ID]++
+	}
+	return counts
+}
+
+// 检验选中次数是否符合按 weights 成比例的分布，权重为 0 的图片不能被选中
+func checkDistribution(t *testing.T, counts map[uint64]int, weights map[uint64]float64) {
+	t.Helper()
+	var total, sum float64
+	for _, count := range counts {
+		total += float64(count)
+	}
+	for _, weight := range weights {
+		sum += weight
+	}
+
+	chiSquare := 0.0
+	df := -1
+	for id, weight := range weights {
+		if weight == 0 {
+			if counts[id] != 0 {
+				t.Errorf("image %d with zero weight picked %d times", id, counts[id])
+			}
+			continue
+		}
+		expected := total * weight / sum
+		diff := float64(counts[id]) - expected
+		chiSquare += diff * diff / expected
+		df++
+	}
+	for id := range counts {
+		if _, ok := weights[id]; !ok {
+			t.Errorf("unexpected image %d picked", id)
+		}
+	}
+	if chiSquare > chiSquareCritical[df] {
+		t.Errorf("counts = %v, weights = %v: chi-square %.2f > %.2f", counts, weights, chiSquare, chiSquareCritical[df])
+	}
+}
+
+func TestRandomUniform(t *testing.T) {
+	e := newEnv(t, memory.NewStore())
+	now := e.Clock.Now()
+	weights := make(map[uint64]float64)
+	for i := range 4 {
+		// 上传时间不影响等概率抽样
+		weights[addImage(t, e, "photos", now.Add(-time.Duration(i)*365*24*time.Hour))] = 1
+	}
+
+	for _, strategy := range []string{"", service.RandomStrategyUniform} {
+		counts := drawRandom(t, e.ImageService, service.RandomOptions{Directory: "photos", Strategy: strategy}, randomDraws)
+		checkDistribution(t, counts, weights)
+	}
+}
+
+func TestRandomRecent(t *testing.T) {
+	e := newEnv(t, memory.NewStore())
+	now := e.Clock.Now()
+	day := 24 * time.Hour
+	newest := addImage(t, e, "photos", now)
+	dayOld := addImage(t, e, "photos", now.Add(-day))
+	twoDaysOld := addImage(t, e, "photos", now.Add(-2*day))
+
+	// 每过一个半衰期权重减半
+	counts := drawRandom(t, e.ImageService, service.RandomOptions{Strategy: service.RandomStrategyRecent, HalfLife: day}, randomDraws)
+	checkDistribution(t, counts, map[uint64]float64{newest: 4, dayOld: 2, twoDaysOld: 1})
+
+	// 默认半衰期为 30 天，相差一两天的图片权重接近
+	counts = drawRandom(t, e.ImageService, service.RandomOptions{Strategy: service.RandomStrategyRecent}, randomDraws)
+	checkDistribution(t, counts, map[uint64]float64{
+		newest:     1,
+		dayOld:     math.Pow(0.5, 1.0/30),
+		twoDaysOld: math.Pow(0.5, 2.0/30),
+	})
+}
+
+func TestRandomWeighted(t *testing.T) {
+	e := newEnv(t, memory.NewStore())
+	now := e.Clock.Now()
+	cat := addImage(t, e, "photos", now, "cat")
+	catDog := addImage(t, e, "photos", now, "cat", "dog")
+	plain := addImage(t, e, "photos", now)
+	other := addImage(t, e, "other", now, "cat")
+	hidden := addImage(t, e, "hidden", now)
+
+	// 权重为目录权重与命中标签权重的乘积，未指定的为 1，0 表示排除
+	opts := service.RandomOptions{
+		Strategy:         service.RandomStrategyWeighted,
+		TagWeights:       map[string]float64{"cat": 3, "dog": 2},
+		DirectoryWeights: map[string]float64{"other": 0.5, "hidden": 0},
+	}
+	counts := drawRandom(t, e.ImageService, opts, randomDraws)
+	checkDistribution(t, counts, map[uint64]float64{cat: 3, catDog: 6, plain: 1, other: 1.5, hidden: 0})
+
+	// 标签条件与权重同时生效
+	opts.Tags = []string{"cat"}
+	counts = drawRandom(t, e.ImageService, opts, randomDraws)
+	checkDistribution(t, counts, map[uint64]float64{cat: 3, catDog: 6, other: 1.5})
+
+	// 权重的键可以是别名，不区分大小写
+	if err := e.AddTagAlias("cat", "kitty"); err != nil {
+		t.Fatal(err)
+	}
+	opts.Tags = nil
+	opts.TagWeights = map[string]float64{"kitty": 3, "DOG": 2}
+	counts = drawRandom(t, e.ImageService, opts, randomDraws)
+	checkDistribution(t, counts, map[uint64]float64{cat: 3, catDog: 6, plain: 1, other: 1.5, hidden: 0})
+
+	for _, weights := range []map[string]float64{{"cat": -1}, {"cat": math.NaN()}} {
+		_, err := e.GetRandomImages(service.RandomOptions{Strategy: service.RandomStrategyWeighted, TagWeights: weights})
+		var serviceErr *service.Error
+		if !errors.As(err, &serviceErr) || serviceErr.Code != service.CodeInvalidArgument {
+			t.Errorf("weights %v: %v", weights, err)
+		}
+	}
+}
+
+func TestRandomHistory(t *testing.T) {
+	day := 24 * time.Hour
+	cases := []struct {
+		name string
+		// 图片 a 在本次请求之前多久被返回过
+		served []time.Duration
+		// a 相对于从未返回过的 b 的权重
+		weight float64
+	}{
+		{"从未返回", nil, 1},
+		{"一个半衰期前", []time.Duration{day}, 0.5},
+		{"两个半衰期前", []time.Duration{2 * day}, 0.75},
+		{"两次各一个半衰期前", []time.Duration{day, day}, 0.25},
+		{"刚刚返回", []time.Duration{0}, 0.01},
+		{"超过保留期", []time.Duration{31 * day}, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newEnv(t, memory.NewStore())
+			counts := make(map[int]int)
+			// 每次返回都会写入记录，每次抽样使用新的数据
+			for i := 0; i < randomDraws; i++ {
+				store := memory.NewStore()
+				images := service.NewImageService(e.Storage, store, e.Clock).As(adminActor)
+				now := e.Clock.Now()
+				ids := make([]uint64, 0, 2)
+				for range 2 {
+					image := model.ImageModel{TenantID: service.DefaultTenantID, Directory: "photos", CreatedAt: now}
+					if err := store.Images().Create(&image); err != nil {
+						t.Fatal(err)
+					}
+					ids = append(ids, image.ID)
+				}
+				history := make([]model.ImageServeHistoryModel, 0, len(tc.served))
+				for _, ago := range tc.served {
+					history = append(history, model.ImageServeHistoryModel{ImageID: ids[0], ServedAt: now.Add(-ago)})
+				}
+				if err := store.Random().RecordServed(history); err != nil {
+					t.Fatal(err)
+				}
+
+				picked, err := images.GetRandomImages(service.RandomOptions{
+					Strategy: service.RandomStrategyHistory,
+					HalfLife: day,
+					Seed:     fmt.Sprintf("%s-%d", t.Name(), i),
+				})
+				if err != nil || len(picked) != 1 {
+					t.Fatalf("random = %v, %v", picked, err)
+				}
+				counts[slices.Index(ids, picked[0].ID)]++
+
+				// 本次返回的图片被记录
+				served, err := store.Random().ServeHistory(service.ImageFilter{TenantID: service.DefaultTenantID, IDs: []uint64{picked[0].ID}}, now)
+				if err != nil || len(served) == 0 {
+					t.Fatalf("history = %v, %v", served, err)
+				}
+			}
+			checkDistribution(t, map[uint64]int{0: counts[0], 1: counts[1]}, map[uint64]float64{0: tc.weight, 1: 1})
+		})
+	}
+}
+
+func TestRandomSeed(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		now := e.Clock.Now()
+		for i := range 20 {
+			addImage(t, e, "photos", now.Add(-time.Duration(i)*time.Hour))
+		}
+
+		for _, strategy := range []string{service.RandomStrategyUniform, service.RandomStrategyRecent, service.RandomStrategyWeighted} {
+			opts := service.RandomOptions{Count: 5, Seed: "daily", Strategy: strategy}
+			first, err := e.GetRandomImages(opts)
+			if err != nil || len(first) != 5 {
+				t.Fatalf("%s: random = %v, %v", strategy, first, err)
+			}
+			second, err := e.GetRandomImages(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(first, second, func(a, b model.ImageModel) bool { return a.ID == b.ID }) {
+				t.Errorf("%s: same seed returned different images", strategy)
+			}
+		}
+	})
+}
+
+func TestRandomSession(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		now := e.Clock.Now()
+		all := make([]uint64, 0, 5)
+		for i := range 5 {
+			all = append(all, addImage(t, e, "photos", now.Add(-time.Duration(i)*time.Hour), "cat"))
+		}
+		addImage(t, e, "other", now, "cat")
+
+		for _, strategy := range []string{service.RandomStrategyUniform, service.RandomStrategyRecent} {
+			// 同一会话内不重复，用尽后从未在本次返回的图片中补足并开始新一轮
+			opts := service.RandomOptions{Directory: "photos", Count: 2, Session: "client-" + strategy, Strategy: strategy}
+			served := make([]uint64, 0, len(all))
+			for range 2 {
+				picked, err := e.GetRandomImages(opts)
+				if err != nil || len(picked) != 2 {
+					t.Fatalf("%s: random = %v, %v", strategy, picked, err)
+				}
+				for _, image := range picked {
+					if slices.Contains(served, image.ID) {
+						t.Errorf("%s: image %d served twice in a round", strategy, image.ID)
+					}
+					served = append(served, image.ID)
+				}
+			}
+			picked, err := e.GetRandomImages(opts)
+			if err != nil || len(picked) != 2 || picked[0].ID == picked[1].ID {
+				t.Fatalf("%s: random = %v, %v", strategy, picked, err)
+			}
+			last := picked[0].ID
+			if slices.Contains(served, last) {
+				last = picked[1].ID
+			}
+			served = append(served, last)
+			slices.Sort(served)
+			if !slices.Equal(served, all) {
+				t.Errorf("%s: served %v, want %v", strategy, served, all)
+			}
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"picture_storage/model"
+	"time"
+)
+
+// 图片、标签、相册和分享的数据访问，默认实现基于 gorm，memory 包提供内存实现
+// 查询单条记录不存在时返回 gorm.ErrRecordNotFound
+type Store interface {
+	Images() ImageRepository
+	Tags() TagRepository
+	Albums() AlbumRepository
+	Shares() ShareRepository
+	Random() RandomRepository
+	Users() UserRepository
+	// 在同一个事务中执行 fn，fn 返回错误时回滚
+	Transaction(fn func(store Store) error) error
+}
+
+// 图片的查询条件，零值的字段不参与过滤
+type ImageFilter struct {
+	TenantID  uint64
+	Directory string
+	// 同时拥有全部标签的图片
+	Tags       []string
+	IDs        []uint64
+	ExcludeIDs []uint64
+	// 相册中的图片，分页列表按相册内顺序排列
+	AlbumID uint64
+	// 排除不重复会话中已经返回过的图片
+	ExcludeSession string
+	// 不为 nil 时只包含该访问者可以访问的目录：未配置权限的公开目录，或已授权的目录
+	Viewer *DirectoryViewer
+}
+
+// 按目录权限过滤时的访问者，UserID 为 0 表示匿名访问
+type DirectoryViewer struct {
+	UserID uint64
+}
+
+// 标签及其在图片上的使用次数
+type TagUsage struct {
+	Name     string
+	Category string
+	Count    int64
+}
+
+type ImageRepository interface {
+	FindByIDs(tenantID uint64, ids []uint64) ([]model.ImageModel, error)
+	FindByCode(tenantID uint64, code string) (model.ImageModel, error)
+	FindByFile(tenantID uint64, directory, code, ext string) (model.ImageModel, error)
+	// 任意一张使用该缩略图对象的图片，不同的原图可能生成相同的缩略图
+	FindByThumbnail(tenantID uint64, code, ext string) (model.ImageModel, error)
+	// 分页查询，设置了 AlbumID 时按相册内顺序，否则按创建时间倒序
+	List(filter ImageFilter, page model.Pagination) ([]model.ImageModel, int64, error)
+	// 按 ID 升序返回全部匹配的图片
+	Find(filter ImageFilter) ([]model.ImageModel, error)
+	// 按 ID 升序返回全部匹配的图片，只填充 ID、Directory 和 CreatedAt，用于计算随机权重
+	Candidates(filter ImageFilter) ([]model.ImageModel, error)
+	Count(filter ImageFilter) (int64, error)
+	// 按 ID 升序排列时第 offset 张图片的 ID，用于等概率抽样
+	IDAt(filter ImageFilter, offset int64) (uint64, error)
+	// 匹配的图片所在的目录，已去重
+	Directories(filter ImageFilter) ([]string, error)
+	Create(image *model.ImageModel) error
+	// 删除图片及其标签、相册关联，作为相册封面时清空封面
+	Delete(id uint64) error
+	// 统计目录或上传者已使用的字节数和图片数
+	Usage(tenantID uint64, scope, target string) (int64, int64, error)
+	// 单独配置的配额
+	Quota(tenantID uint64, scope, target string) (model.QuotaModel, error)
+	Quotas(tenantID uint64, scope string) ([]model.QuotaModel, error)
+	CreateQuota(quota *model.QuotaModel) error
+	DeleteQuota(tenantID uint64, scope, target string) error
+	DirectoryPermissions(tenantID uint64, directory string) ([]model.DirectoryPermissionModel, error)
+	CreateDirectoryPermission(permission *model.DirectoryPermissionModel) error
+	DeleteDirectoryPermission(tenantID uint64, directory string, userID uint64) error
+}
+
+type TagRepository interface {
+	// 按创建时间升序
+	List(tenantID uint64) ([]model.TagModel, error)
+	FindByName(tenantID uint64, name string) (model.TagModel, error)
+	FindByNames(tenantID uint64, names []string) ([]model.TagModel, error)
+	FindByIDs(ids []uint64) ([]model.TagModel, error)
+	// 返回别名到规范标签名的映射，不是别名的名称不会出现在结果中
+	ResolveAliases(tenantID uint64, names []string) (map[string]string, error)
+	Create(tag *model.TagModel) error
+	// 更新标签名和分类
+	Update(tag *model.TagModel) error
+	// 删除标签及其图片关联和别名
+	Delete(id uint64) error
+	// 将源标签的图片关联和别名转移到目标标签并删除源标签，已拥有目标标签的图片不会重复关联
+	Merge(sourceID, targetID uint64) error
+	// 每个标签在匹配图片上的使用次数，没有匹配图片的标签不出现在结果中
+	Counts(filter ImageFilter) (map[uint64]int64, error)
+	// 名称或别名包含 query 的标签：前缀匹配优先，其次命名空间后的前缀，最后是包含匹配，同级按使用次数排序
+	// 次数只统计匹配 filter 的图片，includeUnused 为 false 时跳过没有匹配图片的标签
+	Search(filter ImageFilter, query string, includeUnused bool, limit int) ([]TagUsage, error)
+	// 匹配 filter 的图片上除 filter.Tags 以外的标签，按使用次数倒序
+	Related(filter ImageFilter, limit int) ([]TagUsage, error)
+	// 匹配图片上名称属于 names 的标签，不区分大小写，names 需为小写，返回图片 ID 到标签名的映射
+	ImageTagNames(filter ImageFilter, names []string) (map[uint64][]string, error)
+	ImageTags(imageIDs []uint64, includeSystem bool) ([]model.ImageTagModel, error)
+	FindImageTag(imageID, tagID uint64) (model.ImageTagModel, error)
+	// ID 为 0 时新建，否则更新
+	SaveImageTag(imageTag *model.ImageTagModel) error
+	// 删除图片的用户标签或系统标签
+	DeleteImageTags(imageID uint64, isSystem bool) error
+	// 从多张图片上移除多个标签
+	RemoveImageTags(imageIDs, tagIDs []uint64) error
+	// 按创建时间升序
+	Aliases(tagID uint64) ([]string, error)
+	CreateAlias(alias *model.TagAliasModel) error
+	// 删除租户内的别名，返回别名是否存在
+	DeleteAlias(tenantID uint64, aliasName string) (bool, error)
+	// 按创建时间升序
+	Categories(tenantID uint64) ([]model.TagCategoryModel, error)
+	FindCategory(tenantID uint64, name string) (model.TagCategoryModel, error)
+	CategoryExists(tenantID uint64, name string) (bool, error)
+	// 创建分类，并将未分类的同命名空间标签归入该分类
+	CreateCategory(category *model.TagCategoryModel) error
+	// 更新分类颜色
+	UpdateCategory(category *model.TagCategoryModel) error
+	// 删除分类，所属标签变为未分类
+	DeleteCategory(category model.TagCategoryModel) error
+	AutoTagSettings(tenantID uint64, directory string) ([]model.DirectoryAutoTagModel, error)
+	// ID 为 0 时新建，否则更新开关
+	SaveAutoTagSetting(setting *model.DirectoryAutoTagModel) error
+}
+
+type AlbumRepository interface {
+	// 按创建时间倒序
+	List(tenantID uint64) ([]model.AlbumModel, error)
+	FindByID(tenantID, id uint64) (model.AlbumModel, error)
+	Create(album *model.AlbumModel) error
+	// 更新标题、描述、封面和更新时间
+	Update(album *model.AlbumModel) error
+	// 删除相册及其图片关联，不删除图片
+	Delete(id uint64) error
+	// 相册中的图片关联，按相册内顺序
+	Images(albumID uint64) ([]model.AlbumImageModel, error)
+	// 相册内顺序最靠前的图片关联
+	FirstImage(albumID uint64) (model.AlbumImageModel, error)
+	FindImage(albumID, imageID uint64) (model.AlbumImageModel, error)
+	ImageCount(albumID uint64) (int64, error)
+	AddImage(albumImage *model.AlbumImageModel) error
+	// 移除图片，移除的是封面时清空封面
+	RemoveImages(albumID uint64, imageIDs []uint64) error
+	SetPosition(albumImageID uint64, position int) error
+}
+
+type ShareRepository interface {
+	Create(share *model.ShareModel) error
+	// createdBy 为 0 时返回租户内的全部分享，按创建时间倒序
+	List(tenantID, createdBy uint64) ([]model.ShareModel, error)
+	FindByToken(token string) (model.ShareModel, error)
+	// 撤销分享，createdBy 不为 0 时只能撤销该用户创建的，返回是否找到分享
+	Revoke(tenantID, createdBy, id uint64) (bool, error)
+	// 访问次数加一
+	AddView(id uint64) error
+}
+
+// 随机接口的返回记录和不重复会话
+type RandomRepository interface {
+	// 匹配图片在 since 之后的返回记录
+	ServeHistory(filter ImageFilter, since time.Time) ([]model.ImageServeHistoryModel, error)
+	RecordServed(history []model.ImageServeHistoryModel) error
+	// 删除 before 之前的返回记录
+	PurgeServeHistory(before time.Time) error
+	// 会话中已经返回过的图片
+	SessionImages(sessionKey string) ([]uint64, error)
+	AddSessionImage(session *model.RandomSessionModel) error
+	ClearSession(sessionKey string) error
+	// 删除 before 之前创建的会话记录
+	PurgeSessions(before time.Time) error
+}
+
+type UserRepository interface {
+	FindByID(tenantID, id uint64) (model.UserModel, error)
+}
@@ -0,0 +1,187 @@
+package service_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"path/filepath"
+	"picture_storage/cache"
+	"picture_storage/config"
+	"picture_storage/db"
+	"picture_storage/model"
+	"picture_storage/service"
+	"picture_storage/service/memory"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 服务测试依次在每种数据访问实现上运行，users 是需要预先写入的用户
+var stores = []struct {
+	name string
+	new  func(t *testing.T, users []model.UserModel) service.Store
+}{
+	{"memory", func(t *testing.T, users []model.UserModel) service.Store {
+		store := memory.NewStore()
+		for _, user := range users {
+			store.AddUser(user)
+		}
+		return store
+	}},
+	{"sqlite", sqliteStore},
+}
+
+// 使用临时 SQLite 数据库和正式的迁移脚本
+func sqliteStore(t *testing.T, users []model.UserModel) service.Store {
+	previous := config.C
+	config.C = config.Default()
+	config.C.DB.Driver = "sqlite"
+	config.C.DB.Path = filepath.Join(t.TempDir(), "picture_storage.db")
+	defer func() { config.C = previous }()
+
+	if err := db.Init(); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	conn := db.DB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	for _, user := range users {
+		if err := conn.Create(&user).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	return service.NewGormStore(conn)
+}
+
+// 管理员和其他身份使用的测试环境，服务依赖 config.C 和 cache 等全局变量，不能并行执行
+type env struct {
+	*service.ImageService
+	Store   service.Store
+	Storage *memory.Storage
+	Clock   *memory.Clock
+}
+
+var users = []model.UserModel{
+	{ID: 1, TenantID: service.DefaultTenantID, Username: "admin", Role: service.RoleAdmin},
+	{ID: 2, TenantID: service.DefaultTenantID, Username: "uploader", Role: service.RoleUploader},
+	{ID: 3, TenantID: service.DefaultTenantID, Username: "viewer", Role: service.RoleViewer},
+}
+
+var (
+	adminActor    = service.UserActor(users[0])
+	uploaderActor = service.UserActor(users[1])
+	viewerActor   = service.UserActor(users[2])
+)
+
+func forEachStore(t *testing.T, fn func(t *testing.T, e *env)) {
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			fn(t, newEnv(t, store.new(t, users)))
+		})
+	}
+}
+
+// 使用默认配置和独立缓存创建测试环境，服务以管理员身份操作
+func newEnv(t *testing.T, store service.Store) *env {
+	previous := config.C
+	config.C = config.Default()
+	t.Cleanup(func() { config.C = previous })
+	cache.Use(cache.NewLRU(config.C.Cache.MaxEntries))
+
+	e := &env{
+		Store:   store,
+		Storage: memory.NewStorage(),
+		Clock:   memory.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Second),
+	}
+	e.ImageService = service.NewImageService(e.Storage, e.Store, e.Clock).As(adminActor)
+	return e
+}
+
+// 生成指定尺寸的纯色 PNG，不同颜色的内容不同，不会被去重
+func pngData(t *testing.T, width, height int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// 构造与表单上传相同的文件
+func fileHeader(t *testing.T, filename string, data []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	writer.Close()
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(int64(body.Len()) + 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["file"][0]
+}
+
+// 以管理员身份上传，gray 用于区分图片内容
+func (e *env) upload(t *testing.T, directory string, gray uint8, tags ...string) uint64 {
+	t.Helper()
+	filename := "image.png"
+	id, err := e.SaveImage(directory, fileHeader(t, filename, pngData(t, 4, 4, color.Gray{Y: gray})), tags)
+	if err != nil {
+		t.Fatalf("save image: %v", err)
+	}
+	return id
+}
+
+// 只允许管理员访问 directory
+func (e *env) restrict(t *testing.T, directory string) {
+	t.Helper()
+	if err := e.SetDirectoryPermission(directory, adminActor.UserID, service.PermissionRead); err != nil {
+		t.Fatalf("set permission: %v", err)
+	}
+}
+
+func listIDs(t *testing.T, images *service.ImageService, directory string, tags []string, page model.Pagination) ([]uint64, int64) {
+	t.Helper()
+	list, total, err := images.GetImageListByDirectory(directory, tags, page)
+	if err != nil {
+		t.Fatalf("list %s %v: %v", directory, tags, err)
+	}
+	ids := make([]uint64, 0, len(list))
+	for _, image := range list {
+		ids = append(ids, image.ID)
+	}
+	return ids, total
+}
+
+func tagCounts(t *testing.T, images *service.ImageService) map[string]int64 {
+	t.Helper()
+	details, err := images.GetTagDetails()
+	if err != nil {
+		t.Fatalf("tag details: %v", err)
+	}
+	counts := make(map[string]int64)
+	for _, detail := range details {
+		counts[detail.Name] = detail.Count
+	}
+	return counts
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"picture_storage/model"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 分享链接的默认和最长有效期
+const (
+	defaultShareExpiry = 7 * 24 * time.Hour
+	maxShareExpiry     = 365 * 24 * time.Hour
+)
+
+var (
+	ErrShareNotFound        = Errorf(CodeNotFound, "分享不存在")
+	ErrShareExpired         = Errorf(CodeShareExpired, "分享已过期")
+	ErrSharePasswordInvalid = Errorf(CodeSharePasswordInvalid, "分享密码错误")
+)
+
+type ShareService struct {
+	imageService *ImageService
+}
+
+// 权限检查和图片访问复用 imageService
+func NewShareService(imageService *ImageService) *ShareService {
+	return &ShareService{
+		imageService: imageService,
+	}
+}
+
+// 返回以指定身份操作的服务
+func (service *ShareService) As(actor Actor) *ShareService {
+	return &ShareService{
+		imageService: service.imageService.As(actor),
+	}
+}
+
+func (service *ShareService) store() Store {
+	return service.imageService.store
+}
+
+type CreateShareRequest struct {
+	TargetType string
+	TargetID   uint64
+	Tags       []string
+	Directory  string
+	ExpiresIn  time.Duration
+	Password   string
+}
+
+// 创建分享链接
+func (service *ShareService) CreateShare(req CreateShareRequest) (model.ShareModel, error) {
+	tenantID := service.imageService.actor.TenantID
+	share := model.ShareModel{
+		TenantID:   tenantID,
+		CreatedBy:  service.imageService.actor.UserID,
+		TargetType: req.TargetType,
+		Directory:  req.Directory,
+	}
+	if err := service.imageService.requireUpload(); err != nil {
+		return share, err
+	}
+
+	switch req.TargetType {
+	case model.ShareTypeImage:
+		images, err := service.store().Images().FindByIDs(tenantID, []uint64{req.TargetID})
+		if err != nil {
+			return share, err
+		}
+		if len(images) == 0 {
+			return share, gorm.ErrRecordNotFound
+		}
+		if err := service.imageService.checkImages(service.store(), []uint64{req.TargetID}, false); err != nil {
+			return share, err
+		}
+		share.TargetID = req.TargetID
+	case model.ShareTypeAlbum:
+		if _, err := service.store().Albums().FindByID(tenantID, req.TargetID); err != nil {
+			return share, err
+		}
+		share.TargetID = req.TargetID
+	case model.ShareTypeTag:
+		// 标签分享会跨目录公开图片，只允许管理员创建
+		if err := service.imageService.requireAdmin(); err != nil {
+			return share, err
+		}
+		if len(req.Tags) == 0 {
+			return share, Errorf(CodeInvalidArgument, "标签分享需要指定标签")
+		}
+		share.Tags = strings.Join(req.Tags, ",")
+	default:
+		return share, Errorf(CodeInvalidArgument, "未知的分享类型 '%s'", req.TargetType)
+	}
+
+	expiresIn := req.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = defaultShareExpiry
+	}
+	if expiresIn > maxShareExpiry {
+		return share, Errorf(CodeInvalidArgument, "分享有效期不能超过 %d 天", int(maxShareExpiry.Hours()/24))
+	}
+	share.CreatedAt = service.imageService.clock.Now()
+	share.ExpiresAt = share.CreatedAt.Add(expiresIn)
+
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return share, err
+		}
+		share.PasswordHash = string(hash)
+	}
+
+	token, err := newRandomToken(18)
+	if err != nil {
+		return share, err
+	}
+	share.Token = token
+
+	if err := service.store().Shares().Create(&share); err != nil {
+		return share, err
+	}
+	return share, nil
+}
+
+// 分享列表：管理员可以看到租户内的全部分享，其他用户只能看到自己创建的
+func (service *ShareService) GetShares() ([]model.ShareModel, error) {
+	if err := service.imageService.requireUpload(); err != nil {
+		return nil, err
+	}
+	actor := service.imageService.actor
+	return service.store().Shares().List(actor.TenantID, service.ownerFilter())
+}
+
+// 撤销分享，只有创建者和管理员可以撤销
+func (service *ShareService) RevokeShare(shareID uint64) error {
+	if err := service.imageService.requireUpload(); err != nil {
+		return err
+	}
+	actor := service.imageService.actor
+	found, err := service.store().Shares().Revoke(actor.TenantID, service.ownerFilter(), shareID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// 当前身份可以管理的分享的创建者，管理员可以管理租户内的全部分享，返回 0
+func (service *ShareService) ownerFilter() uint64 {
+	actor := service.imageService.actor
+	if actor.IsAdmin() {
+		return 0
+	}
+	return actor.UserID
+}
+
+// 分享按创建者的权限展示图片，创建者失去目录权限后分享中也看不到这些图片
+// 升级前创建的分享没有记录创建者，按租户管理员处理
+func (service *ShareService) shareActor(share model.ShareModel) (Actor, error) {
+	if share.CreatedBy == 0 {
+		return Actor{TenantID: share.TenantID, Role: RoleAdmin}, nil
+	}
+	user, err := service.store().Users().FindByID(share.TenantID, share.CreatedBy)
+	if err == gorm.ErrRecordNotFound {
+		return Actor{}, ErrShareNotFound
+	}
+	if err != nil {
+		return Actor{}, err
+	}
+	return UserActor(user), nil
+}
+
+// 查找未撤销、未过期的分享
+func (service *ShareService) findShare(token string) (model.ShareModel, error) {
+	share, err := service.store().Shares().FindByToken(token)
+	if err == gorm.ErrRecordNotFound || (err == nil && share.Revoked) {
+		return share, ErrShareNotFound
+	}
+	if err != nil {
+		return share, err
+	}
+	if service.imageService.clock.Now().After(share.ExpiresAt) {
+		return share, ErrShareExpired
+	}
+	return share, nil
+}
+
+// 校验分享令牌和密码，countView 为 true 时增加访问次数
+func (service *ShareService) ResolveShare(token, password string, countView bool) (model.ShareModel, error) {
+	share, err := service.findShare(token)
+	if err != nil {
+		return share, err
+	}
+	if share.PasswordHash != "" {
+		if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+			return share, ErrSharePasswordInvalid
+		}
+	}
+
+	if countView {
+		if err := service.store().Shares().AddView(share.ID); err != nil {
+			return share, err
+		}
+		share.ViewCount++
+	}
+	return share, nil
+}
+
+// 图片访问令牌的有效期，不超过分享本身的有效期
+const shareAccessExpiry = time.Hour
+
+// 为有密码的分享签发图片访问令牌，图片地址带上令牌而不是密码
+// 以密码哈希为密钥签名，修改密码后旧令牌失效；没有密码的分享返回空
+func (service *ShareService) AccessToken(share model.ShareModel) string {
+	if share.PasswordHash == "" {
+		return ""
+	}
+	expiresAt := service.imageService.clock.Now().Add(shareAccessExpiry)
+	if share.ExpiresAt.Before(expiresAt) {
+		expiresAt = share.ExpiresAt
+	}
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expires + "." + shareAccessSignature(share, expires)
+}
+
+func shareAccessSignature(share model.ShareModel, expires string) string {
+	mac := hmac.New(sha256.New, []byte(share.PasswordHash))
+	mac.Write([]byte(share.Token + "\x00" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 访问分享中的图片：有效的访问令牌可以代替密码
+func (service *ShareService) ResolveShareImage(token, password, access string) (model.ShareModel, error) {
+	if access == "" {
+		return service.ResolveShare(token, password, false)
+	}
+	share, err := service.findShare(token)
+	if err != nil {
+		return share, err
+	}
+	expires, signature, _ := strings.Cut(access, ".")
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || share.PasswordHash == "" ||
+		!hmac.Equal([]byte(signature), []byte(shareAccessSignature(share, expires))) ||
+		service.imageService.clock.Now().Unix() > expiresAt {
+		return share, ErrSharePasswordInvalid
+	}
+	return share, nil
+}
+
+// 分享包含的图片的查询条件，只包含分享所属租户中创建者可以访问的图片
+func (service *ShareService) shareImageFilter(share model.ShareModel) (ImageFilter, error) {
+	actor, err := service.shareActor(share)
+	if err != nil {
+		return ImageFilter{}, err
+	}
+	creatorImageService := service.imageService.As(actor)
+	filter := creatorImageService.visibleImages()
+	switch share.TargetType {
+	case model.ShareTypeImage:
+		filter.IDs = []uint64{share.TargetID}
+	case model.ShareTypeAlbum:
+		filter.AlbumID = share.TargetID
+	case model.ShareTypeTag:
+		tags, err := creatorImageService.resolveTagNames(creatorImageService.store, strings.Split(share.Tags, ","))
+		if err != nil {
+			return filter, err
+		}
+		filter.Tags = tags
+		filter.Directory = share.Directory
+	default:
+		return filter, Errorf(CodeInvalidArgument, "未知的分享类型 '%s'", share.TargetType)
+	}
+	return filter, nil
+}
+
+// 分享包含的图片列表，相册按相册内顺序，其余按上传时间倒序
+func (service *ShareService) GetShareImages(share model.ShareModel, page model.Pagination) ([]model.ImageModel, int64, error) {
+	filter, err := service.shareImageFilter(share)
+	if err != nil {
+		return nil, 0, err
+	}
+	return service.store().Images().List(filter, page)
+}
+
+// 获取分享中的单张图片，不属于该分享时返回 ErrShareNotFound
+func (service *ShareService) GetShareImage(share model.ShareModel, imageID uint64) (model.ImageModel, error) {
+	filter, err := service.shareImageFilter(share)
+	if err != nil {
+		return model.ImageModel{}, err
+	}
+	if len(filter.IDs) > 0 && !slices.Contains(filter.IDs, imageID) {
+		return model.ImageModel{}, ErrShareNotFound
+	}
+	filter.IDs = []uint64{imageID}
+	images, err := service.store().Images().Find(filter)
+	if err != nil {
+		return model.ImageModel{}, err
+	}
+	if len(images) == 0 {
+		return model.ImageModel{}, ErrShareNotFound
+	}
+	return images[0], nil
+}
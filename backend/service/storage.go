@@ -0,0 +1,32 @@
+package service
+
+import (
+	"io"
+	"time"
+)
+
+// 图片文件的存储，默认实现为 minio.Client，memory 包提供内存实现
+// 文件不存在时返回的错误应能被 minio.IsNotFound 识别
+type Storage interface {
+	// 以内容的 MD5 加原扩展名作为对象名上传，返回对象名和大小，bucket 不存在时自动创建
+	UploadFile(bucket, originalFilename string, size int64, content io.Reader, contentType string) (string, int64, error)
+	UploadFileBytes(bucket, originalFilename string, size int64, content []byte, contentType string) (string, int64, error)
+	GetDirectoryList() ([]string, error)
+	GetFile(bucket, object string) ([]byte, error)
+	OpenFile(bucket, object string) (io.ReadSeekCloser, error)
+	GetObjectURL(bucket, object string) (string, error)
+	DeleteFile(bucket, object string) error
+}
+
+// 当前时间的来源，测试时可以替换为固定的时间
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+var SystemClock Clock = systemClock{}
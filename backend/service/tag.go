@@ -0,0 +1,546 @@
+package service
+
+import (
+	"picture_storage/model"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 在当前租户中按名称查找标签
+func (service *ImageService) findTag(store Store, tagName string) (model.TagModel, error) {
+	return store.Tags().FindByName(service.actor.TenantID, tagName)
+}
+
+// 将别名解析为规范标签名，结果去重并保持原有顺序
+func (service *ImageService) resolveTagNames(store Store, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	aliasMap, err := store.Tags().ResolveAliases(service.actor.TenantID, names)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if canonical, ok := aliasMap[name]; ok {
+			name = canonical
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// 检查名称是否已被标签或别名占用
+func (service *ImageService) checkTagNameAvailable(store Store, name string) error {
+	_, err := service.findTag(store, name)
+	if err == nil {
+		return Errorf(CodeTagExists, "标签 '%s' 已存在", name)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	aliasMap, err := store.Tags().ResolveAliases(service.actor.TenantID, []string{name})
+	if err != nil {
+		return err
+	}
+	if _, ok := aliasMap[name]; ok {
+		return Errorf(CodeTagExists, "'%s' 已是其他标签的别名", name)
+	}
+	return nil
+}
+
+// 将源标签合并到目标标签，源标签名保留为目标标签的别名
+func (service *ImageService) MergeTags(targetName string, sourceNames []string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
+	err := service.store.Transaction(func(store Store) error {
+		target, err := service.findTag(store, targetName)
+		if err != nil {
+			return err
+		}
+
+		for _, sourceName := range sourceNames {
+			if sourceName == targetName {
+				continue
+			}
+			source, err := service.findTag(store, sourceName)
+			if err != nil {
+				return err
+			}
+			if err := store.Tags().Merge(source.ID, target.ID); err != nil {
+				return err
+			}
+
+			// 记录源标签名为别名
+			alias := &model.TagAliasModel{
+				TagID:     target.ID,
+				AliasName: source.TagName,
+				CreatedAt: service.clock.Now(),
+			}
+			if err := store.Tags().CreateAlias(alias); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
+}
+
+// 获取标签的所有别名
+func (service *ImageService) GetTagAliases(tagName string) ([]string, error) {
+	tag, err := service.findTag(service.store, tagName)
+	if err != nil {
+		return nil, err
+	}
+	return service.store.Tags().Aliases(tag.ID)
+}
+
+// 为标签添加别名
+func (service *ImageService) AddTagAlias(tagName, aliasName string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
+	tag, err := service.findTag(service.store, tagName)
+	if err != nil {
+		return err
+	}
+	if err := service.checkTagNameAvailable(service.store, aliasName); err != nil {
+		return err
+	}
+	return service.store.Tags().CreateAlias(&model.TagAliasModel{
+		TagID:     tag.ID,
+		AliasName: aliasName,
+		CreatedAt: service.clock.Now(),
+	})
+}
+
+// 删除别名
+func (service *ImageService) DeleteTagAlias(aliasName string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
+	found, err := service.store.Tags().DeleteAlias(service.actor.TenantID, aliasName)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return Errorf(CodeNotFound, "别名 '%s' 不存在", aliasName)
+	}
+	return nil
+}
+
+var tagCategoryColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// 解析 namespace:value 形式的标签名，返回命名空间
+func parseTagNamespace(tagName string) (string, bool) {
+	namespace, value, found := strings.Cut(tagName, ":")
+	if !found || namespace == "" || value == "" {
+		return "", false
+	}
+	return namespace, true
+}
+
+// 根据标签名的命名空间匹配已存在的分类，未匹配返回空
+func (service *ImageService) tagCategoryOf(store Store, tagName string) (string, error) {
+	namespace, ok := parseTagNamespace(tagName)
+	if !ok {
+		return "", nil
+	}
+	exists, err := store.Tags().CategoryExists(service.actor.TenantID, namespace)
+	if err != nil || !exists {
+		return "", err
+	}
+	return namespace, nil
+}
+
+// 构造新标签，自动分配分类
+func (service *ImageService) newTag(store Store, tagName string) (model.TagModel, error) {
+	category, err := service.tagCategoryOf(store, tagName)
+	if err != nil {
+		return model.TagModel{}, err
+	}
+	return model.TagModel{
+		TenantID:  service.actor.TenantID,
+		TagName:   tagName,
+		Category:  category,
+		CreatedAt: service.clock.Now(),
+	}, nil
+}
+
+func validateTagCategory(name, color string) error {
+	if name == "" || strings.Contains(name, ":") {
+		return Errorf(CodeInvalidArgument, "分类名 '%s' 不合法", name)
+	}
+	if color != "" && !tagCategoryColorPattern.MatchString(color) {
+		return Errorf(CodeInvalidArgument, "颜色 '%s' 不合法，应为 #RRGGBB 格式", color)
+	}
+	return nil
+}
+
+// 获取所有标签分类
+func (service *ImageService) GetTagCategories() ([]model.TagCategoryModel, error) {
+	return service.store.Tags().Categories(service.actor.TenantID)
+}
+
+// 创建标签分类，并将已有的同命名空间标签归入该分类
+func (service *ImageService) CreateTagCategory(name, color string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
+	if err := validateTagCategory(name, color); err != nil {
+		return err
+	}
+
+	exists, err := service.store.Tags().CategoryExists(service.actor.TenantID, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return Errorf(CodeAlreadyExists, "分类 '%s' 已存在", name)
+	}
+
+	err = service.store.Transaction(func(store Store) error {
+		return store.Tags().CreateCategory(&model.TagCategoryModel{
+			TenantID:  service.actor.TenantID,
+			Name:      name,
+			Color:     color,
+			CreatedAt: service.clock.Now(),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
+}
+
+// 更新分类颜色
+func (service *ImageService) UpdateTagCategory(name, color string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
+	if err := validateTagCategory(name, color); err != nil {
+		return err
+	}
+	category, err := service.store.Tags().FindCategory(service.actor.TenantID, name)
+	if err != nil {
+		return err
+	}
+	category.Color = color
+	if err := service.store.Tags().UpdateCategory(&category); err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
+}
+
+// 删除分类，所属标签变为未分类
+func (service *ImageService) DeleteTagCategory(name string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
+	category, err := service.store.Tags().FindCategory(service.actor.TenantID, name)
+	if err != nil {
+		return err
+	}
+
+	err = service.store.Transaction(func(store Store) error {
+		return store.Tags().DeleteCategory(category)
+	})
+	if err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
+}
+
+// 手动设置标签分类，category 为空表示取消分类
+func (service *ImageService) SetTagCategory(tagName, category string) error {
+	if err := service.requireAdmin(); err != nil {
+		return err
+	}
+
+	tag, err := service.findTag(service.store, tagName)
+	if err != nil {
+		return err
+	}
+	if category != "" {
+		exists, err := service.store.Tags().CategoryExists(service.actor.TenantID, category)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return Errorf(CodeNotFound, "分类 '%s' 不存在", category)
+		}
+	}
+	tag.Category = category
+	if err := service.store.Tags().Update(&tag); err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
+}
+
+type TagGroup struct {
+	Category string          `json:"category"`
+	Color    string          `json:"color"`
+	Tags     []TagDetailItem `json:"tags"`
+}
+
+// 按分类对标签分组，分类顺序与分类创建顺序一致，未分类的标签放在最后
+func (service *ImageService) GroupTagDetails(tagDetails []TagDetailItem) ([]TagGroup, error) {
+	categories, err := service.GetTagCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]TagGroup, 0, len(categories)+1)
+	groupIndex := make(map[string]int)
+	for _, category := range categories {
+		groupIndex[category.Name] = len(groups)
+		groups = append(groups, TagGroup{
+			Category: category.Name,
+			Color:    category.Color,
+			Tags:     make([]TagDetailItem, 0),
+		})
+	}
+	groupIndex[""] = len(groups)
+	groups = append(groups, TagGroup{
+		Tags: make([]TagDetailItem, 0),
+	})
+
+	for _, tagDetail := range tagDetails {
+		index, ok := groupIndex[tagDetail.Category]
+		if !ok {
+			index = groupIndex[""]
+		}
+		groups[index].Tags = append(groups[index].Tags, tagDetail)
+	}
+
+	// 去掉空分组
+	result := make([]TagGroup, 0, len(groups))
+	for _, group := range groups {
+		if len(group.Tags) > 0 {
+			result = append(result, group)
+		}
+	}
+	return result, nil
+}
+
+// 查找标签，不存在时创建
+func (service *ImageService) findOrCreateTag(store Store, tagName string) (model.TagModel, error) {
+	tag, err := service.findTag(store, tagName)
+	if err == nil {
+		return tag, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return tag, err
+	}
+
+	// 标签不存在，创建新标签
+	tag, err = service.newTag(store, tagName)
+	if err != nil {
+		return tag, err
+	}
+	if err := store.Tags().Create(&tag); err != nil {
+		return tag, err
+	}
+	return tag, nil
+}
+
+// 为图片添加标签关联，已存在时跳过；用户手动添加的标签会覆盖同名的系统标签
+func (service *ImageService) addImageTag(store Store, imageID, tagID uint64, isSystem bool) error {
+	imageTag, err := store.Tags().FindImageTag(imageID, tagID)
+	if err == nil {
+		if imageTag.IsSystem && !isSystem {
+			imageTag.IsSystem = false
+			return store.Tags().SaveImageTag(&imageTag)
+		}
+		return nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	return store.Tags().SaveImageTag(&model.ImageTagModel{
+		ImageID:   imageID,
+		TagID:     tagID,
+		IsSystem:  isSystem,
+		CreatedAt: service.clock.Now(),
+	})
+}
+
+// 用给定标签替换图片的全部用户标签，系统生成的标签保留
+func (service *ImageService) replaceImageTags(store Store, imageID uint64, tags []string) error {
+	// 别名解析为规范标签
+	tags, err := service.resolveTagNames(store, tags)
+	if err != nil {
+		return err
+	}
+
+	// 先删除旧的标签关联
+	if err := store.Tags().DeleteImageTags(imageID, false); err != nil {
+		return err
+	}
+
+	for _, tagName := range tags {
+		tag, err := service.findOrCreateTag(store, tagName)
+		if err != nil {
+			return err
+		}
+		if err := service.addImageTag(store, imageID, tag.ID, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 从多张图片上移除指定标签，标签本身保留
+func (service *ImageService) RemoveTags(imageIDs []uint64, tags []string) error {
+	if err := service.requireUpload(); err != nil {
+		return err
+	}
+	if len(imageIDs) == 0 || len(tags) == 0 {
+		return nil
+	}
+	if err := service.checkImages(service.store, imageIDs, true); err != nil {
+		return err
+	}
+
+	tags, err := service.resolveTagNames(service.store, tags)
+	if err != nil {
+		return err
+	}
+
+	found, err := service.store.Tags().FindByNames(service.actor.TenantID, tags)
+	if err != nil {
+		return err
+	}
+	tagIDs := make([]uint64, 0, len(found))
+	for _, tag := range found {
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	if err := service.store.Tags().RemoveImageTags(imageIDs, tagIDs); err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
+}
+
+// 原子地替换单张图片的标签列表
+func (service *ImageService) SetImageTags(imageID uint64, tags []string) error {
+	if err := service.requireUpload(); err != nil {
+		return err
+	}
+
+	err := service.store.Transaction(func(store Store) error {
+		images, err := store.Images().FindByIDs(service.actor.TenantID, []uint64{imageID})
+		if err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := service.checkImages(store, []uint64{imageID}, true); err != nil {
+			return err
+		}
+		return service.replaceImageTags(store, imageID, tags)
+	})
+	if err != nil {
+		return err
+	}
+	service.invalidateTags()
+	return nil
+}
+
+// 分类名到颜色的映射
+func (service *ImageService) tagCategoryColors() (map[string]string, error) {
+	categories, err := service.GetTagCategories()
+	if err != nil {
+		return nil, err
+	}
+	colorMap := make(map[string]string)
+	for _, category := range categories {
+		colorMap[category.Name] = category.Color
+	}
+	return colorMap, nil
+}
+
+func (service *ImageService) toTagDetails(usages []TagUsage) ([]TagDetailItem, error) {
+	colorMap, err := service.tagCategoryColors()
+	if err != nil {
+		return nil, err
+	}
+	tagDetails := make([]TagDetailItem, 0, len(usages))
+	for _, usage := range usages {
+		tagDetails = append(tagDetails, TagDetailItem{
+			Name:     usage.Name,
+			Count:    usage.Count,
+			Category: usage.Category,
+			Color:    colorMap[usage.Category],
+		})
+	}
+	return tagDetails, nil
+}
+
+// 标签自动补全：前缀匹配优先，其次命名空间后的前缀，最后是包含匹配；同级按使用次数排序
+// 管理员保留没有图片的标签，其他身份只保留有可见图片的标签，避免通过标签名看到无权访问的目录中的内容
+func (service *ImageService) AutocompleteTags(query string, limit int) ([]TagDetailItem, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []TagDetailItem{}, nil
+	}
+
+	usages, err := service.store.Tags().Search(service.visibleImages(), query, service.actor.IsAdmin(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return service.toTagDetails(usages)
+}
+
+// 相关标签：统计同时拥有所有给定标签的图片上，其他标签出现的次数
+func (service *ImageService) RelatedTags(tags []string, limit int) ([]TagDetailItem, error) {
+	tags, err := service.resolveTagNames(service.store, tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return []TagDetailItem{}, nil
+	}
+
+	found, err := service.store.Tags().FindByNames(service.actor.TenantID, tags)
+	if err != nil {
+		return nil, err
+	}
+	// 有标签不存在时不可能有图片同时拥有全部标签
+	if len(found) != len(tags) {
+		return []TagDetailItem{}, nil
+	}
+
+	filter := service.visibleImages()
+	filter.Tags = tags
+	usages, err := service.store.Tags().Related(filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	return service.toTagDetails(usages)
+}
@@ -0,0 +1,89 @@
+package service_test
+
+import (
+	"picture_storage/model"
+	"picture_storage/service"
+	"slices"
+	"testing"
+)
+
+// 标签过滤、自动补全和相关标签在各数据库上拼出的 SQL 不同，结果必须一致
+func TestTagQueries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, e *env) {
+		tagNames := func(details []service.TagDetailItem, err error) []string {
+			t.Helper()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(details))
+			for _, detail := range details {
+				names = append(names, detail.Name)
+			}
+			return names
+		}
+
+		a := e.upload(t, "photos", 10, "cat", "catalog", "100%")
+		b := e.upload(t, "photos", 20, "cat", "catalog", "bobcat", "1_0")
+		e.upload(t, "photos", 30, "animal:cat", "dog")
+		e.upload(t, "private", 40, "cat", "secret")
+		e.restrict(t, "private")
+		if err := e.AddTagAlias("dog", "puppy"); err != nil {
+			t.Fatal(err)
+		}
+
+		page := model.Pagination{Page: 1, PageSize: 10}
+		lists := []struct {
+			tags []string
+			want []uint64
+		}{
+			{[]string{"cat", "catalog"}, []uint64{b, a}},
+			{[]string{"catalog", "100%"}, []uint64{a}},
+			{[]string{"cat", "1_0", "bobcat"}, []uint64{b}},
+			{[]string{"cat", "secret"}, []uint64{}},
+		}
+		for _, tc := range lists {
+			if ids, total := listIDs(t, e.ImageService, "photos", tc.tags, page); !slices.Equal(ids, tc.want) || total != int64(len(tc.want)) {
+				t.Errorf("list %v = %v, %d; want %v", tc.tags, ids, total, tc.want)
+			}
+		}
+
+		completions := []struct {
+			images *service.ImageService
+			query  string
+			want   []string
+		}{
+			// 前缀匹配优先，其次命名空间后的前缀，最后是包含匹配
+			{e.ImageService, "cat", []string{"cat", "catalog", "animal:cat", "bobcat"}},
+			// LIKE 的通配符按普通字符匹配
+			{e.ImageService, "0%", []string{"100%"}},
+			{e.ImageService, "1_", []string{"1_0"}},
+			{e.ImageService, "PUP", []string{"dog"}},
+			{e.ImageService, "secret", []string{"secret"}},
+			{e.As(viewerActor), "secret", []string{}},
+		}
+		for _, tc := range completions {
+			names := tagNames(tc.images.AutocompleteTags(tc.query, 10))
+			if !slices.Equal(names, tc.want) {
+				t.Errorf("autocomplete %q = %v; want %v", tc.query, names, tc.want)
+			}
+		}
+
+		// 自动标签也会参与统计，只比较用户标签之间的先后
+		names := tagNames(e.RelatedTags([]string{"cat"}, 20))
+		if i := slices.Index(names, "catalog"); i < 0 || i > slices.Index(names, "bobcat") || slices.Contains(names, "dog") {
+			t.Errorf("related cat = %v", names)
+		}
+		names = tagNames(e.RelatedTags([]string{"cat", "catalog"}, 20))
+		for _, name := range []string{"100%", "1_0", "bobcat"} {
+			if !slices.Contains(names, name) {
+				t.Errorf("related cat, catalog = %v; missing %s", names, name)
+			}
+		}
+		if slices.Contains(names, "cat") || slices.Contains(names, "catalog") || slices.Contains(names, "secret") {
+			t.Errorf("related cat, catalog = %v", names)
+		}
+		if names := tagNames(e.As(viewerActor).RelatedTags([]string{"secret"}, 10)); len(names) != 0 {
+			t.Errorf("viewer related secret = %v", names)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"fmt"
+	"picture_storage/config"
+	"picture_storage/db"
+	"picture_storage/model"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 默认租户，沿用升级前的数据和不带前缀的 bucket
+const DefaultTenantID uint64 = 1
+
+// 缩略图统一存放的目录
+func thumbnailDirectory() string {
+	return config.C.Thumbnail.Bucket
+}
+
+// 新租户创建时带上的默认标签分类
+var defaultTagCategories = []model.TagCategoryModel{
+	{Name: "character", Color: "#00aa00"},
+	{Name: "artist", Color: "#aa0000"},
+	{Name: "source", Color: "#aa00aa"},
+	{Name: "rating", Color: "#0073ff"},
+}
+
+var tenantBucketPattern = regexp.MustCompile(`^t([0-9]+)-(.+)$`)
+
+// 目录对应的 bucket：默认租户直接使用目录名，其他租户加 t<租户ID>- 前缀
+func TenantBucket(tenantID uint64, directory string) string {
+	if tenantID == DefaultTenantID {
+		return directory
+	}
+	return fmt.Sprintf("t%d-%s", tenantID, directory)
+}
+
+// 解析 bucket 所属的租户和目录名
+func ParseTenantBucket(bucket string) (uint64, string) {
+	if match := tenantBucketPattern.FindStringSubmatch(bucket); match != nil {
+		if tenantID, err := strconv.ParseUint(match[1], 10, 64); err == nil && tenantID != DefaultTenantID {
+			return tenantID, match[2]
+		}
+	}
+	return DefaultTenantID, bucket
+}
+
+// 检查目录名能否作为当前租户的 bucket，默认租户的目录不能与其他租户的前缀冲突
+func validateDirectory(tenantID uint64, directory string) error {
+	if directory == "" || directory == thumbnailDirectory() {
+		return Errorf(CodeInvalidArgument, "目录名 '%s' 不合法", directory)
+	}
+	if owner, _ := ParseTenantBucket(TenantBucket(tenantID, directory)); owner != tenantID {
+		return Errorf(CodeInvalidArgument, "目录名 '%s' 不合法", directory)
+	}
+	return nil
+}
+
+type TenantService struct {
+}
+
+func NewTenantService() *TenantService {
+	return &TenantService{}
+}
+
+// 租户列表
+func (service *TenantService) GetTenants() ([]model.TenantModel, error) {
+	tenants := make([]model.TenantModel, 0)
+	if err := db.DB.Order("id ASC").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// 创建租户及其第一个管理员
+func (service *TenantService) CreateTenant(name, username, password string) (model.TenantModel, error) {
+	tenant := model.TenantModel{Name: strings.TrimSpace(name)}
+	if tenant.Name == "" {
+		return tenant, Errorf(CodeInvalidArgument, "租户名不能为空")
+	}
+	admin, err := newUser(username, password, RoleAdmin)
+	if err != nil {
+		return tenant, err
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tenant, tx.Error
+	}
+
+	var count int64
+	if err := tx.Model(&model.TenantModel{}).Where("name = ?", tenant.Name).Count(&count).Error; err != nil {
+		tx.Rollback()
+		return tenant, err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return tenant, Errorf(CodeAlreadyExists, "租户 '%s' 已存在", tenant.Name)
+	}
+	if err := tx.Create(&tenant).Error; err != nil {
+		tx.Rollback()
+		return tenant, err
+	}
+
+	if err := seedTagCategories(tx, tenant.ID); err != nil {
+		tx.Rollback()
+		return tenant, err
+	}
+
+	admin.TenantID = tenant.ID
+	if err := createUser(tx, &admin); err != nil {
+		tx.Rollback()
+		return tenant, err
+	}
+
+	return tenant, tx.Commit().Error
+}
+
+func seedTagCategories(tx *gorm.DB, tenantID uint64) error {
+	for _, category := range defaultTagCategories {
+		category.TenantID = tenantID
+		if err := tx.Create(&category).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
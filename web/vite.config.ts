@@ -13,6 +13,10 @@ export default defineConfig({
         target: 'http://localhost:10048',
         changeOrigin: true,
       },
+      '/files': {
+        target: 'http://localhost:10048',
+        changeOrigin: true,
+      },
     },
   },
   plugins: [